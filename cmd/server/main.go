@@ -8,6 +8,7 @@ import (
 	"context"
 	"expvar"
 	"flag"
+	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"github.com/vpoliboy/appmeta/pkg/config"
@@ -17,6 +18,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 )
 
@@ -25,15 +27,25 @@ const (
 )
 
 var (
-	serverAddr string
-	debug      bool
-	confDir    string
+	confDir     string
+	printConfig bool
+	serverFlags *config.ServerFlags
 )
 
 func init() {
-	flag.StringVar(&serverAddr, "addr", ":8080", "http server address")
-	flag.BoolVar(&debug, "debug", false, "debug mode")
-	flag.StringVar(&confDir, "conf", "./conf", "directory to look into for config files")
+	flag.StringVar(&confDir, "conf", "./conf", "directory to look into for config files, "+config.EnvPrefix+"_CONF when not specified")
+	flag.BoolVar(&printConfig, "print-config", false, "print the effective config merged from the server.yaml, the environment and the flags, and exit")
+	serverFlags = config.NewServerFlags(flag.CommandLine)
+
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(out, "\nThe flags override the environment variables, which override the server.yaml of the config directory:\n")
+		for _, name := range config.DefaultServerConfig().EnvVars() {
+			fmt.Fprintf(out, "  %s\n", name)
+		}
+	}
 }
 
 func main() {
@@ -41,37 +53,162 @@ func main() {
 	flag.Parse()
 
 	logger := logrus.New()
-	if debug {
-		logger.Info("Running in debug mode")
-		logger.SetLevel(logrus.DebugLevel)
+
+	if !isFlagSet("conf") {
+		if dir, ok := os.LookupEnv(config.EnvPrefix + "_CONF"); ok {
+			confDir = dir
+		}
+	}
+	serverConfig, err := config.LoadServerConfig(confDir, os.Environ())
+	if err != nil {
+		logger.Fatal("Error loading the server config from ", confDir, ": ", err)
 	}
+	serverFlags.Apply(serverConfig)
 
-	var metadataServiceOpts []metadata.ServiceOption
+	// the config is printed even when invalid, that is when it is the most useful
+	if printConfig {
+		out, err := serverConfig.Yaml()
+		if err != nil {
+			logger.Fatal("Error printing the server config: ", err)
+		}
+		os.Stdout.Write(out)
+	}
+	if err = serverConfig.Validate(); err != nil {
+		logger.Fatal(err)
+	}
+	if printConfig {
+		return
+	}
 
-	analyzerConfig, err := config.LoadAnalyzerConfig(confDir)
-	if err == nil {
-		metadataServiceOpts = append(metadataServiceOpts, metadata.WithMappings(analyzerConfig))
+	level, _ := logrus.ParseLevel(serverConfig.Log.Level)
+	logger.SetLevel(level)
+	if serverConfig.Log.Format == config.LogFormatJson {
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	}
+	logger.Debug("Running with log level ", level)
+
+	// the custom fields are set before the analyzer config is loaded as the analyzer config can map them to tokenizers
+	fieldsState := config.FieldsState(confDir)
+	customFields, err := config.LoadFieldsConfig(confDir)
+	if err != nil {
+		logger.Fatal("Error loading the custom fields from ", confDir, ": ", err)
+	}
+	if err = metadata.SetCustomFields(customFields...); err != nil {
+		logger.Fatal("Error setting the custom fields: ", err)
+	}
+
+	var (
+		metadataServiceOpts []metadata.ServiceOption
+		indexerOpts         []metadata.PersistentIndexerOption
+	)
+
+	tokenizers, err := config.LoadAnalyzerConfig(confDir)
+	switch {
+	case err == nil:
+		metadataServiceOpts = append(metadataServiceOpts, metadata.WithMappings(tokenizers.Fields),
+			metadata.WithTokenizers(tokenizers.Named))
+		indexerOpts = append(indexerOpts, metadata.WithAnalysisMappings(tokenizers.Fields))
+	case serverConfig.Analyzer.Strict:
+		logger.Fatal("Error loading the analyzer config from ", confDir, ": ", err)
+	default:
+		logger.Warn("Error loading the analyzer config from ", confDir, ", falling back to the default analysis: ", err)
+	}
+
+	if storage := serverConfig.Storage; storage.Backend == config.StorageDisk {
+		indexerOpts = append(indexerOpts, metadata.WithSnapshotInterval(storage.SnapshotInterval),
+			metadata.WithSnapshotThreshold(storage.SnapshotThreshold), metadata.WithSyncWrites(storage.SyncWrites))
+		indexer, err := metadata.NewPersistentIndexer(storage.DataDir, logger, indexerOpts...)
+		if err != nil {
+			logger.Fatal("Error loading the metadata from ", storage.DataDir, ": ", err)
+		}
+		metadataServiceOpts = append(metadataServiceOpts, metadata.WithIndexer(indexer))
 	}
 
 	metadataService := metadata.NewService(logger, metadataServiceOpts...)
 
+	stopReloads := make(chan struct{})
+	defer close(stopReloads)
+	go reloadOnChanges(metadataService, serverConfig.Analyzer.ReloadInterval, fieldsState, stopReloads, logger)
+
 	router := mux.NewRouter()
 
-	middlewareChain := middleware.Chain(
+	middlewares := []mux.MiddlewareFunc{
 		middleware.PanicLoggerMiddleware(logger),
-		middleware.InstrumentingMiddleware("appmeta"))
+		middleware.InstrumentingMiddleware("appmeta"),
+	}
+	if limits := serverConfig.Limits; limits.MaxBodyBytes > 0 {
+		middlewares = append(middlewares, middleware.MaxBodyBytesMiddleware(limits.MaxBodyBytes))
+	}
+	middlewareChain := middleware.Chain(middlewares...)
 
 	router.Handle(base+"/stats", expvar.Handler())
 	metadataHandler := mhttp.MakeHttpHandler(base, router, middlewareChain, metadataService, logger)
 	router.Handle(base, metadataHandler)
 
-	httpServer := http.Server{Addr: serverAddr, Handler: router}
-	startAndWaitForShutdown(&httpServer, metadataService, logger)
+	// the auth and the in-flight limit wrap the whole router so that the stats are covered as well
+	var handler http.Handler = router
+	if limits := serverConfig.Limits; limits.MaxInFlightRequests > 0 {
+		handler = middleware.MaxInFlightMiddleware(limits.MaxInFlightRequests)(handler)
+	}
+	if auth := serverConfig.Auth; auth.Type == config.AuthToken {
+		handler = middleware.BearerTokenMiddleware(auth.Tokens, base+"/metadata/_health")(handler)
+	}
+
+	listen := serverConfig.Server
+	httpServer := http.Server{
+		Addr:           listen.Addr,
+		Handler:        handler,
+		ReadTimeout:    listen.Timeouts.Read,
+		WriteTimeout:   listen.Timeouts.Write,
+		IdleTimeout:    listen.Timeouts.Idle,
+		MaxHeaderBytes: serverConfig.Limits.MaxHeaderBytes,
+	}
+	startAndWaitForShutdown(&httpServer, listen, metadataService, logger)
+}
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// reloadOnChanges reloads the analyzer config on SIGHUP and whenever the files of the config directory change, the
+// service keeps serving with the current config while the metadata is reindexed. The custom fields are not reloaded,
+// a change of the fields.json (from the fieldsState of the startup) is logged as needing a restart.
+func reloadOnChanges(service metadata.Service, interval time.Duration, fieldsState string, stop chan struct{}, logger *logrus.Logger) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var changes <-chan struct{}
+	if interval > 0 {
+		changes = config.WatchConfigDir(confDir, interval, stop)
+	}
+
+	for {
+		select {
+		case <-hangup:
+		case <-changes:
+		case <-stop:
+			return
+		}
+		if config.FieldsState(confDir) != fieldsState {
+			logger.Warn("The custom fields of ", confDir, " changed, they are not reloaded and need a restart")
+		}
+		logger.Info("Reloading the analyzer config from ", confDir)
+		if err := service.Reload(context.Background(), config.AnalyzerLoader(confDir)); err != nil {
+			logger.Error("Error reloading the analyzer config, the previous config is still in use: ", err)
+		}
+	}
 }
 
-func startAndWaitForShutdown(httpServer *http.Server, service metadata.Service, logger *logrus.Logger) {
+func startAndWaitForShutdown(httpServer *http.Server, listen config.ListenConfig, service metadata.Service, logger *logrus.Logger) {
 
-	logger.Info("Starting http server at ", httpServer.Addr)
+	logger.Info("Starting http server at ", httpServer.Addr, ", tls ", listen.TLS.Enabled())
 
 	// stop channel for the signal handling
 	stop := make(chan os.Signal, 1)
@@ -80,17 +217,26 @@ func startAndWaitForShutdown(httpServer *http.Server, service metadata.Service,
 	// channel for reporting unusual server errors
 	errChannel := make(chan error, 1)
 	go func() {
-		if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		var err error
+		if listen.TLS.Enabled() {
+			err = httpServer.ListenAndServeTLS(listen.TLS.CertFile, listen.TLS.KeyFile)
+		} else {
+			err = httpServer.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
 			errChannel <- err
 		}
 	}()
 
 	select {
 	case <-stop:
-		ctx, cancelFn := context.WithTimeout(context.Background(), time.Duration(time.Second*10))
+		ctx, cancelFn := context.WithTimeout(context.Background(), listen.Timeouts.Shutdown)
 		defer cancelFn()
-		_ = service.Shutdown(ctx)
+		// Drain the in-flight requests before the service flushes its state
 		_ = httpServer.Shutdown(ctx)
+		if err := service.Shutdown(ctx); err != nil {
+			logger.Error("error shutting down the service, reason ", err)
+		}
 
 	case err := <-errChannel:
 		logger.Error("http server quit unexpectedly, reason", err)
@@ -17,6 +17,7 @@ require (
 	golang.org/x/lint v0.0.0-20190313153728-d0100b6bd8b3 // indirect
 	golang.org/x/net v0.0.0-20190318221613-d196dffd7c2b // indirect
 	golang.org/x/sys v0.0.0-20190318195719-6c81ef8f67ca // indirect
+	golang.org/x/text v0.3.0
 	golang.org/x/tools v0.0.0-20190318200714-bb1270c20edf // indirect
 	gopkg.in/yaml.v2 v2.2.2
 )
@@ -7,22 +7,28 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/vpoliboy/appmeta/pkg/metadata"
 	mconfig "github.com/vpoliboy/appmeta/pkg/metadata/config"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 const (
 	analyzerJson = "analyzer.json"
+	fieldsJson   = "fields.json"
 )
 
 var (
 	ErrNoAnalyzerFileExists  = errors.New("missing analyzer file")
 	ErrInvalidAnalyzerFormat = errors.New("invalid analyzer file format")
+	ErrInvalidFieldsFormat   = errors.New("invalid fields file format")
 )
 
-func LoadAnalyzerConfig(confDir string) (map[metadata.SearchField]metadata.Tokenizer, error) {
+// LoadAnalyzerConfig creates the tokenizers of the analyzer.json in the confDir, both by the name and by the search field.
+// The problems of a config that is well formed are reported as mconfig.ConfigErrors along with their JSON paths.
+func LoadAnalyzerConfig(confDir string) (*mconfig.Tokenizers, error) {
 
 	fileLocation := filepath.Join(confDir, analyzerJson)
 	if _, err := os.Stat(fileLocation); os.IsNotExist(err) {
@@ -35,10 +41,36 @@ func LoadAnalyzerConfig(confDir string) (map[metadata.SearchField]metadata.Token
 	}
 	defer f.Close()
 
-	analyzerConfig := &mconfig.AnalyzerConfig{}
-	err = json.NewDecoder(f).Decode(analyzerConfig)
+	// the unknown keys are most likely typos e.g. tokenizerConfigs, they are errors rather than ignored
+	analyzerConfig := &mconfig.AnalyzerConfig{ConfDir: confDir}
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(analyzerConfig); err != nil {
+		return nil, fmt.Errorf("%s %s: %s", ErrInvalidAnalyzerFormat, fileLocation, strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return mconfig.CreateTokenizers(analyzerConfig)
+}
+
+// LoadFieldsConfig creates the custom fields of the fields.json in the confDir, there are no custom fields when the
+// file does not exist. The problems of a config that is well formed are reported as mconfig.ConfigErrors along with
+// their JSON paths.
+func LoadFieldsConfig(confDir string) ([]*metadata.CustomField, error) {
+
+	fileLocation := filepath.Join(confDir, fieldsJson)
+	f, err := os.Open(fileLocation)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
 	if err != nil {
-		return nil, ErrInvalidAnalyzerFormat
+		return nil, err
+	}
+	defer f.Close()
+
+	fieldsConfig := &mconfig.FieldsConfig{}
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(fieldsConfig); err != nil {
+		return nil, fmt.Errorf("%s %s: %s", ErrInvalidFieldsFormat, fileLocation, strings.TrimPrefix(err.Error(), "json: "))
 	}
-	return mconfig.CreateFieldTokenizers(analyzerConfig)
+	return mconfig.CreateCustomFields(fieldsConfig)
 }
@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package config
+
+import (
+	"flag"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// ServerFlags are the command line flags of the server config, the flags that are explicitly set take precedence over
+// the environment and the server.yaml.
+type ServerFlags struct {
+	flags *flag.FlagSet
+
+	addr           string
+	debug          bool
+	dataDir        string
+	strictConfig   bool
+	reloadInterval time.Duration
+	logLevel       string
+	logFormat      string
+	tlsCertFile    string
+	tlsKeyFile     string
+}
+
+// NewServerFlags defines the flags of the server config on the flag set, see Apply.
+func NewServerFlags(flags *flag.FlagSet) *ServerFlags {
+	f := &ServerFlags{flags: flags}
+
+	flags.StringVar(&f.addr, "addr", ":8080", "http server address")
+	flags.BoolVar(&f.debug, "debug", false, "debug mode, same as -log-level=debug")
+	flags.StringVar(&f.dataDir, "data-dir", "", "directory to persist the metadata in with the disk storage backend, metadata is kept only in memory if empty")
+	flags.BoolVar(&f.strictConfig, "strict-config", false, "refuse to start on any analyzer config error instead of falling back to the default analysis")
+	flags.DurationVar(&f.reloadInterval, "reload-interval", 5*time.Second, "how often the config directory is checked for changes to reload, 0 disables the checks (SIGHUP still reloads)")
+	flags.StringVar(&f.logLevel, "log-level", "info", "log level, one of panic, fatal, error, warn, info, debug and trace")
+	flags.StringVar(&f.logFormat, "log-format", LogFormatText, "log format, either text or json")
+	flags.StringVar(&f.tlsCertFile, "tls-cert", "", "certificate file to serve https with, along with -tls-key")
+	flags.StringVar(&f.tlsKeyFile, "tls-key", "", "private key file to serve https with, along with -tls-cert")
+	return f
+}
+
+// Apply overrides the server config with the flags that are explicitly set once the flag set is parsed, the defaults
+// of the flags do not override the server.yaml nor the environment.
+func (f *ServerFlags) Apply(config *ServerConfig) {
+	f.flags.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "addr":
+			config.Server.Addr = f.addr
+		case "debug":
+			if f.debug {
+				config.Log.Level = logrus.DebugLevel.String()
+			}
+		case "data-dir":
+			config.Storage.DataDir = f.dataDir
+			if f.dataDir != "" {
+				config.Storage.Backend = StorageDisk
+			}
+		case "strict-config":
+			config.Analyzer.Strict = f.strictConfig
+		case "reload-interval":
+			config.Analyzer.ReloadInterval = f.reloadInterval
+		case "log-level":
+			config.Log.Level = f.logLevel
+		case "log-format":
+			config.Log.Format = f.logFormat
+		case "tls-cert":
+			config.Server.TLS.CertFile = f.tlsCertFile
+		case "tls-key":
+			config.Server.TLS.KeyFile = f.tlsKeyFile
+		}
+	})
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package config
+
+import (
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServerFlags_Apply(t *testing.T) {
+
+	confDir, err := ioutil.TempDir("", "appmeta")
+	assert.Nil(t, err)
+	defer os.RemoveAll(confDir)
+
+	serverYamlFile := []byte(`server:
+  addr: ":9090"
+log:
+  level: warn
+  format: json
+analyzer:
+  reloadInterval: 10s
+  strict: true
+`)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(confDir, serverYaml), serverYamlFile, 0644))
+
+	config, err := LoadServerConfig(confDir, []string{
+		"APPMETA_SERVER_ADDR=:7070",
+		"APPMETA_LOG_LEVEL=error",
+		"APPMETA_STORAGE_DATA_DIR=/var/lib/appmeta",
+	})
+	assert.Nil(t, err)
+
+	flags := flag.NewFlagSet("appmeta", flag.ContinueOnError)
+	serverFlags := NewServerFlags(flags)
+	assert.Nil(t, flags.Parse([]string{"-addr", ":8081", "-data-dir", "/data", "-strict-config=false"}))
+	serverFlags.Apply(config)
+
+	// flag > env > file, the flags that are not set (e.g. -log-format and -reload-interval) do not override with their
+	// defaults
+	expected := DefaultServerConfig()
+	expected.Server.Addr = ":8081"
+	expected.Log.Level = "error"
+	expected.Log.Format = LogFormatJson
+	expected.Storage.Backend = StorageDisk
+	expected.Storage.DataDir = "/data"
+	expected.Analyzer.ReloadInterval = 10 * time.Second
+	expected.Analyzer.Strict = false
+	assert.Equal(t, expected, config)
+
+	// -debug sets the log level, an explicit -log-level wins over it
+	flags = flag.NewFlagSet("appmeta", flag.ContinueOnError)
+	serverFlags = NewServerFlags(flags)
+	assert.Nil(t, flags.Parse([]string{"-debug"}))
+	serverFlags.Apply(config)
+	assert.Equal(t, "debug", config.Log.Level)
+
+	flags = flag.NewFlagSet("appmeta", flag.ContinueOnError)
+	serverFlags = NewServerFlags(flags)
+	assert.Nil(t, flags.Parse([]string{"-debug", "-log-level", "trace"}))
+	serverFlags.Apply(config)
+	assert.Equal(t, "trace", config.Log.Level)
+}
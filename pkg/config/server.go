@@ -0,0 +1,360 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	serverYaml = "server.yaml"
+
+	// EnvPrefix is the prefix of the environment variables that override the server config e.g. APPMETA_SERVER_ADDR
+	EnvPrefix = "APPMETA"
+
+	StorageMemory = "memory"
+	StorageDisk   = "disk"
+
+	AuthNone  = "none"
+	AuthToken = "token"
+
+	LogFormatText = "text"
+	LogFormatJson = "json"
+
+	redacted = "<redacted>"
+)
+
+var (
+	ErrInvalidServerFormat = errors.New("invalid server file format")
+	ErrInvalidServerConfig = errors.New("invalid server config")
+)
+
+// ServerConfig is the configuration of the server, the effective config is merged from the lowest to the highest
+// precedence:
+//    1. the defaults of DefaultServerConfig
+//    2. the server.yaml of the config directory, when it exists
+//    3. the APPMETA_* environment variables
+//    4. the command line flags that are explicitly set
+type ServerConfig struct {
+	Server   ListenConfig   `json:"server" yaml:"server"`
+	Log      LogConfig      `json:"log" yaml:"log"`
+	Storage  StorageConfig  `json:"storage" yaml:"storage"`
+	Analyzer AnalyzerConfig `json:"analyzer" yaml:"analyzer"`
+	Auth     AuthConfig     `json:"auth" yaml:"auth"`
+	Limits   LimitsConfig   `json:"limits" yaml:"limits"`
+}
+
+type ListenConfig struct {
+	Addr     string         `json:"addr" yaml:"addr"`
+	TLS      TLSConfig      `json:"tls" yaml:"tls"`
+	Timeouts TimeoutsConfig `json:"timeouts" yaml:"timeouts"`
+}
+
+// TLSConfig serves https when both the certificate and the key files are specified.
+type TLSConfig struct {
+	CertFile string `json:"certFile" yaml:"certFile"`
+	KeyFile  string `json:"keyFile" yaml:"keyFile"`
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// TimeoutsConfig are the timeouts of the http server, 0 means no timeout except for the shutdown which is the time the
+// in-flight requests are drained for.
+type TimeoutsConfig struct {
+	Read     time.Duration `json:"read" yaml:"read"`
+	Write    time.Duration `json:"write" yaml:"write"`
+	Idle     time.Duration `json:"idle" yaml:"idle"`
+	Shutdown time.Duration `json:"shutdown" yaml:"shutdown"`
+}
+
+type LogConfig struct {
+	Level  string `json:"level" yaml:"level"`
+	Format string `json:"format" yaml:"format"`
+}
+
+// StorageConfig selects where the metadata is kept, the disk backend persists the metadata in the DataDir with a
+// write-ahead log and snapshots (see metadata.NewPersistentIndexer).
+type StorageConfig struct {
+	Backend           string        `json:"backend" yaml:"backend"`
+	DataDir           string        `json:"dataDir" yaml:"dataDir"`
+	SnapshotInterval  time.Duration `json:"snapshotInterval" yaml:"snapshotInterval"`
+	SnapshotThreshold int           `json:"snapshotThreshold" yaml:"snapshotThreshold"`
+	SyncWrites        bool          `json:"syncWrites" yaml:"syncWrites"`
+}
+
+type AnalyzerConfig struct {
+	Strict         bool          `json:"strict" yaml:"strict"`
+	ReloadInterval time.Duration `json:"reloadInterval" yaml:"reloadInterval"`
+}
+
+// AuthConfig protects the API with the bearer tokens when the Type is token, the health endpoint is always open.
+type AuthConfig struct {
+	Type   string   `json:"type" yaml:"type"`
+	Tokens []string `json:"tokens" yaml:"tokens"`
+}
+
+// LimitsConfig are the limits of the http requests, 0 means no limit.
+type LimitsConfig struct {
+	MaxBodyBytes        int64 `json:"maxBodyBytes" yaml:"maxBodyBytes"`
+	MaxHeaderBytes      int   `json:"maxHeaderBytes" yaml:"maxHeaderBytes"`
+	MaxInFlightRequests int   `json:"maxInFlightRequests" yaml:"maxInFlightRequests"`
+}
+
+// DefaultServerConfig is the config of the server when neither a server.yaml, the environment variables nor the flags
+// override it.
+func DefaultServerConfig() *ServerConfig {
+	return &ServerConfig{
+		Server: ListenConfig{
+			Addr:     ":8080",
+			Timeouts: TimeoutsConfig{Read: 30 * time.Second, Write: 30 * time.Second, Idle: 2 * time.Minute, Shutdown: 10 * time.Second},
+		},
+		Log:      LogConfig{Level: logrus.InfoLevel.String(), Format: LogFormatText},
+		Storage:  StorageConfig{Backend: StorageMemory, SnapshotInterval: 5 * time.Minute, SnapshotThreshold: 10000},
+		Analyzer: AnalyzerConfig{ReloadInterval: 5 * time.Second},
+		Auth:     AuthConfig{Type: AuthNone},
+		Limits:   LimitsConfig{MaxBodyBytes: 1 << 20, MaxHeaderBytes: 1 << 20},
+	}
+}
+
+// LoadServerConfig merges the server.yaml of the confDir, when it exists, into the defaults and overrides the result
+// with the APPMETA_* variables of the environ (see os.Environ). The flags are applied by the caller before the config
+// is validated.
+func LoadServerConfig(confDir string, environ []string) (*ServerConfig, error) {
+
+	config := DefaultServerConfig()
+
+	fileLocation := filepath.Join(confDir, serverYaml)
+	data, err := ioutil.ReadFile(fileLocation)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		// the unknown keys are most likely typos e.g. timeout, they are errors rather than ignored
+		if err = yaml.UnmarshalStrict(data, config); err != nil {
+			return nil, fmt.Errorf("%s %s: %s", ErrInvalidServerFormat, fileLocation, strings.TrimPrefix(err.Error(), "yaml: "))
+		}
+	}
+
+	if err = config.applyEnv(environ); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// EnvVars returns the names of the environment variables of the config, in the order of the config. The name of a key
+// is its path in the upper snake case e.g. APPMETA_SERVER_TLS_CERT_FILE for server.tls.certFile.
+func (config *ServerConfig) EnvVars() []string {
+	var names []string
+	walkConfig(reflect.ValueOf(config).Elem(), EnvPrefix, func(name string, _ reflect.Value) {
+		names = append(names, name)
+	})
+	return names
+}
+
+// applyEnv overrides the keys of the config with the APPMETA_* variables of the environ, the list values are comma
+// separated and the durations are in the time.ParseDuration format e.g. 30s.
+func (config *ServerConfig) applyEnv(environ []string) error {
+	env := map[string]string{}
+	for _, kv := range environ {
+		if i := strings.IndexByte(kv, '='); i > 0 && strings.HasPrefix(kv, EnvPrefix+"_") {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+
+	var errs []string
+	walkConfig(reflect.ValueOf(config).Elem(), EnvPrefix, func(name string, field reflect.Value) {
+		value, ok := env[name]
+		if !ok {
+			return
+		}
+		if err := setValue(field, value); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", name, err))
+		}
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("%s: %s", ErrInvalidServerConfig, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Validate reports all the problems of the effective config at once, by the path of the key.
+func (config *ServerConfig) Validate() error {
+	var errs []string
+	add := func(path, format string, args ...interface{}) {
+		errs = append(errs, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if config.Server.Addr == "" {
+		add("server.addr", "is required")
+	}
+	if (config.Server.TLS.CertFile == "") != (config.Server.TLS.KeyFile == "") {
+		add("server.tls", "both certFile and keyFile are required")
+	}
+	for _, timeout := range []struct {
+		path     string
+		duration time.Duration
+	}{
+		{"server.timeouts.read", config.Server.Timeouts.Read},
+		{"server.timeouts.write", config.Server.Timeouts.Write},
+		{"server.timeouts.idle", config.Server.Timeouts.Idle},
+		{"server.timeouts.shutdown", config.Server.Timeouts.Shutdown},
+	} {
+		if timeout.duration < 0 {
+			add(timeout.path, "must not be negative")
+		}
+	}
+
+	if _, err := logrus.ParseLevel(config.Log.Level); err != nil {
+		add("log.level", "unknown level %q", config.Log.Level)
+	}
+	if config.Log.Format != LogFormatText && config.Log.Format != LogFormatJson {
+		add("log.format", "unknown format %q, has to be either %s or %s", config.Log.Format, LogFormatText, LogFormatJson)
+	}
+
+	switch config.Storage.Backend {
+	case StorageMemory:
+	case StorageDisk:
+		if config.Storage.DataDir == "" {
+			add("storage.dataDir", "is required by the %s backend", StorageDisk)
+		}
+		if config.Storage.SnapshotInterval <= 0 {
+			add("storage.snapshotInterval", "must be positive")
+		}
+		if config.Storage.SnapshotThreshold <= 0 {
+			add("storage.snapshotThreshold", "must be positive")
+		}
+	default:
+		add("storage.backend", "unknown backend %q, has to be either %s or %s", config.Storage.Backend, StorageMemory, StorageDisk)
+	}
+
+	switch config.Auth.Type {
+	case AuthNone:
+	case AuthToken:
+		if len(config.Auth.Tokens) == 0 {
+			add("auth.tokens", "at least one token is required by the %s auth", AuthToken)
+		}
+		for i, token := range config.Auth.Tokens {
+			if strings.TrimSpace(token) == "" {
+				add(fmt.Sprintf("auth.tokens[%d]", i), "must not be empty")
+			}
+		}
+	default:
+		add("auth.type", "unknown type %q, has to be either %s or %s", config.Auth.Type, AuthNone, AuthToken)
+	}
+
+	if config.Limits.MaxBodyBytes < 0 {
+		add("limits.maxBodyBytes", "must not be negative")
+	}
+	if config.Limits.MaxHeaderBytes < 0 {
+		add("limits.maxHeaderBytes", "must not be negative")
+	}
+	if config.Limits.MaxInFlightRequests < 0 {
+		add("limits.maxInFlightRequests", "must not be negative")
+	}
+
+	if config.Analyzer.ReloadInterval < 0 {
+		add("analyzer.reloadInterval", "must not be negative")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s: %s", ErrInvalidServerConfig, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Yaml returns the config as yaml with the auth tokens redacted, for the -print-config mode.
+func (config *ServerConfig) Yaml() ([]byte, error) {
+	printable := *config
+	printable.Auth.Tokens = make([]string, len(config.Auth.Tokens))
+	for i := range printable.Auth.Tokens {
+		printable.Auth.Tokens[i] = redacted
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	if err := encoder.Encode(&printable); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// walkConfig calls the fn with the environment variable name of each leaf key of the config struct.
+func walkConfig(v reflect.Value, prefix string, fn func(name string, field reflect.Value)) {
+	for i := 0; i < v.NumField(); i++ {
+		name := prefix + "_" + envName(strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0])
+		if field := v.Field(i); field.Kind() == reflect.Struct {
+			walkConfig(field, name, fn)
+		} else {
+			fn(name, field)
+		}
+	}
+}
+
+// envName converts a camel case key to the upper snake case e.g. maxBodyBytes to MAX_BODY_BYTES.
+func envName(key string) string {
+	var sb strings.Builder
+	for i, r := range key {
+		if i > 0 && unicode.IsUpper(r) {
+			sb.WriteByte('_')
+		}
+		sb.WriteRune(unicode.ToUpper(r))
+	}
+	return sb.String()
+}
+
+// setValue parses the value into the field by the kind of the field.
+func setValue(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Int || field.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		field.SetInt(n)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		var values []string
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadServerConfig(t *testing.T) {
+
+	confDir, err := ioutil.TempDir("", "appmeta")
+	assert.Nil(t, err)
+	defer os.RemoveAll(confDir)
+
+	// the defaults without a server.yaml
+	config, err := LoadServerConfig(confDir, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultServerConfig(), config)
+	assert.Nil(t, config.Validate())
+
+	serverYamlFile := []byte(`server:
+  addr: ":9090"
+  timeouts:
+    read: 10s
+log:
+  level: debug
+storage:
+  backend: disk
+  dataDir: /var/lib/appmeta
+auth:
+  type: token
+  tokens: [one, two]
+`)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(confDir, serverYaml), serverYamlFile, 0644))
+
+	// the environment takes precedence over the file, the unrelated variables are ignored
+	config, err = LoadServerConfig(confDir, []string{
+		"APPMETA_SERVER_ADDR=:7070",
+		"APPMETA_SERVER_TIMEOUTS_WRITE=1m",
+		"APPMETA_ANALYZER_STRICT=true",
+		"APPMETA_AUTH_TOKENS=three, four",
+		"APPMETA_LIMITS_MAX_IN_FLIGHT_REQUESTS=64",
+		"APPMETA_UNKNOWN=1",
+		"HOME=/root",
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, config.Validate())
+
+	expected := DefaultServerConfig()
+	expected.Server.Addr = ":7070"
+	expected.Server.Timeouts.Read = 10 * time.Second
+	expected.Server.Timeouts.Write = time.Minute
+	expected.Log.Level = "debug"
+	expected.Storage.Backend = StorageDisk
+	expected.Storage.DataDir = "/var/lib/appmeta"
+	expected.Analyzer.Strict = true
+	expected.Auth = AuthConfig{Type: AuthToken, Tokens: []string{"three", "four"}}
+	expected.Limits.MaxInFlightRequests = 64
+	assert.Equal(t, expected, config)
+
+	out, err := config.Yaml()
+	assert.Nil(t, err)
+	assert.Contains(t, string(out), "addr: :7070")
+	assert.Contains(t, string(out), "write: 1m0s")
+	assert.NotContains(t, string(out), "three")
+
+	_, err = LoadServerConfig(confDir, []string{"APPMETA_SERVER_TIMEOUTS_READ=soon", "APPMETA_LIMITS_MAX_BODY_BYTES=1kb"})
+	assert.EqualError(t, err, `invalid server config: APPMETA_SERVER_TIMEOUTS_READ: invalid duration "soon"; `+
+		`APPMETA_LIMITS_MAX_BODY_BYTES: invalid integer "1kb"`)
+
+	// the unknown keys are errors
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(confDir, serverYaml), []byte("server:\n  timeout: 10s\n"), 0644))
+	_, err = LoadServerConfig(confDir, nil)
+	if assert.NotNil(t, err) {
+		assert.True(t, strings.HasPrefix(err.Error(), ErrInvalidServerFormat.Error()))
+		assert.Contains(t, err.Error(), "field timeout not found")
+	}
+}
+
+func TestServerConfig_Validate(t *testing.T) {
+
+	config := DefaultServerConfig()
+	config.Server.Addr = ""
+	config.Server.TLS.CertFile = "cert.pem"
+	config.Server.Timeouts.Idle = -time.Second
+	config.Log = LogConfig{Level: "loud", Format: "xml"}
+	config.Storage.Backend = StorageDisk
+	config.Auth.Type = AuthToken
+	config.Limits.MaxBodyBytes = -1
+
+	assert.EqualError(t, config.Validate(), "invalid server config: "+strings.Join([]string{
+		"server.addr: is required",
+		"server.tls: both certFile and keyFile are required",
+		"server.timeouts.idle: must not be negative",
+		`log.level: unknown level "loud"`,
+		`log.format: unknown format "xml", has to be either text or json`,
+		"storage.dataDir: is required by the disk backend",
+		"auth.tokens: at least one token is required by the token auth",
+		"limits.maxBodyBytes: must not be negative",
+	}, "; "))
+}
+
+func TestServerConfig_EnvVars(t *testing.T) {
+
+	names := DefaultServerConfig().EnvVars()
+	assert.Contains(t, names, "APPMETA_SERVER_TLS_CERT_FILE")
+	assert.Contains(t, names, "APPMETA_STORAGE_SNAPSHOT_INTERVAL")
+	assert.Contains(t, names, "APPMETA_LIMITS_MAX_IN_FLIGHT_REQUESTS")
+	assert.Len(t, names, 21)
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/vpoliboy/appmeta/pkg/metadata"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AnalyzerLoader loads the tokenizers of the analyzer.json in the confDir on each call, for the reloads of the service.
+func AnalyzerLoader(confDir string) metadata.TokenizerLoader {
+	return func() (map[metadata.SearchField]metadata.Tokenizer, map[string]metadata.Tokenizer, error) {
+		tokenizers, err := LoadAnalyzerConfig(confDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		return tokenizers.Fields, tokenizers.Named, nil
+	}
+}
+
+// WatchConfigDir polls the files of the confDir every interval and signals on the returned channel when any of them is
+// added, removed or modified e.g. the analyzer.json or a synonyms file. The changes seen before the previous signal is
+// received are signalled once. The polling stops when the stop channel is closed.
+func WatchConfigDir(confDir string, interval time.Duration, stop <-chan struct{}) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := dirState(confDir)
+		for {
+			select {
+			case <-ticker.C:
+				current := dirState(confDir)
+				if current == last {
+					continue
+				}
+				last = current
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return changes
+}
+
+// dirState fingerprints the names, sizes and modification times of the regular files of the directory.
+func dirState(dir string) string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			fmt.Fprintf(&sb, "%s %d %d\n", info.Name(), info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return sb.String()
+}
+
+// FieldsState fingerprints the content of the fields.json in the confDir, empty when there is none. The custom fields
+// are loaded once at startup, the reloads compare the fingerprint to the one of the startup to tell that the fields
+// changed and need a restart.
+func FieldsState(confDir string) string {
+	content, err := ioutil.ReadFile(filepath.Join(confDir, fieldsJson))
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
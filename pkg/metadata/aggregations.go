@@ -0,0 +1,266 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/google/uuid"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultBucketCount = 10
+	MaxBucketCount     = 1000
+
+	IntervalMajor = "major"
+	IntervalMinor = "minor"
+
+	// versionHistogramAgg is the name of the semver histogram in the aggs query param
+	versionHistogramAgg = "version_histogram"
+
+	aggSizeSeparator = ":"
+)
+
+// Aggregation summarizes all the hits of a search, exactly one of the aggregations has to be set
+//    1. Terms buckets the hits by the indexed terms of the field, e.g. the number of the hits per license. The fields
+//       that index the whole values along with their parts (e.g. the versions) are bucketed by the whole values.
+//    2. SemverHistogram buckets the hits by the major or the major.minor of their versions.
+type Aggregation struct {
+	Terms           *TermsAggregation           `json:"terms,omitempty" yaml:"terms,omitempty"`
+	SemverHistogram *SemverHistogramAggregation `json:"semver_histogram,omitempty" yaml:"semver_histogram,omitempty"`
+}
+
+// TermsAggregation returns the Size (defaults to 10) buckets with the highest counts.
+type TermsAggregation struct {
+	Field SearchField `json:"field" yaml:"field"`
+	Size  int         `json:"size,omitempty" yaml:"size,omitempty"`
+}
+
+// SemverHistogramAggregation buckets the versions by the Interval, major (default) or minor.
+type SemverHistogramAggregation struct {
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty"`
+}
+
+// Bucket is the number of the hits that have the Key
+type Bucket struct {
+	Key   string `json:"key" yaml:"key"`
+	Count int    `json:"count" yaml:"count"`
+}
+
+// AggregationResult carries the buckets of an aggregation, Other is the sum of the counts of the buckets that did not
+// make it to the top Size buckets of a terms aggregation.
+type AggregationResult struct {
+	Buckets []Bucket `json:"buckets" yaml:"buckets"`
+	Other   int      `json:"other,omitempty" yaml:"other,omitempty"`
+}
+
+// ParseAggs parses the aggregations of the aggs query param, a comma separated list of field[:size] terms aggregations
+// named after the field and version_histogram[:major|minor] e.g. license,company:5,version_histogram:minor
+func ParseAggs(spec string) (map[string]*Aggregation, error) {
+	aggs := map[string]*Aggregation{}
+	for _, v := range strings.Split(spec, sortSeparator) {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		name, arg := v, ""
+		if i := strings.Index(v, aggSizeSeparator); i >= 0 {
+			name, arg = v[:i], v[i+1:]
+		}
+
+		if name == versionHistogramAgg {
+			aggs[name] = &Aggregation{SemverHistogram: &SemverHistogramAggregation{Interval: arg}}
+			continue
+		}
+
+		terms := &TermsAggregation{Field: SearchField(name)}
+		if arg != "" {
+			size, err := strconv.Atoi(arg)
+			if err != nil {
+				return nil, validation.NewInternalError(fmt.Errorf(" %s is not a valid size for the aggregation %s", arg, name))
+			}
+			terms.Size = size
+		}
+		aggs[name] = &Aggregation{Terms: terms}
+	}
+	return aggs, nil
+}
+
+func (a *Aggregation) Validate() error {
+	switch {
+	case a == nil || (a.Terms == nil) == (a.SemverHistogram == nil):
+		return validation.NewInternalError(fmt.Errorf(" aggregation has to be one of terms or semver_histogram"))
+	case a.Terms != nil:
+		if _, ok := currentFields().searchFields[a.Terms.Field]; !ok || a.Terms.Field == anyField {
+			return validation.NewInternalError(fmt.Errorf(" %s is not a valid aggregation field", a.Terms.Field))
+		}
+		if a.Terms.Size < 0 || a.Terms.Size > MaxBucketCount {
+			return validation.NewInternalError(fmt.Errorf(" aggregation size must be between 0 and %d", MaxBucketCount))
+		}
+	default:
+		switch a.SemverHistogram.Interval {
+		case "", IntervalMajor, IntervalMinor:
+		default:
+			return validation.NewInternalError(fmt.Errorf(" %s is not a valid interval, has to be major or minor", a.SemverHistogram.Interval))
+		}
+	}
+	return nil
+}
+
+// Aggregate computes the aggregations over the postings of the hits, nil hits aggregate all the metadata.
+func (repo *inMemoryIndexer) Aggregate(hits []*MetadataWithID, aggs map[string]*Aggregation) (map[string]*AggregationResult, error) {
+	repo.searchMutex.RLock()
+	defer repo.searchMutex.RUnlock()
+
+	var hitSet uuidSet
+	if hits != nil {
+		hitSet = make(uuidSet, len(hits))
+		for _, hit := range hits {
+			hitSet[hit.ID] = true
+		}
+	}
+
+	results := make(map[string]*AggregationResult, len(aggs))
+	for name, agg := range aggs {
+		if agg.Terms != nil {
+			results[name] = repo.termsAggregation(agg.Terms, hitSet)
+		} else {
+			results[name] = repo.semverHistogram(agg.SemverHistogram, hitSet)
+		}
+	}
+	return results, nil
+}
+
+// eachHit calls the fn with the ID of each hit, all the indexed metadata is visited for nil hits. Has to be called
+// with the searchMutex held.
+func (repo *inMemoryIndexer) eachHit(hits uuidSet, fn func(id uuid.UUID)) {
+	if hits == nil {
+		for id := range repo.uuid2Terms {
+			fn(id)
+		}
+		return
+	}
+	for id := range hits {
+		if _, ok := repo.uuid2Terms[id]; ok {
+			fn(id)
+		}
+	}
+}
+
+// aggregationTerms returns the distinct terms of the tokens of a field that the aggregations bucket by. A field that
+// is indexed with the keyword tokens along with their parts (e.g. the full version along with the major, the
+// major.minor and the prerelease, or the full name along with the words) is bucketed by the keyword tokens only, so
+// that a value is counted once.
+func aggregationTerms(tokens TokenStream) []string {
+	keywords := false
+	for _, token := range tokens {
+		if token.Type == TokenTypeKeyword {
+			keywords = true
+			break
+		}
+	}
+
+	var terms []string
+	seen := map[string]bool{}
+	for _, token := range tokens {
+		if (keywords && token.Type != TokenTypeKeyword) || seen[token.Term] {
+			continue
+		}
+		seen[token.Term] = true
+		terms = append(terms, token.Term)
+	}
+	return terms
+}
+
+func (repo *inMemoryIndexer) termsAggregation(agg *TermsAggregation, hits uuidSet) *AggregationResult {
+	size := agg.Size
+	if size == 0 {
+		size = DefaultBucketCount
+	}
+
+	counts := map[string]int{}
+	repo.eachHit(hits, func(id uuid.UUID) {
+		for _, term := range aggregationTerms(repo.uuid2Terms[id][agg.Field]) {
+			counts[term]++
+		}
+	})
+
+	buckets := make([]Bucket, 0, len(counts))
+	for term, count := range counts {
+		buckets = append(buckets, Bucket{Key: term, Count: count})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Count != buckets[j].Count {
+			return buckets[i].Count > buckets[j].Count
+		}
+		return buckets[i].Key < buckets[j].Key
+	})
+
+	result := &AggregationResult{Buckets: buckets}
+	if len(buckets) > size {
+		for _, bucket := range buckets[size:] {
+			result.Other += bucket.Count
+		}
+		result.Buckets = buckets[:size]
+	}
+	return result
+}
+
+// semverHistogram buckets the indexed versions by the interval, the versions that are not valid semvers are skipped.
+// The buckets are sorted by the version e.g. 1.x, 2.x or 1.0.x, 1.1.x
+func (repo *inMemoryIndexer) semverHistogram(agg *SemverHistogramAggregation, hits uuidSet) *AggregationResult {
+	type bucketVersion struct {
+		major, minor uint64
+	}
+
+	// the hits are collected per bucket, only the full versions are bucketed so that neither the partial versions nor
+	// a prerelease that looks like a version (e.g. 2.0.0-1.2.3) count a hit in another bucket
+	buckets := map[bucketVersion]uuidSet{}
+	repo.eachHit(hits, func(id uuid.UUID) {
+		for _, term := range aggregationTerms(repo.uuid2Terms[id][versionField]) {
+			v, ok := parseSemver(term)
+			if !ok {
+				continue
+			}
+			key := bucketVersion{major: v.major}
+			if agg.Interval == IntervalMinor {
+				key.minor = v.minor
+			}
+			if buckets[key] == nil {
+				buckets[key] = uuidSet{}
+			}
+			buckets[key][id] = true
+		}
+	})
+	counts := map[bucketVersion]int{}
+	for key, ids := range buckets {
+		counts[key] = len(ids)
+	}
+
+	keys := make([]bucketVersion, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].major != keys[j].major {
+			return keys[i].major < keys[j].major
+		}
+		return keys[i].minor < keys[j].minor
+	})
+
+	result := &AggregationResult{Buckets: make([]Bucket, 0, len(keys))}
+	for _, key := range keys {
+		label := fmt.Sprintf("%d.x", key.major)
+		if agg.Interval == IntervalMinor {
+			label = fmt.Sprintf("%d.%d.x", key.major, key.minor)
+		}
+		result.Buckets = append(result.Buckets, Bucket{Key: label, Count: counts[key]})
+	}
+	return result
+}
@@ -4,18 +4,24 @@
 
 package metadata
 
+// positionGap separates the positions of the values of a multi valued field, the same as the position_increment_gap of
+// Elasticsearch.
+const positionGap = 100
+
 var (
 	defaultSearchFieldTokenizerMapping = map[SearchField]Tokenizer{
-		// title and version fields are exact match search
-		titleField:   DefaultExactMatchTokenizer,
-		versionField: DefaultExactMatchTokenizer,
+		// title field is exact match search
+		titleField: DefaultExactMatchTokenizer,
+
+		// version is searchable by the major or the major.minor as well
+		versionField: DefaultSemverTokenizer,
 
 		// company fields and split around white spaces into tokens.
 		companyField: DefaultPerWordTokenizer,
 
-		// website and source (both URLs) are exact match fields
-		websiteField: DefaultExactMatchTokenizer,
-		sourceField:  DefaultExactMatchTokenizer,
+		// website and source (both URLs) are searchable by the host and the path prefixes as well
+		websiteField: DefaultURLTokenizer,
+		sourceField:  DefaultURLTokenizer,
 
 		// license is also exact match assuming they its an Identifier rather than the text
 		licenseField: DefaultExactMatchTokenizer,
@@ -26,8 +32,8 @@ var (
 		// Name is a special field that is both exactmatch and tokenized for searching on both first and last names.
 		nameField: TokenizerChain(DefaultPerWordTokenizer, DefaultExactMatchTokenizer),
 
-		// Email is exact match field
-		emailField: DefaultExactMatchTokenizer,
+		// Email is searchable by the local part and the domain as well
+		emailField: DefaultEmailTokenizer,
 	}
 )
 
@@ -39,41 +45,92 @@ type Analyzer struct {
 // For a given Metadata struct, Analyzer will
 //    1. break down each individual field into a list of tokens/terms based on the tokenizer configured for that field
 //    2. Creates the mapping from the fieldname to the list of tokens/terms for that field.
-func (a *Analyzer) AnalyzePayload(p *Metadata) map[SearchField][]string {
-
-	// TODO: make the tokenizer configurable.
-	tokens := map[SearchField][]string{
-		// title and version fields are exact match search
-		titleField:   a.tokenizerMapping[titleField].Tokenize(p.Title),
-		versionField: a.tokenizerMapping[versionField].Tokenize(p.Version),
+// The fields without a tokenizer (e.g. left out of the analyzer config) are exact match fields, unless they are custom
+// fields with a declared tokenizer. The values of the multi valued fields (e.g. the maintainer names) are positionGap
+// positions apart so that a phrase does not match across the values, the offsets of a token are within its own value.
+func (a *Analyzer) AnalyzePayload(p *Metadata) map[SearchField]TokenStream {
+	tokens := map[SearchField]TokenStream{
+		// title field is exact match search, version is searchable by the major or the major.minor as well
+		titleField:   a.AnalyzeFieldTokens(titleField, p.Title),
+		versionField: a.AnalyzeFieldTokens(versionField, p.Version),
 
 		// company fields and split around white spaces into tokens.
-		companyField: a.tokenizerMapping[companyField].Tokenize(p.Company),
+		companyField: a.AnalyzeFieldTokens(companyField, p.Company),
 
-		// website and source (both URLs) are exact match fields
-		websiteField: a.tokenizerMapping[websiteField].Tokenize(p.Website),
-		sourceField:  a.tokenizerMapping[sourceField].Tokenize(p.SourceURL),
+		// website and source (both URLs) are searchable by the host and the path prefixes as well
+		websiteField: a.AnalyzeFieldTokens(websiteField, p.Website),
+		sourceField:  a.AnalyzeFieldTokens(sourceField, p.SourceURL),
 
 		// license is also exact match assuming they its an Identifier rather than the text
-		licenseField: a.tokenizerMapping[licenseField].Tokenize(p.License),
+		licenseField: a.AnalyzeFieldTokens(licenseField, p.License),
 
 		// description is full text so word tokenizer.
-		descriptionField: a.tokenizerMapping[descriptionField].Tokenize(p.Description),
+		descriptionField: a.AnalyzeFieldTokens(descriptionField, p.Description),
 	}
 	for _, m := range p.Maintainers {
 		for k, v := range a.analyzeMaintainer(m) {
-			tokens[k] = append(tokens[k], v...)
+			tokens[k] = appendValue(tokens[k], v)
+		}
+	}
+
+	// the values of the custom fields, e.g. the tags, are analyzed one by one like the maintainers
+	for _, field := range currentFields().customFields {
+		for _, value := range field.stringValues(p) {
+			tokens[field.Name] = appendValue(tokens[field.Name], a.AnalyzeFieldTokens(field.Name, value))
 		}
 	}
 	return tokens
 }
 
-func (a *Analyzer) analyzeMaintainer(m Maintainer) map[SearchField][]string {
-	return map[SearchField][]string{
+func (a *Analyzer) analyzeMaintainer(m Maintainer) map[SearchField]TokenStream {
+	return map[SearchField]TokenStream{
 		// Name is a special field that is both exactmatch and tokenized for searching on both first and last names.
-		nameField: a.tokenizerMapping[nameField].Tokenize(m.Name),
+		nameField: a.AnalyzeFieldTokens(nameField, m.Name),
 
-		// Email is exact match field
-		emailField: a.tokenizerMapping[emailField].Tokenize(m.Email),
+		// Email is searchable by the local part and the domain as well
+		emailField: a.AnalyzeFieldTokens(emailField, m.Email),
+	}
+}
+
+// appendValue appends the tokens of a value of a multi valued field to the tokens of the previous values, positionGap
+// positions after them.
+func appendValue(tokens, value TokenStream) TokenStream {
+	if len(tokens) == 0 {
+		return append(tokens, value...)
+	}
+	base := tokens.nextPosition() + positionGap
+	for _, token := range value {
+		token.Position += base
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// AnalyzeField breaks down the given value into the terms using the tokenizer configured for the field, this makes sure
+// the search terms are analyzed the same way as the indexed terms. Fields without a tokenizer are exact match fields.
+func (a *Analyzer) AnalyzeField(field SearchField, value string) []string {
+	return a.tokenizer(field).Tokenize(value)
+}
+
+// AnalyzeFieldTokens is AnalyzeField with the rich tokens i.e. along with their positions, offsets and types.
+func (a *Analyzer) AnalyzeFieldTokens(field SearchField, value string) TokenStream {
+	return Tokens(a.tokenizer(field), value)
+}
+
+// AnalyzeQueryTokens analyzes a search value of the field, the same as AnalyzeFieldTokens unless the tokenizer of the
+// field analyzes the search values differently e.g. expands the synonyms only at the query time.
+func (a *Analyzer) AnalyzeQueryTokens(field SearchField, value string) TokenStream {
+	return QueryTokens(a.tokenizer(field), value)
+}
+
+// tokenizer returns the tokenizer of the field, a custom field falls back to its declared tokenizer and any other field
+// to the exact match.
+func (a *Analyzer) tokenizer(field SearchField) Tokenizer {
+	if tokenizer, ok := a.tokenizerMapping[field]; ok && tokenizer != nil {
+		return tokenizer
+	}
+	if custom, ok := currentFields().customFields[field]; ok && custom.Tokenizer != nil {
+		return custom.Tokenizer
 	}
+	return DefaultExactMatchTokenizer
 }
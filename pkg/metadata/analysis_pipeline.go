@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+type AnalysisPipelineOption func(p *analysisPipeline) bool
+
+// analysisPipeline is an Elasticsearch style analyzer, the input goes through
+//    1. the char filters, in order, that transform the text e.g. strip the HTML tags
+//    2. the tokenizer that breaks the filtered text into the tokens
+//    3. the token filters, in order, that transform the token stream e.g. lowercase or drop the stop words
+// The offsets of the tokens are mapped back through the char filters to the input, the tokens dropped by the token
+// filters (e.g. the stop words) leave a gap in the positions so that a phrase does not match across them. The search
+// values go through the token filters of the query phase and the indexed values through the ones of the index phase.
+type analysisPipeline struct {
+	charFilters  charFilterChain
+	tokenizer    Tokenizer
+	tokenFilters []TokenFilter
+}
+
+// NewAnalysisPipeline makes a Tokenizer of the tokenizer along with the char filters and the token filters.
+func NewAnalysisPipeline(tokenizer Tokenizer, options ...AnalysisPipelineOption) Tokenizer {
+	pipeline := &analysisPipeline{tokenizer: tokenizer}
+
+	for _, option := range options {
+		option(pipeline)
+	}
+	return pipeline
+}
+
+func WithCharFilters(filters ...CharFilter) AnalysisPipelineOption {
+	return func(p *analysisPipeline) bool {
+		p.charFilters = append(p.charFilters, filters...)
+		return true
+	}
+}
+
+func WithTokenFilters(filters ...TokenFilter) AnalysisPipelineOption {
+	return func(p *analysisPipeline) bool {
+		p.tokenFilters = append(p.tokenFilters, filters...)
+		return true
+	}
+}
+
+func (p *analysisPipeline) Tokenize(input string) []string {
+	return p.TokenStream(input).Terms()
+}
+
+func (p *analysisPipeline) TokenStream(input string) TokenStream {
+	return p.tokenStream(input, AnalysisPhaseIndex)
+}
+
+func (p *analysisPipeline) QueryTokenStream(input string) TokenStream {
+	return p.tokenStream(input, AnalysisPhaseQuery)
+}
+
+func (p *analysisPipeline) tokenStream(input string, phase AnalysisPhase) TokenStream {
+	filtered, spans := input, []ByteSpan(nil)
+	if len(p.charFilters) > 0 {
+		filtered, spans = p.charFilters.Filter(input)
+	}
+
+	var tokens TokenStream
+	if phase == AnalysisPhaseQuery {
+		tokens = QueryTokens(p.tokenizer, filtered)
+	} else {
+		tokens = Tokens(p.tokenizer, filtered)
+	}
+	if spans != nil {
+		for i, token := range tokens {
+			if token.hasOffsets() {
+				tokens[i].StartOffset, tokens[i].EndOffset = mapSpan(spans, len(input), token.StartOffset, token.EndOffset)
+			}
+		}
+	}
+
+	for _, filter := range p.tokenFilters {
+		if appliesIn(filter, phase) {
+			tokens = filter.Filter(tokens)
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestCharFilters(t *testing.T) {
+	replaceDash, err := NewPatternReplaceCharFilter(`(\w+)-(\w+)`, "${1}_$2")
+	assert.Nil(t, err)
+
+	_, err = NewPatternReplaceCharFilter(`(unclosed`, "")
+	assert.NotNil(t, err)
+
+	testCases := []struct {
+		name     string
+		filter   CharFilter
+		input    string
+		expected string
+	}{
+		{"htmlTags", HTMLStripCharFilter, "<p>Valid<br/>App</p>", " Valid App "},
+		{"htmlEntities", HTMLStripCharFilter, "Tom &amp; Jerry&#39;s &#x41;pp &bogus;", "Tom & Jerry's App &bogus;"},
+		{"htmlNotATag", HTMLStripCharFilter, "1 < 2 > 0", "1 < 2 > 0"},
+		{"markdownLink", MarkdownStripCharFilter, "see [the docs](https://appmeta.io) ![logo](logo.png)", "see the docs logo"},
+		{"markdownBlocks", MarkdownStripCharFilter, "# Title\n> quoted\n- item\n1. first", "Title\nquoted\nitem\nfirst"},
+		{"markdownEmphasis", MarkdownStripCharFilter, "**bold** `code` ~~gone~~ _em_ snake_case", "bold code gone em snake_case"},
+		{"nfkc", NFKCCharFilter, "ﬁle ＡＰＰ Jose\u0301 ①", "file APP José 1"},
+		{"patternReplace", replaceDash, "appmeta-server", "appmeta_server"},
+		{"chain", charFilterChain{HTMLStripCharFilter, MarkdownStripCharFilter}, "<b>**valid**</b> &amp; app", " valid  & app"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			filtered, spans := testCase.filter.Filter(testCase.input)
+			assert.Equal(t, testCase.expected, filtered)
+			assert.Len(t, spans, len(filtered))
+			for _, span := range spans {
+				assert.True(t, span.Start < span.End && span.End <= len(testCase.input))
+			}
+		})
+	}
+}
+
+func TestTokenFilters(t *testing.T) {
+	tokens := Tokens(DefaultWhitespaceTokenizer, "(José) Müller's CACHES libraries a José")
+
+	testCases := []struct {
+		name     string
+		filter   TokenFilter
+		expected []string
+	}{
+		{"lowercase", LowercaseTokenFilter, []string{"(josé)", "müller's", "caches", "libraries", "a", "josé"}},
+		{"stop", NewStopTokenFilter([]string{"a", "CACHES"}), []string{"(José)", "Müller's", "libraries", "José"}},
+		{"length", NewLengthTokenFilter(2, 6), []string{"(José)", "CACHES", "José"}},
+		{"trim", NewTrimTokenFilter("()"), []string{"José", "Müller's", "CACHES", "libraries", "a", "José"}},
+		{"unique", UniqueTokenFilter, []string{"(José)", "Müller's", "CACHES", "libraries", "a", "José"}},
+		{"asciiFolding", ASCIIFoldingTokenFilter, []string{"(Jose)", "Muller's", "CACHES", "libraries", "a", "Jose"}},
+		{"stemmer", NewStemmerTokenFilter(Stemmers[MinimalEnglishStemmer]), []string{"(José)", "Müller'", "CACHES", "library", "a", "José"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, testCase.filter.Filter(tokens).Terms())
+		})
+	}
+
+	// the trimmed tokens are narrowed to the term
+	trimmed := NewTrimTokenFilter("()").Filter(tokens)
+	assert.Equal(t, 1, trimmed[0].StartOffset)
+	assert.Equal(t, 6, trimmed[0].EndOffset)
+
+	// the letters that decompose into an ASCII letter and the combining marks fold as well
+	folded := ASCIIFoldingTokenFilter.Filter(Tokens(DefaultWhitespaceTokenizer, "Nguyễn Jose\u0301 Ørsted 日本"))
+	assert.Equal(t, []string{"Nguyen", "Jose", "Orsted", "日本"}, folded.Terms())
+
+	// the filters never modify the given stream
+	assert.Equal(t, "(José)", tokens[0].Term)
+}
+
+func TestMinimalEnglishStem(t *testing.T) {
+	testCases := map[string]string{
+		"apps":      "app",
+		"libraries": "library",
+		"caches":    "cache",
+		"status":    "status",
+		"class":     "class",
+		"keys":      "key",
+		"goes":      "goe",
+		"is":        "is",
+		"cache":     "cache",
+	}
+	for input, expected := range testCases {
+		assert.Equal(t, expected, minimalEnglishStem(input), input)
+	}
+}
+
+func TestAnalysisPipeline(t *testing.T) {
+	pipeline := NewAnalysisPipeline(DefaultWhitespaceTokenizer,
+		WithCharFilters(HTMLStripCharFilter, MarkdownStripCharFilter),
+		WithTokenFilters(
+			LowercaseTokenFilter,
+			NewTrimTokenFilter(",.!"),
+			NewStopTokenFilter([]string{"the", "and"}),
+			NewLengthTokenFilter(2, 0),
+			ASCIIFoldingTokenFilter,
+			NewStemmerTokenFilter(Stemmers[MinimalEnglishStemmer]),
+			UniqueTokenFilter,
+		))
+
+	input := "<p>The **Fast** caches &amp; Café <i>apps</i>, and the apps!</p>"
+	tokens := Tokens(pipeline, input)
+
+	assert.Equal(t, []string{"fast", "cache", "cafe", "app"}, tokens.Terms())
+	assert.Equal(t, []string{"fast", "cache", "cafe", "app"}, pipeline.Tokenize(input))
+	// the dropped tokens leave a gap in the positions
+	assert.Equal(t, []int{1, 2, 4, 5}, []int{tokens[0].Position, tokens[1].Position, tokens[2].Position, tokens[3].Position})
+
+	// the offsets point into the input before the char filters
+	expected := []string{"Fast", "caches", "Café", "apps"}
+	for i, token := range tokens {
+		assert.Equal(t, expected[i], input[token.StartOffset:token.EndOffset])
+	}
+
+	// a pipeline without the filters is the tokenizer
+	assert.Equal(t, Tokens(DefaultWhitespaceTokenizer, input), Tokens(NewAnalysisPipeline(DefaultWhitespaceTokenizer), input))
+}
+
+func TestEnglishStem(t *testing.T) {
+	// from the Porter2 sample vocabulary
+	testCases := map[string]string{
+		"caresses":      "caress",
+		"flies":         "fli",
+		"dies":          "die",
+		"denied":        "deni",
+		"agreed":        "agre",
+		"humbled":       "humbl",
+		"sized":         "size",
+		"meeting":       "meet",
+		"hoping":        "hope",
+		"plotted":       "plot",
+		"running":       "run",
+		"itemization":   "item",
+		"sensational":   "sensat",
+		"traditional":   "tradit",
+		"reference":     "refer",
+		"colonizer":     "colon",
+		"generously":    "generous",
+		"communication": "communic",
+		"hopeful":       "hope",
+		"happily":       "happili",
+		"knightly":      "knight",
+		"consign":       "consign",
+		"skies":         "sky",
+		"succeed":       "succeed",
+		"gas":           "gas",
+		"ties":          "tie",
+		"cries":         "cri",
+		"john's":        "john",
+		"by":            "by",
+	}
+	for input, expected := range testCases {
+		assert.Equal(t, expected, englishStem(input), input)
+	}
+}
+
+func TestParseSynonyms(t *testing.T) {
+	rules := `
+# comment
+k8s, Kubernetes
+pg, postgresql => postgres
+pg => pgsql
+`
+	synonyms, err := ParseSynonyms(strings.NewReader(rules), true)
+	assert.Nil(t, err)
+	assert.Equal(t, Synonyms{
+		"k8s":        {"k8s", "kubernetes"},
+		"kubernetes": {"k8s", "kubernetes"},
+		"pg":         {"postgres", "pgsql"},
+		"postgresql": {"postgres"},
+	}, synonyms)
+
+	synonyms, err = ParseSynonyms(strings.NewReader("kubernetes, k8s"), false)
+	assert.Nil(t, err)
+	assert.Equal(t, Synonyms{"kubernetes": {"kubernetes"}, "k8s": {"kubernetes"}}, synonyms)
+
+	for _, invalid := range []string{"a, , b", "a => b => c", "new york, nyc", " => b"} {
+		_, err := ParseSynonyms(strings.NewReader("ok, fine\n"+invalid), true)
+		if assert.NotNil(t, err, invalid) {
+			assert.Contains(t, err.Error(), "line 2", invalid)
+		}
+	}
+}
+
+func TestSynonymTokenFilter(t *testing.T) {
+	synonyms, err := ParseSynonyms(strings.NewReader("k8s, kubernetes\npg => postgres, postgresql"), true)
+	assert.Nil(t, err)
+
+	input := "k8s with pg"
+	tokens := NewSynonymTokenFilter(synonyms).Filter(Tokens(DefaultWhitespaceTokenizer, input))
+	assert.Equal(t, TokenStream{
+		{Term: "k8s", Position: 0, StartOffset: 0, EndOffset: 3, Type: TokenTypeWord},
+		{Term: "kubernetes", Position: 0, StartOffset: 0, EndOffset: 3, Type: TokenTypeSynonym},
+		{Term: "with", Position: 1, StartOffset: 4, EndOffset: 8, Type: TokenTypeWord},
+		{Term: "postgres", Position: 2, StartOffset: 9, EndOffset: 11, Type: TokenTypeSynonym},
+		{Term: "postgresql", Position: 2, StartOffset: 9, EndOffset: 11, Type: TokenTypeSynonym},
+	}, tokens)
+
+	assert.Equal(t, []string{"k8s", "kubernetes", "with", "postgres", "postgresql"}, tokens.Terms())
+}
+
+func TestAnalysisPipeline_Phases(t *testing.T) {
+	synonyms, err := ParseSynonyms(strings.NewReader("k8s, kubernetes"), true)
+	assert.Nil(t, err)
+
+	pipeline := NewAnalysisPipeline(DefaultWhitespaceTokenizer, WithTokenFilters(
+		LowercaseTokenFilter,
+		NewStopTokenFilter([]string{"on"}),
+		InPhase(NewSynonymTokenFilter(synonyms), AnalysisPhaseQuery),
+		NewStemmerTokenFilter(Stemmers[EnglishStemmer]),
+	))
+
+	assert.Equal(t, []string{"apps", "k8s"}, NewAnalysisPipeline(DefaultWhitespaceTokenizer).Tokenize("apps k8s"))
+	assert.Equal(t, []string{"app", "k8s"}, pipeline.Tokenize("Apps on K8s"))
+
+	tokens := QueryTokens(pipeline, "Apps on K8s")
+	assert.Equal(t, []string{"app", "k8s", "kubernet"}, tokens.Terms())
+	assert.Equal(t, []int{0, 2, 2}, []int{tokens[0].Position, tokens[1].Position, tokens[2].Position})
+
+	// the chains keep the stacked tokens stacked
+	chained := QueryTokens(TokenizerChain(pipeline, DefaultExactMatchTokenizer), "K8s")
+	assert.Equal(t, []string{"k8s", "kubernet", "k8s"}, chained.Terms())
+	assert.Equal(t, 1, chained[2].Position)
+}
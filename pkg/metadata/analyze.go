@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"sort"
+)
+
+var (
+	// builtinTokenizers are the tokenizers that can be analyzed with by the name of their type, along with the named
+	// tokenizers of the analyzer config.
+	builtinTokenizers = map[string]Tokenizer{
+		"exactmatch": DefaultExactMatchTokenizer,
+		"nop":        DefaultNopTokenizer,
+		"whitespace": DefaultWhitespaceTokenizer,
+		"standard":   DefaultPerWordTokenizer,
+		"url":        DefaultURLTokenizer,
+		"email":      DefaultEmailTokenizer,
+		"semver":     DefaultSemverTokenizer,
+	}
+)
+
+// AnalyzeRequest asks for the token stream of the Text as analyzed by either the tokenizer of the Field or the named
+// Tokenizer. The Phase is index by default, query analyzes the Text as a search value e.g. with the synonyms that are
+// only expanded at the query time.
+type AnalyzeRequest struct {
+	Field     SearchField   `json:"field,omitempty" yaml:"field,omitempty"`
+	Tokenizer string        `json:"tokenizer,omitempty" yaml:"tokenizer,omitempty"`
+	Phase     AnalysisPhase `json:"phase,omitempty" yaml:"phase,omitempty"`
+	Text      string        `json:"text" yaml:"text"`
+}
+
+func (r *AnalyzeRequest) Validate() error {
+	switch {
+	case r.Field == "" && r.Tokenizer == "":
+		return validation.NewInternalError(fmt.Errorf(" either field or tokenizer is required"))
+	case r.Field != "" && r.Tokenizer != "":
+		return validation.NewInternalError(fmt.Errorf(" field and tokenizer can not be used together"))
+	case r.Field != "" && (!currentFields().searchFields[r.Field] || r.Field == anyField):
+		return validation.NewInternalError(fmt.Errorf(" %s is not a valid analyze field", r.Field))
+	}
+	switch r.Phase {
+	case AnalysisPhaseAll, AnalysisPhaseIndex, AnalysisPhaseQuery:
+		return nil
+	}
+	return validation.NewInternalError(fmt.Errorf(" %s is not a valid phase, has to be either %s or %s", r.Phase,
+		AnalysisPhaseIndex, AnalysisPhaseQuery))
+}
+
+// AnalyzeResponse is the envelope of the token stream, the tokens of the tokenizers that do not track the offsets have
+// the offsets of -1.
+type AnalyzeResponse struct {
+	Tokens TokenStream `json:"tokens" yaml:"tokens"`
+}
+
+// BuiltinTokenizer returns the built-in tokenizer by the name of its type e.g. standard, the names are the ones the
+// custom fields and the analyze requests can refer to without an analyzer config.
+func BuiltinTokenizer(name string) (Tokenizer, bool) {
+	tokenizer, ok := builtinTokenizers[name]
+	return tokenizer, ok
+}
+
+// BuiltinTokenizerNames returns the sorted names of the built-in tokenizers.
+func BuiltinTokenizerNames() []string {
+	names := make([]string, 0, len(builtinTokenizers))
+	for name := range builtinTokenizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tokenizer returns the named tokenizer, the configured tokenizers take precedence over the built-in ones.
+func (svc *metadataSearchService) tokenizer(name string) (Tokenizer, error) {
+	if tokenizer, ok := svc.tokenizers[name]; ok {
+		return tokenizer, nil
+	}
+	if tokenizer, ok := builtinTokenizers[name]; ok {
+		return tokenizer, nil
+	}
+
+	names := make([]string, 0, len(svc.tokenizers)+len(builtinTokenizers))
+	for n := range svc.tokenizers {
+		names = append(names, n)
+	}
+	for n := range builtinTokenizers {
+		if _, ok := svc.tokenizers[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return nil, validation.NewInternalError(fmt.Errorf(" %s is not a valid tokenizer, has to be one of %v", name, names))
+}
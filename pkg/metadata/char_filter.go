@@ -0,0 +1,293 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// HTMLStripCharFilter replaces the HTML tags with a space and decodes the character entities e.g. &amp; and &#39;
+	HTMLStripCharFilter CharFilter = &regexCharFilter{
+		pattern: regexp.MustCompile(`<[A-Za-z/!][^>]*>|&(#[0-9]+|#[xX][0-9A-Fa-f]+|[A-Za-z]+);`),
+		replace: replaceHTML,
+	}
+
+	// MarkdownStripCharFilter removes the markdown syntax, the links and the images are replaced with their text
+	MarkdownStripCharFilter CharFilter = charFilterChain{
+		mustPatternReplace(`!?\[([^\]]*)\]\([^)]*\)`, "$1"),
+		mustPatternReplace(`(?m)^[ \t]*(?:#{1,6}|>|[-*+]|[0-9]+\.)[ \t]+`, ""),
+		mustPatternReplace("[*`~]+", ""),
+		mustPatternReplace(`(^|[^\pL\pN_])_{1,2}([^_\s](?:[^_]*[^_\s])?)_{1,2}([^\pL\pN_]|$)`, "$1$2$3"),
+	}
+
+	// NFKCCharFilter normalizes the text to the Unicode NFKC form so that the equivalent texts tokenize the same e.g. the
+	// composed and the decomposed é, the ligatures and the full width letters and digits
+	NFKCCharFilter CharFilter = nfkcCharFilter{}
+
+	htmlEntities = map[string]string{
+		"amp":  "&",
+		"lt":   "<",
+		"gt":   ">",
+		"quot": "\"",
+		"apos": "'",
+		"nbsp": " ",
+	}
+)
+
+// CharFilter transforms the input text before it is tokenized e.g. strips the markup. Along with the filtered text it
+// returns the span of the input each byte of the filtered text was produced from, so that the tokens can still be
+// mapped back to the input.
+type CharFilter interface {
+	Filter(input string) (string, []ByteSpan)
+}
+
+// ByteSpan is the [Start, End) byte range of a text.
+type ByteSpan struct {
+	Start int
+	End   int
+}
+
+// mapSpan maps the [start, end) bytes of a filtered text to the bytes of the text of the given length the spans point
+// into, a range past the filtered text maps to the end of the text.
+func mapSpan(spans []ByteSpan, length, start, end int) (int, int) {
+	if start >= len(spans) {
+		return length, length
+	}
+	from := spans[start].Start
+	if end <= start {
+		return from, from
+	}
+	if end > len(spans) {
+		end = len(spans)
+	}
+	return from, spans[end-1].End
+}
+
+// spanBuilder builds the filtered text of a char filter along with its spans.
+type spanBuilder struct {
+	sb    strings.Builder
+	spans []ByteSpan
+}
+
+// copy copies input[start:end] as is.
+func (b *spanBuilder) copy(input string, start, end int) {
+	b.sb.WriteString(input[start:end])
+	for i := start; i < end; i++ {
+		b.spans = append(b.spans, ByteSpan{Start: i, End: i + 1})
+	}
+}
+
+// replace writes the replacement of input[start:end], all the bytes of the replacement span the whole replaced text.
+func (b *spanBuilder) replace(replacement string, start, end int) {
+	b.sb.WriteString(replacement)
+	for range []byte(replacement) {
+		b.spans = append(b.spans, ByteSpan{Start: start, End: end})
+	}
+}
+
+func (b *spanBuilder) result() (string, []ByteSpan) {
+	return b.sb.String(), b.spans
+}
+
+type nfkcCharFilter struct {
+}
+
+// Filter normalizes the input one normalization segment, i.e. a starter and the combining marks that follow it, at a
+// time so that the bytes of a normalized segment span the segment of the input.
+func (nfkcCharFilter) Filter(input string) (string, []ByteSpan) {
+	b := &spanBuilder{spans: make([]ByteSpan, 0, len(input))}
+	if norm.NFKC.IsNormalString(input) {
+		b.copy(input, 0, len(input))
+		return b.result()
+	}
+
+	var (
+		it      norm.Iter
+		segment []byte
+		start   int
+	)
+	it.InitString(norm.NFKC, input)
+	for !it.Done() {
+		// a rune that expands into several starters e.g. ﬁ is returned in several segments
+		segment = append(segment, it.Next()...)
+		end := it.Pos()
+		if end == start {
+			continue
+		}
+		if string(segment) == input[start:end] {
+			b.copy(input, start, end)
+		} else {
+			b.replace(string(segment), start, end)
+		}
+		segment, start = segment[:0], end
+	}
+	return b.result()
+}
+
+// regexCharFilter replaces all the matches of the pattern, replace writes the replacement of a match given the
+// submatch indexes of the match.
+type regexCharFilter struct {
+	pattern *regexp.Regexp
+	replace func(b *spanBuilder, input string, match []int)
+}
+
+func (f *regexCharFilter) Filter(input string) (string, []ByteSpan) {
+	b := &spanBuilder{spans: make([]ByteSpan, 0, len(input))}
+	cursor := 0
+	for _, match := range f.pattern.FindAllStringSubmatchIndex(input, -1) {
+		b.copy(input, cursor, match[0])
+		f.replace(b, input, match)
+		cursor = match[1]
+	}
+	b.copy(input, cursor, len(input))
+	return b.result()
+}
+
+// NewPatternReplaceCharFilter replaces the matches of the regular expression with the replacement, the replacement
+// can refer to the submatches as $1 or ${name} like regexp.Expand. The text of the submatches keeps its offsets.
+func NewPatternReplaceCharFilter(pattern, replacement string) (CharFilter, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &regexCharFilter{
+		pattern: re,
+		replace: func(b *spanBuilder, input string, match []int) {
+			expandTemplate(b, re, replacement, input, match)
+		},
+	}, nil
+}
+
+func mustPatternReplace(pattern, replacement string) CharFilter {
+	filter, err := NewPatternReplaceCharFilter(pattern, replacement)
+	if err != nil {
+		panic(err)
+	}
+	return filter
+}
+
+// expandTemplate writes the template with the submatch references replaced by the submatches, the literal text of
+// the template maps to the whole match.
+func expandTemplate(b *spanBuilder, re *regexp.Regexp, template, input string, match []int) {
+	literalStart := 0
+	flush := func(end int) {
+		if end > literalStart {
+			b.replace(template[literalStart:end], match[0], match[1])
+		}
+	}
+
+	for i := 0; i < len(template); i++ {
+		if template[i] != '$' || i+1 == len(template) {
+			continue
+		}
+
+		var name string
+		next := i + 1
+		switch {
+		case template[next] == '$':
+			flush(i + 1)
+			literalStart = next + 1
+			i = next
+			continue
+		case template[next] == '{':
+			end := strings.IndexByte(template[next:], '}')
+			if end < 0 {
+				continue
+			}
+			name, next = template[next+1:next+end], next+end+1
+		default:
+			end := next
+			for end < len(template) && isTemplateNameByte(template[end]) {
+				end++
+			}
+			name, next = template[next:end], end
+		}
+		if name == "" {
+			continue
+		}
+
+		flush(i)
+		if group := submatchIndex(re, name); group >= 0 && match[2*group] >= 0 {
+			b.copy(input, match[2*group], match[2*group+1])
+		}
+		literalStart = next
+		i = next - 1
+	}
+	flush(len(template))
+}
+
+func isTemplateNameByte(c byte) bool {
+	return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// submatchIndex resolves a submatch reference by the number or the name, -1 if there is no such submatch.
+func submatchIndex(re *regexp.Regexp, name string) int {
+	if n, err := strconv.Atoi(name); err == nil {
+		if n > re.NumSubexp() {
+			return -1
+		}
+		return n
+	}
+	for i, subexpName := range re.SubexpNames() {
+		if subexpName == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// replaceHTML replaces a tag with a space so that the words around it are not joined and decodes an entity, the
+// unknown entities are kept as is.
+func replaceHTML(b *spanBuilder, input string, match []int) {
+	if input[match[0]] == '<' {
+		b.replace(" ", match[0], match[1])
+		return
+	}
+
+	entity := input[match[2]:match[3]]
+	if decoded, ok := htmlEntities[strings.ToLower(entity)]; ok {
+		b.replace(decoded, match[0], match[1])
+		return
+	}
+	if entity[0] == '#' {
+		base, digits := 10, entity[1:]
+		if digits[0] == 'x' || digits[0] == 'X' {
+			base, digits = 16, digits[1:]
+		}
+		if code, err := strconv.ParseInt(digits, base, 32); err == nil && code > 0 && code <= 0x10FFFF {
+			b.replace(string(rune(code)), match[0], match[1])
+			return
+		}
+	}
+	b.copy(input, match[0], match[1])
+}
+
+// charFilterChain applies the char filters in order, the spans of each filter are mapped through the spans of the
+// previous ones.
+type charFilterChain []CharFilter
+
+func (c charFilterChain) Filter(input string) (string, []ByteSpan) {
+	length := len(input)
+	var spans []ByteSpan
+	for _, filter := range c {
+		filtered, filteredSpans := filter.Filter(input)
+		if spans != nil {
+			for i, span := range filteredSpans {
+				filteredSpans[i].Start, filteredSpans[i].End = mapSpan(spans, length, span.Start, span.End)
+			}
+		}
+		input, spans = filtered, filteredSpans
+	}
+	if spans == nil {
+		b := &spanBuilder{}
+		b.copy(input, 0, len(input))
+		_, spans = b.result()
+	}
+	return input, spans
+}
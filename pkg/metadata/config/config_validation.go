@@ -0,0 +1,373 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/vpoliboy/appmeta/pkg/metadata"
+	"sort"
+	"strings"
+)
+
+const (
+	charFilterSection  = "charFilterConfig"
+	tokenFilterSection = "tokenFilterConfig"
+	tokenizerSection   = "tokenizerConfig"
+	fieldSection       = "fieldConfig"
+)
+
+var (
+	// charFilterTypes maps the char filter types to a new config of the type, nil for the types without a config
+	charFilterTypes = map[string]func() interface{}{
+		"html_strip":      nil,
+		"markdown_strip":  nil,
+		"nfkc":            nil,
+		"pattern_replace": func() interface{} { return &PatternReplaceCharFilterConfig{} },
+	}
+
+	// tokenFilterTypes maps the token filter types to a new config of the type, nil for the types without a config
+	tokenFilterTypes = map[string]func() interface{}{
+		"lowercase":     nil,
+		"unique":        nil,
+		"ascii_folding": nil,
+		"stop":          func() interface{} { return &StopTokenFilterConfig{} },
+		"length":        func() interface{} { return &LengthTokenFilterConfig{} },
+		"trim":          func() interface{} { return &TrimTokenFilterConfig{} },
+		"stemmer":       func() interface{} { return &StemmerTokenFilterConfig{} },
+		"synonym":       func() interface{} { return &SynonymsConfig{} },
+	}
+
+	// tokenizerTypes maps the tokenizer types to a new config of the type, nil for the types without a config
+	tokenizerTypes = map[string]func() interface{}{
+		"exactmatch": nil,
+		"nop":        nil,
+		"whitespace": nil,
+		"url":        nil,
+		"email":      nil,
+		"semver":     nil,
+		"standard":   func() interface{} { return &StandardTokenizerConfig{} },
+		"ngram":      func() interface{} { return &NGramTokenizerConfig{} },
+		"edge_ngram": func() interface{} { return &NGramTokenizerConfig{} },
+		"pattern":    func() interface{} { return &PatternTokenizerConfig{} },
+		"chain":      func() interface{} { return &ChainedTokenizerConfig{} },
+		"pipeline":   func() interface{} { return &PipelineTokenizerConfig{} },
+	}
+)
+
+// ConfigError is a problem of the analyzer config at the JSON Path e.g. tokenizerConfig[2].config.tokenizers[0], the
+// Name is the name of the offending char filter, token filter, tokenizer or field.
+type ConfigError struct {
+	Path   string
+	Name   string
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("%s: %s", e.Path, e.Reason)
+	}
+	return fmt.Sprintf("%s (%s): %s", e.Path, e.Name, e.Reason)
+}
+
+// ConfigErrors are all the problems of the analyzer config, in the order of the config.
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *ConfigErrors) add(path, name, format string, args ...interface{}) {
+	*e = append(*e, &ConfigError{Path: path, Name: name, Reason: fmt.Sprintf(format, args...)})
+}
+
+// reference is a reference to a component by the name at the path of the config.
+type reference struct {
+	path string
+	name string
+}
+
+// configValidator keeps the components of the config by the name along with the configs of the tokenizers.
+type configValidator struct {
+	config *AnalyzerConfig
+	errors ConfigErrors
+
+	charFilters  map[string]int
+	tokenFilters map[string]int
+	tokenizers   map[string]int
+
+	// configs of the tokenizers, nil for the invalid ones
+	tokenizerConfigs []interface{}
+}
+
+// Validate checks the config without creating any of the components, all the problems are reported at once as
+// ConfigErrors:
+//    1. every component has a unique name and one of the known types
+//    2. the configs of the components match the schema of their type, unknown keys included
+//    3. the chains and the pipelines only refer to the declared components and do not refer back to themselves, the
+//       components can be declared in any order
+//    4. the field config only maps the indexed fields to the declared tokenizers
+//    5. the gram sizes of the n-gram tokenizers are within MaxNGramSize and MaxNGramDiff
+func (config *AnalyzerConfig) Validate() error {
+	v := &configValidator{config: config}
+	v.charFilters = v.validateSection(charFilterSection, config.CharFilterConfigs, charFilterTypes, nil)
+	v.tokenFilters = v.validateSection(tokenFilterSection, config.TokenFilterConfigs, tokenFilterTypes, nil)
+	v.tokenizerConfigs = make([]interface{}, len(config.TokenizerConfigs))
+	v.tokenizers = v.validateSection(tokenizerSection, config.TokenizerConfigs, tokenizerTypes, v.tokenizerConfigs)
+
+	for i := range config.TokenizerConfigs {
+		v.validateReferences(i)
+		v.validateGrams(i)
+	}
+	v.validateCycles()
+	v.validateFields()
+
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+	return nil
+}
+
+// validateSection validates the names, the types and the configs of the components of the section, the decoded
+// configs are kept in the configs when given. Returns the index of the components by the name.
+func (v *configValidator) validateSection(section string, components []ComponentConfig, types map[string]func() interface{},
+	configs []interface{}) map[string]int {
+
+	names := map[string]int{}
+	for i, c := range components {
+		path := fmt.Sprintf("%s[%d]", section, i)
+		if c.Name == "" {
+			v.errors.add(path+".name", "", "name is required")
+		} else if j, ok := names[c.Name]; ok {
+			v.errors.add(path+".name", c.Name, "duplicate name, already declared at %s[%d]", section, j)
+		} else {
+			names[c.Name] = i
+		}
+
+		newConfig, ok := types[strings.ToLower(c.Type)]
+		if !ok {
+			v.errors.add(path+".type", c.Name, "unknown type %q, has to be one of %s", c.Type, typeNames(types))
+			continue
+		}
+		config, err := decodeConfig(c.Config, newConfig)
+		if err != nil {
+			v.errors.add(path+".config", c.Name, "%s", err)
+			continue
+		}
+		if configs != nil {
+			configs[i] = config
+		}
+	}
+	return names
+}
+
+// decodeConfig decodes the config of a type strictly i.e. the unknown keys are errors, a type without a config does not
+// take one.
+func decodeConfig(raw json.RawMessage, newConfig func() interface{}) (interface{}, error) {
+	trimmed := string(bytes.TrimSpace(raw))
+	empty := trimmed == "" || trimmed == "null"
+	switch {
+	case newConfig == nil && !empty && trimmed != "{}":
+		return nil, fmt.Errorf("the type does not take a config")
+	case newConfig == nil:
+		return nil, nil
+	case empty:
+		return nil, fmt.Errorf("config is required")
+	}
+
+	config := newConfig()
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("%s", strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return config, nil
+}
+
+// references returns the tokenizers the chain or the pipeline tokenizer i refers to.
+func (v *configValidator) references(i int) []reference {
+	path := fmt.Sprintf("%s[%d].config", tokenizerSection, i)
+	switch config := v.tokenizerConfigs[i].(type) {
+	case *ChainedTokenizerConfig:
+		refs := make([]reference, 0, len(config.TokenizerNames))
+		for j, name := range config.TokenizerNames {
+			refs = append(refs, reference{path: fmt.Sprintf("%s.tokenizers[%d]", path, j), name: name})
+		}
+		return refs
+	case *PipelineTokenizerConfig:
+		return []reference{{path: path + ".tokenizer", name: config.TokenizerName}}
+	}
+	return nil
+}
+
+func (v *configValidator) validateReferences(i int) {
+	c := v.config.TokenizerConfigs[i]
+	path := fmt.Sprintf("%s[%d].config", tokenizerSection, i)
+
+	switch config := v.tokenizerConfigs[i].(type) {
+	case *ChainedTokenizerConfig:
+		if len(config.TokenizerNames) == 0 {
+			v.errors.add(path+".tokenizers", c.Name, "at least one tokenizer is required")
+		}
+	case *PipelineTokenizerConfig:
+		if config.TokenizerName == "" {
+			v.errors.add(path+".tokenizer", c.Name, "tokenizer is required")
+		}
+		for j, name := range config.CharFilterNames {
+			if _, ok := v.charFilters[name]; !ok {
+				v.errors.add(fmt.Sprintf("%s.charFilters[%d]", path, j), c.Name, "unknown char filter %q", name)
+			}
+		}
+		for j, name := range config.TokenFilterNames {
+			if _, ok := v.tokenFilters[name]; !ok {
+				v.errors.add(fmt.Sprintf("%s.tokenFilters[%d]", path, j), c.Name, "unknown token filter %q", name)
+			}
+		}
+	}
+	for _, ref := range v.references(i) {
+		if _, ok := v.tokenizers[ref.name]; !ok && ref.name != "" {
+			v.errors.add(ref.path, c.Name, "unknown tokenizer %q", ref.name)
+		}
+	}
+}
+
+// validateGrams checks the gram sizes of the n-gram tokenizer i, the spread of the edge n-grams is not capped as they
+// emit a single gram per size of each word.
+func (v *configValidator) validateGrams(i int) {
+	config, ok := v.tokenizerConfigs[i].(*NGramTokenizerConfig)
+	if !ok {
+		return
+	}
+	c := v.config.TokenizerConfigs[i]
+	path := fmt.Sprintf("%s[%d].config", tokenizerSection, i)
+
+	switch {
+	case config.MinGram < 1:
+		v.errors.add(path+".minGram", c.Name, "minGram must be positive")
+	case config.MaxGram < config.MinGram:
+		v.errors.add(path+".maxGram", c.Name, "maxGram %d is less than minGram %d", config.MaxGram, config.MinGram)
+	case config.MaxGram > MaxNGramSize:
+		v.errors.add(path+".maxGram", c.Name, "maxGram %d is greater than %d", config.MaxGram, MaxNGramSize)
+	case strings.ToLower(c.Type) == "ngram" && config.MaxGram-config.MinGram > MaxNGramDiff:
+		v.errors.add(path+".maxGram", c.Name, "maxGram - minGram is %d, the difference must be at most %d",
+			config.MaxGram-config.MinGram, MaxNGramDiff)
+	}
+}
+
+// validateCycles reports the references that close a cycle of the tokenizers e.g. A -> B -> A.
+func (v *configValidator) validateCycles() {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(v.config.TokenizerConfigs))
+
+	var (
+		stack []string
+		visit func(i int)
+	)
+	visit = func(i int) {
+		state[i] = visiting
+		stack = append(stack, v.config.TokenizerConfigs[i].Name)
+		for _, ref := range v.references(i) {
+			j, ok := v.tokenizers[ref.name]
+			if !ok {
+				continue
+			}
+			switch state[j] {
+			case visiting:
+				cycle := append([]string{}, stack...)
+				for len(cycle) > 0 && cycle[0] != ref.name {
+					cycle = cycle[1:]
+				}
+				v.errors.add(ref.path, v.config.TokenizerConfigs[i].Name, "cyclic reference %s",
+					strings.Join(append(cycle, ref.name), " -> "))
+			case unvisited:
+				visit(j)
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[i] = visited
+	}
+	for i := range v.config.TokenizerConfigs {
+		if state[i] == unvisited {
+			visit(i)
+		}
+	}
+}
+
+func (v *configValidator) validateFields() {
+	indexed := map[metadata.SearchField]bool{}
+	for _, field := range metadata.IndexedFields() {
+		indexed[field] = true
+	}
+
+	fields := make([]string, 0, len(v.config.FieldConfig))
+	for field := range v.config.FieldConfig {
+		fields = append(fields, string(field))
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		path := fieldSection + "." + field
+		if !indexed[metadata.SearchField(field)] {
+			v.errors.add(path, field, "unknown field, has to be one of %v", metadata.IndexedFields())
+			continue
+		}
+		name := v.config.FieldConfig[metadata.SearchField(field)]
+		if _, ok := v.tokenizers[name]; !ok {
+			v.errors.add(path, field, "unknown tokenizer %q", name)
+		}
+	}
+}
+
+// tokenizerOrder returns the indexes of the tokenizers ordered so that a tokenizer comes after the tokenizers it refers
+// to, the config has to be valid.
+func (config *AnalyzerConfig) tokenizerOrder() []int {
+	v := &configValidator{config: config, tokenizers: map[string]int{}}
+	v.tokenizerConfigs = make([]interface{}, len(config.TokenizerConfigs))
+	for i, c := range config.TokenizerConfigs {
+		v.tokenizers[c.Name] = i
+		if newConfig := tokenizerTypes[strings.ToLower(c.Type)]; newConfig != nil {
+			v.tokenizerConfigs[i], _ = decodeConfig(c.Config, newConfig)
+		}
+	}
+
+	var (
+		order   []int
+		visited = make([]bool, len(config.TokenizerConfigs))
+		visit   func(i int)
+	)
+	visit = func(i int) {
+		visited[i] = true
+		for _, ref := range v.references(i) {
+			if j, ok := v.tokenizers[ref.name]; ok && !visited[j] {
+				visit(j)
+			}
+		}
+		order = append(order, i)
+	}
+	for i := range config.TokenizerConfigs {
+		if !visited[i] {
+			visit(i)
+		}
+	}
+	return order
+}
+
+func typeNames(types map[string]func() interface{}) string {
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package config
+
+import (
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/vpoliboy/appmeta/pkg/metadata"
+	"regexp"
+	"strings"
+)
+
+const (
+	customFieldSection = "fields"
+
+	FormatURL    = "url"
+	FormatEmail  = "email"
+	FormatSemver = "semver"
+)
+
+var (
+	// formatRules are the rules of the formats a string field can be validated against
+	formatRules = map[string]validation.Rule{
+		FormatURL:    is.URL.Error("not an URL"),
+		FormatEmail:  is.Email.Error("invalid email format"),
+		FormatSemver: is.Semver.Error("not in SemVer format"),
+	}
+)
+
+// FieldsConfig declares the custom fields of the metadata, on top of the fixed ones.
+type FieldsConfig struct {
+	Fields []CustomFieldConfig `json:"fields"`
+}
+
+// CustomFieldConfig declares a custom field of the Type (string, number, boolean or list) by the Name. The values of
+// the field are analyzed with the built-in Tokenizer (exactmatch by default) unless the field is mapped to a tokenizer
+// in the fieldConfig of the analyzer config.
+type CustomFieldConfig struct {
+	Name       string                 `json:"name"`
+	Type       string                 `json:"type"`
+	Required   bool                   `json:"required,omitempty"`
+	Tokenizer  string                 `json:"tokenizer,omitempty"`
+	Validation *FieldValidationConfig `json:"validation,omitempty"`
+}
+
+// FieldValidationConfig is the validation rule of a custom field, the Pattern, the Values, the lengths and the Format
+// apply to the string and the list fields (to each string of a list) and the Min and the Max to the number fields.
+type FieldValidationConfig struct {
+	Pattern   string   `json:"pattern,omitempty"`
+	Values    []string `json:"values,omitempty"`
+	MinLength *int     `json:"minLength,omitempty"`
+	MaxLength *int     `json:"maxLength,omitempty"`
+	Format    string   `json:"format,omitempty"`
+	Min       *float64 `json:"min,omitempty"`
+	Max       *float64 `json:"max,omitempty"`
+}
+
+// CreateCustomFields creates the custom fields of the config, all the problems of the config are reported at once as
+// ConfigErrors along with their JSON paths e.g. fields[1].validation.pattern.
+func CreateCustomFields(config *FieldsConfig) ([]*metadata.CustomField, error) {
+	var (
+		errs   ConfigErrors
+		fields []*metadata.CustomField
+		names  = map[string]int{}
+	)
+
+	for i, c := range config.Fields {
+		path := fmt.Sprintf("%s[%d]", customFieldSection, i)
+		field := &metadata.CustomField{Name: metadata.SearchField(c.Name), Type: metadata.FieldType(c.Type), Required: c.Required}
+
+		if c.Name == "" {
+			errs.add(path+".name", "", "name is required")
+		} else if j, ok := names[c.Name]; ok {
+			errs.add(path+".name", c.Name, "duplicate name, already declared at %s[%d]", customFieldSection, j)
+		} else {
+			names[c.Name] = i
+		}
+
+		switch field.Type {
+		case metadata.FieldTypeString, metadata.FieldTypeNumber, metadata.FieldTypeBoolean, metadata.FieldTypeList:
+		default:
+			errs.add(path+".type", c.Name, "unknown type %q, has to be one of %s, %s, %s or %s", c.Type,
+				metadata.FieldTypeBoolean, metadata.FieldTypeList, metadata.FieldTypeNumber, metadata.FieldTypeString)
+		}
+
+		if c.Tokenizer != "" {
+			tokenizer, ok := metadata.BuiltinTokenizer(c.Tokenizer)
+			if !ok {
+				errs.add(path+".tokenizer", c.Name, "unknown tokenizer %q, has to be one of %s", c.Tokenizer,
+					strings.Join(metadata.BuiltinTokenizerNames(), ", "))
+			}
+			field.Tokenizer = tokenizer
+		}
+
+		if c.Validation != nil {
+			field.Rules = fieldRules(path+".validation", c.Name, field.Type, c.Validation, &errs)
+		}
+		fields = append(fields, field)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return fields, nil
+}
+
+// fieldRules converts the validation config of a field of the type to the rules, the problems are added to the errs.
+func fieldRules(path, name string, fieldType metadata.FieldType, config *FieldValidationConfig, errs *ConfigErrors) []validation.Rule {
+	var rules []validation.Rule
+
+	strs := fieldType == metadata.FieldTypeString || fieldType == metadata.FieldTypeList
+	notApplicable := func(key string, set bool) bool {
+		if set {
+			errs.add(path+"."+key, name, "does not apply to the %s fields", fieldType)
+		}
+		return set
+	}
+
+	if config.Pattern != "" && !notApplicable("pattern", !strs) {
+		re, err := regexp.Compile(config.Pattern)
+		if err != nil {
+			errs.add(path+".pattern", name, "%s", err)
+		} else {
+			rules = append(rules, validation.Match(re).Error("must match regex: "+config.Pattern))
+		}
+	}
+
+	if len(config.Values) > 0 && !notApplicable("values", !strs) {
+		values := make([]interface{}, 0, len(config.Values))
+		for _, v := range config.Values {
+			values = append(values, v)
+		}
+		rules = append(rules, validation.In(values...).Error("must be one of "+strings.Join(config.Values, ", ")))
+	}
+
+	if (config.MinLength != nil || config.MaxLength != nil) && !notApplicable("minLength", !strs) {
+		min, max := 0, 0
+		if config.MinLength != nil {
+			min = *config.MinLength
+		}
+		if config.MaxLength != nil {
+			max = *config.MaxLength
+		}
+		switch {
+		case min < 0 || max < 0:
+			errs.add(path+".minLength", name, "lengths must not be negative")
+		case config.MaxLength != nil && max == 0:
+			errs.add(path+".maxLength", name, "maxLength must be positive")
+		case config.MaxLength != nil && min > max:
+			errs.add(path+".minLength", name, "minLength %d is greater than maxLength %d", min, max)
+		default:
+			// the max length of 0 is no max length for the rule
+			rules = append(rules, validation.RuneLength(min, max).Error(lengthMessage(config.MinLength, config.MaxLength)))
+		}
+	}
+
+	if config.Format != "" && !notApplicable("format", !strs) {
+		rule, ok := formatRules[strings.ToLower(config.Format)]
+		if !ok {
+			errs.add(path+".format", name, "unknown format %q, has to be one of %s, %s or %s", config.Format,
+				FormatEmail, FormatSemver, FormatURL)
+		} else {
+			rules = append(rules, rule)
+		}
+	}
+
+	// the ozzo thresholds skip the zero values, a number of 0 is a value of the field
+	numbers := fieldType == metadata.FieldTypeNumber
+	if config.Min != nil && !notApplicable("min", !numbers) {
+		min := *config.Min
+		rules = append(rules, validation.By(func(value interface{}) error {
+			if n, ok := value.(float64); ok && n < min {
+				return fmt.Errorf("must be no less than %v", min)
+			}
+			return nil
+		}))
+	}
+	if config.Max != nil && !notApplicable("max", !numbers) {
+		max := *config.Max
+		rules = append(rules, validation.By(func(value interface{}) error {
+			if n, ok := value.(float64); ok && n > max {
+				return fmt.Errorf("must be no greater than %v", max)
+			}
+			return nil
+		}))
+	}
+	if config.Min != nil && config.Max != nil && numbers && *config.Min > *config.Max {
+		errs.add(path+".min", name, "min %v is greater than max %v", *config.Min, *config.Max)
+	}
+	return rules
+}
+
+func lengthMessage(min, max *int) string {
+	switch {
+	case min != nil && max != nil:
+		return fmt.Sprintf("length must be between %d and %d characters", *min, *max)
+	case min != nil:
+		return fmt.Sprintf("length must be at least %d characters", *min)
+	}
+	return fmt.Sprintf("length must be at most %d characters", *max)
+}
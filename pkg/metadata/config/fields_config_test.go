@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/vpoliboy/appmeta/pkg/metadata"
+	"testing"
+)
+
+func TestCreateCustomFields(t *testing.T) {
+	defer metadata.SetCustomFields()
+
+	config := &FieldsConfig{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"fields": [
+		{"name": "category", "type": "string", "required": true, "validation": {"values": ["database", "monitoring"]}},
+		{"name": "tags", "type": "list", "tokenizer": "standard", "validation": {"pattern": "^[a-z ]+$", "maxLength": 16}},
+		{"name": "supportTier", "type": "number", "validation": {"min": 1, "max": 3}},
+		{"name": "homepage", "type": "string", "validation": {"format": "url"}}
+	]}`), config))
+
+	fields, err := CreateCustomFields(config)
+	assert.Nil(t, err)
+	assert.Len(t, fields, 4)
+	assert.Nil(t, metadata.SetCustomFields(fields...))
+
+	testCases := map[string]string{
+		`{"category": "database", "tags": ["fast sql"], "supportTier": 1, "homepage": "https://upbound.io"}`: "",
+		`{"tags": ["sql"]}`:                                       "fields: (category: cannot be blank.).",
+		`{"category": "storage"}`:                                 "fields: (category: must be one of database, monitoring.).",
+		`{"category": "database", "tags": ["SQL"]}`:               "fields: (tags: must match regex: ^[a-z ]+$.).",
+		`{"category": "database", "tags": ["a very long tag"]}`:   "",
+		`{"category": "database", "tags": ["a much longer tag"]}`: "fields: (tags: length must be at most 16 characters.).",
+		`{"category": "database", "supportTier": 0}`:              "fields: (supportTier: must be no less than 1.).",
+		`{"category": "database", "homepage": "upbound"}`:         "fields: (homepage: not an URL.).",
+	}
+	for fieldValues, expected := range testCases {
+		m := &metadata.Metadata{Title: "appmeta", Version: "1.0.0", Maintainers: []metadata.Maintainer{{Name: "Vijay Poliboyina", Email: "vijay@hotmail.com"}},
+			Company: "Upbound Inc.", Website: "https://upbound.io", SourceURL: "https://github.com/upbound/repo", License: "Apache-2.0",
+			Description: "A valid app"}
+		assert.Nil(t, json.Unmarshal([]byte(fieldValues), &m.Fields))
+		err := m.Validate()
+		if expected == "" {
+			assert.Nil(t, err, fieldValues)
+		} else if assert.NotNil(t, err, fieldValues) {
+			assert.Equal(t, expected, err.Error(), fieldValues)
+		}
+	}
+
+	// the custom fields can be mapped to the tokenizers of the analyzer config
+	a := &AnalyzerConfig{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"tokenizerConfig": [{"name": "W", "type": "Whitespace"}], "fieldConfig": {"tags": "W"}}`), a))
+	tokenizers, err := CreateTokenizers(a)
+	assert.Nil(t, err)
+	assert.NotNil(t, tokenizers.Fields["tags"])
+}
+
+func TestCreateCustomFields_Invalid(t *testing.T) {
+	testCases := map[string]string{
+		`{"fields": [{"type": "string"}]}`:                                                 `fields[0].name: name is required`,
+		`{"fields": [{"name": "tags", "type": "list"}, {"name": "tags", "type": "list"}]}`: `fields[1].name (tags): duplicate name, already declared at fields[0]`,
+		`{"fields": [{"name": "tags", "type": "array"}]}`:                                  `fields[0].type (tags): unknown type "array", has to be one of boolean, list, number or string`,
+		`{"fields": [{"name": "tags", "type": "list", "tokenizer": "words"}]}`: `fields[0].tokenizer (tags): unknown tokenizer "words", has to be one of ` +
+			`email, exactmatch, nop, semver, standard, url, whitespace`,
+		`{"fields": [{"name": "tier", "type": "number", "validation": {"pattern": "^[0-9]$", "min": 3, "max": 1}}]}`: `fields[0].validation.pattern (tier): does not apply to the number fields; ` +
+			`fields[0].validation.min (tier): min 3 is greater than max 1`,
+		`{"fields": [{"name": "tags", "type": "list", "validation": {"pattern": "[", "format": "uuid", "max": 2}}]}`: "fields[0].validation.pattern (tags): error parsing regexp: missing closing ]: `[`; " +
+			`fields[0].validation.format (tags): unknown format "uuid", has to be one of email, semver or url; ` +
+			`fields[0].validation.max (tags): does not apply to the list fields`,
+		`{"fields": [{"name": "tags", "type": "list", "validation": {"minLength": 4, "maxLength": 2}}]}`: `fields[0].validation.minLength (tags): minLength 4 is greater than maxLength 2`,
+	}
+
+	for fieldsConfig, expected := range testCases {
+		config := &FieldsConfig{}
+		assert.Nil(t, json.Unmarshal([]byte(fieldsConfig), config))
+		_, err := CreateCustomFields(config)
+		if assert.NotNil(t, err, fieldsConfig) {
+			assert.Equal(t, expected, err.Error(), fieldsConfig)
+		}
+	}
+}
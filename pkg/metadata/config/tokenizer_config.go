@@ -3,83 +3,317 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/vpoliboy/appmeta/pkg/metadata"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
 var (
 	errInvalidStdTokenizerConfig   = errors.New("invalid standard tokenizer config")
 	errInvalidChainTokenizerConfig = errors.New("invalid chain tokenizer config")
-	errFieldTokenizerConfig        = errors.New("invalid field to tokenizer config")
+	errInvalidPipelineConfig       = errors.New("invalid pipeline tokenizer config")
+	errInvalidCharFilterConfig     = errors.New("invalid char filter config")
+	errInvalidTokenFilterConfig    = errors.New("invalid token filter config")
+	errInvalidSynonymsConfig       = errors.New("invalid synonyms config")
+	errInvalidNGramTokenizerConfig = errors.New("invalid ngram tokenizer config")
+	errInvalidPatternConfig        = errors.New("invalid pattern tokenizer config")
 )
 
+const (
+	// MaxNGramSize caps the maxGram of the n-gram and the edge n-gram tokenizers.
+	MaxNGramSize = 20
+
+	// MaxNGramDiff caps the spread (maxGram - minGram) of the n-gram tokenizers, the same as the max_ngram_diff of
+	// Elasticsearch, as every extra gram size adds a gram per character of each word to the index.
+	MaxNGramDiff = 3
+)
+
+// ComponentConfig declares a tokenizer, a char filter or a token filter of the Type by the Name, the Config depends on
+// the Type.
+type ComponentConfig struct {
+	Name   string          `json:"name"`
+	Type   string          `json:"type"`
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
 type AnalyzerConfig struct {
+	// Char filters that the pipeline tokenizers refer to by the name
+	CharFilterConfigs []ComponentConfig `json:"charFilterConfig,omitempty"`
+
+	// Token filters that the pipeline tokenizers refer to by the name
+	TokenFilterConfigs []ComponentConfig `json:"tokenFilterConfig,omitempty"`
+
 	// Tokenizer Id to Config map
-	TokenizerConfigs []struct {
-		Name   string          `json:"name"`
-		Type   string          `json:"type"`
-		Config json.RawMessage `json:"config,omitempty"`
-	} `json:"tokenizerConfig"`
+	TokenizerConfigs []ComponentConfig `json:"tokenizerConfig"`
 
 	// Field to Tokenizer map
 	FieldConfig map[metadata.SearchField]string `json:"fieldConfig"`
+
+	// ConfDir is the directory the relative paths of the config e.g. the synonyms files are resolved against
+	ConfDir string `json:"-"`
 }
 
 type StandardTokenizerConfig struct {
 	StopWords []string `json:"stopWords"`
-	Separator string   `json:"separator,omitempty"`
 	Cutset    string   `json:"cutset"`
+
+	// Separator splits the input, on the whitespace when empty and on the Unicode word boundaries when "words"
+	Separator string `json:"separator,omitempty"`
+
+	// ASCIIFolding folds the latin letters with diacritics to ASCII e.g. josé to jose
+	ASCIIFolding bool `json:"asciiFolding,omitempty"`
+
+	// Stemmer is the language of the stemmer e.g. english, the terms are not stemmed when empty
+	Stemmer string `json:"stemmer,omitempty"`
+
+	// Synonyms replaces the terms with their synonyms before the terms are stemmed
+	Synonyms *SynonymsConfig `json:"synonyms,omitempty"`
+}
+
+// SynonymsConfig loads the synonym rules in the Solr format from the Path and/or the inline Rules, the equivalent terms
+// are expanded to all the terms unless Expand is false. Phase is index or query to apply the synonyms only to the
+// indexed or the search values, both by default.
+type SynonymsConfig struct {
+	Path   string   `json:"path,omitempty"`
+	Rules  []string `json:"rules,omitempty"`
+	Expand *bool    `json:"expand,omitempty"`
+	Phase  string   `json:"phase,omitempty"`
+}
+
+// NGramTokenizerConfig emits the grams of MinGram to MaxGram characters of the words made up of the TokenChars classes
+// (letter, digit, whitespace, punctuation or symbol), the whole value is a single word when no classes are given.
+type NGramTokenizerConfig struct {
+	MinGram    int      `json:"minGram"`
+	MaxGram    int      `json:"maxGram"`
+	TokenChars []string `json:"tokenChars,omitempty"`
+}
+
+// PatternTokenizerConfig splits the values on the matches of the regular expression Pattern, compiled with the Flags (any
+// of i, m, s and U), or emits the Group of each match instead when set, 0 being the whole match.
+type PatternTokenizerConfig struct {
+	Pattern string `json:"pattern"`
+	Flags   string `json:"flags,omitempty"`
+	Group   *int   `json:"group,omitempty"`
 }
 
 type ChainedTokenizerConfig struct {
 	TokenizerNames []string `json:"tokenizers"`
 }
 
+// PipelineTokenizerConfig refers to the char filters, the tokenizer and the token filters of the pipeline by the name,
+// the tokenizer has to be declared before the pipeline.
+type PipelineTokenizerConfig struct {
+	CharFilterNames  []string `json:"charFilters,omitempty"`
+	TokenizerName    string   `json:"tokenizer"`
+	TokenFilterNames []string `json:"tokenFilters,omitempty"`
+}
+
+type PatternReplaceCharFilterConfig struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+type StopTokenFilterConfig struct {
+	StopWords []string `json:"stopWords"`
+}
+
+type LengthTokenFilterConfig struct {
+	Min int `json:"min"`
+	Max int `json:"max,omitempty"`
+}
+
+type TrimTokenFilterConfig struct {
+	Cutset string `json:"cutset"`
+}
+
+type StemmerTokenFilterConfig struct {
+	Language string `json:"language"`
+}
+
+// Tokenizers are the tokenizers of the analyzer config by the name along with the tokenizers of the search fields.
+type Tokenizers struct {
+	Named  map[string]metadata.Tokenizer
+	Fields map[metadata.SearchField]metadata.Tokenizer
+}
+
 func CreateFieldTokenizers(config *AnalyzerConfig) (map[metadata.SearchField]metadata.Tokenizer, error) {
+	tokenizers, err := CreateTokenizers(config)
+	if err != nil {
+		return nil, err
+	}
+	return tokenizers.Fields, nil
+}
 
-	tokenizers := map[string]metadata.Tokenizer{}
+// CreateTokenizers validates the config and creates the char filters, the token filters and the tokenizers of the
+// config, the tokenizers after the ones they refer to, and maps the search fields to the tokenizers. The problems of
+// the config are reported as ConfigErrors.
+func CreateTokenizers(config *AnalyzerConfig) (*Tokenizers, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	var errs ConfigErrors
+
+	charFilters := map[string]metadata.CharFilter{}
+	for i, v := range config.CharFilterConfigs {
+		charFilter, err := MakeCharFilter(v)
+		if err != nil {
+			errs.add(fmt.Sprintf("%s[%d].config", charFilterSection, i), v.Name, "%s", err)
+			continue
+		}
+		charFilters[v.Name] = charFilter
+	}
 
-	for _, v := range config.TokenizerConfigs {
-		switch strings.ToLower(v.Type) {
-		case "exactmatch":
-			tokenizers[v.Name] = metadata.DefaultExactMatchTokenizer
-		case "nop":
-			tokenizers[v.Name] = metadata.DefaultNopTokenizer
-		case "standard":
-			tokenizer, err := MakeStandardTokenizerFromConfig(v.Config)
-			if err != nil {
-				return nil, err
-			}
-			tokenizers[v.Name] = tokenizer
-		case "chain":
-			tokenizer, err := MakeTokenizerChain(v.Config, tokenizers)
-			if err != nil {
-				return nil, err
-			}
-			tokenizers[v.Name] = tokenizer
+	tokenFilters := map[string]metadata.TokenFilter{}
+	for i, v := range config.TokenFilterConfigs {
+		tokenFilter, err := MakeTokenFilter(v, config.ConfDir)
+		if err != nil {
+			errs.add(fmt.Sprintf("%s[%d].config", tokenFilterSection, i), v.Name, "%s", err)
+			continue
 		}
+		tokenFilters[v.Name] = tokenFilter
+	}
+	if len(errs) > 0 {
+		return nil, errs
 	}
 
-	fieldTokenizerMapping := map[metadata.SearchField]metadata.Tokenizer{}
-	for k, v := range config.FieldConfig {
-		if tokenizer, ok := tokenizers[v]; ok {
-			fieldTokenizerMapping[k] = tokenizer
+	tokenizers := map[string]metadata.Tokenizer{}
+	for _, i := range config.tokenizerOrder() {
+		v := config.TokenizerConfigs[i]
+		tokenizer, err := makeTokenizer(v, config.ConfDir, tokenizers, charFilters, tokenFilters)
+		if err != nil {
+			errs.add(fmt.Sprintf("%s[%d].config", tokenizerSection, i), v.Name, "%s", err)
 			continue
 		}
-		return nil, errFieldTokenizerConfig
+		tokenizers[v.Name] = tokenizer
 	}
-	return fieldTokenizerMapping, nil
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	// the fields and their tokenizers are checked by the validation
+	fieldTokenizerMapping := map[metadata.SearchField]metadata.Tokenizer{}
+	for k, v := range config.FieldConfig {
+		fieldTokenizerMapping[k] = tokenizers[v]
+	}
+	return &Tokenizers{Named: tokenizers, Fields: fieldTokenizerMapping}, nil
+}
+
+// makeTokenizer makes the tokenizer of the config, the tokenizers it refers to have to be made already.
+func makeTokenizer(v ComponentConfig, confDir string, tokenizers map[string]metadata.Tokenizer,
+	charFilters map[string]metadata.CharFilter, tokenFilters map[string]metadata.TokenFilter) (metadata.Tokenizer, error) {
+
+	switch strings.ToLower(v.Type) {
+	case "exactmatch":
+		return metadata.DefaultExactMatchTokenizer, nil
+	case "nop":
+		return metadata.DefaultNopTokenizer, nil
+	case "whitespace":
+		return metadata.DefaultWhitespaceTokenizer, nil
+	case "url":
+		return metadata.DefaultURLTokenizer, nil
+	case "email":
+		return metadata.DefaultEmailTokenizer, nil
+	case "semver":
+		return metadata.DefaultSemverTokenizer, nil
+	case "standard":
+		return makeStandardTokenizer(v.Config, confDir)
+	case "ngram", "edge_ngram":
+		return MakeNGramTokenizer(v.Config, strings.ToLower(v.Type) == "edge_ngram")
+	case "pattern":
+		return MakePatternTokenizer(v.Config)
+	case "chain":
+		return MakeTokenizerChain(v.Config, tokenizers)
+	case "pipeline":
+		return MakePipelineTokenizer(v.Config, tokenizers, charFilters, tokenFilters)
+	}
+	return nil, fmt.Errorf("unknown tokenizer type %q", v.Type)
 }
 
 func MakeStandardTokenizerFromConfig(jsonConfig json.RawMessage) (metadata.Tokenizer, error) {
+	return makeStandardTokenizer(jsonConfig, "")
+}
+
+func makeStandardTokenizer(jsonConfig json.RawMessage, confDir string) (metadata.Tokenizer, error) {
 	config := &StandardTokenizerConfig{}
 	if json.Unmarshal(jsonConfig, config) != nil {
 		return nil, errInvalidStdTokenizerConfig
 	}
-	return metadata.NewStandardTokenizer(
+	options := []metadata.StandardTokenizerOption{
 		metadata.WithStopWords(config.StopWords),
 		metadata.WithSplitter(config.Separator),
-		metadata.WithTrimmer(config.Cutset)), nil
+		metadata.WithTrimmer(config.Cutset),
+	}
+	if config.ASCIIFolding {
+		options = append(options, metadata.WithASCIIFolding())
+	}
+	if config.Stemmer != "" {
+		stemmer, ok := metadata.Stemmers[strings.ToLower(config.Stemmer)]
+		if !ok {
+			return nil, errInvalidStdTokenizerConfig
+		}
+		options = append(options, metadata.WithStemmer(stemmer))
+	}
+	if config.Synonyms != nil {
+		synonyms, phase, err := LoadSynonyms(config.Synonyms, confDir)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, metadata.WithSynonyms(synonyms, phase))
+	}
+	return metadata.NewStandardTokenizer(options...), nil
+}
+
+// MakeNGramTokenizer makes an n-gram tokenizer or, when edge, an edge n-gram tokenizer of the config.
+func MakeNGramTokenizer(jsonConfig json.RawMessage, edge bool) (metadata.Tokenizer, error) {
+	config := &NGramTokenizerConfig{}
+	if json.Unmarshal(jsonConfig, config) != nil {
+		return nil, errInvalidNGramTokenizerConfig
+	}
+	if config.MinGram < 1 || config.MaxGram < config.MinGram || config.MaxGram > MaxNGramSize {
+		return nil, errInvalidNGramTokenizerConfig
+	}
+	if !edge && config.MaxGram-config.MinGram > MaxNGramDiff {
+		return nil, errInvalidNGramTokenizerConfig
+	}
+
+	var options []metadata.NGramTokenizerOption
+	for _, name := range config.TokenChars {
+		class, ok := metadata.TokenCharClasses[strings.ToLower(name)]
+		if !ok {
+			return nil, errInvalidNGramTokenizerConfig
+		}
+		options = append(options, metadata.WithTokenChars(class))
+	}
+
+	if edge {
+		return metadata.NewEdgeNGramTokenizer(config.MinGram, config.MaxGram, options...), nil
+	}
+	return metadata.NewNGramTokenizer(config.MinGram, config.MaxGram, options...), nil
+}
+
+// MakePatternTokenizer makes a pattern tokenizer of the config, the errors of an invalid pattern describe the problem
+// e.g. error parsing regexp: missing closing ): `(foo`.
+func MakePatternTokenizer(jsonConfig json.RawMessage) (metadata.Tokenizer, error) {
+	config := &PatternTokenizerConfig{}
+	if json.Unmarshal(jsonConfig, config) != nil {
+		return nil, errInvalidPatternConfig
+	}
+	if config.Pattern == "" {
+		return nil, fmt.Errorf("%s: pattern is required", errInvalidPatternConfig)
+	}
+
+	group := metadata.PatternSplitGroup
+	if config.Group != nil {
+		group = *config.Group
+	}
+	tokenizer, err := metadata.NewPatternTokenizer(config.Pattern, config.Flags, group)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", errInvalidPatternConfig, err)
+	}
+	return tokenizer, nil
 }
 
 func MakeTokenizerChain(jsonConfig json.RawMessage, tokenizers map[string]metadata.Tokenizer) (metadata.Tokenizer, error) {
@@ -99,3 +333,151 @@ func MakeTokenizerChain(jsonConfig json.RawMessage, tokenizers map[string]metada
 	}
 	return metadata.TokenizerChain(chain...), nil
 }
+
+func MakePipelineTokenizer(jsonConfig json.RawMessage, tokenizers map[string]metadata.Tokenizer,
+	charFilters map[string]metadata.CharFilter, tokenFilters map[string]metadata.TokenFilter) (metadata.Tokenizer, error) {
+
+	config := &PipelineTokenizerConfig{}
+	if json.Unmarshal(jsonConfig, config) != nil {
+		return nil, errInvalidPipelineConfig
+	}
+
+	tokenizer, ok := tokenizers[config.TokenizerName]
+	if !ok {
+		return nil, errInvalidPipelineConfig
+	}
+
+	pipelineCharFilters := make([]metadata.CharFilter, 0, len(config.CharFilterNames))
+	for _, name := range config.CharFilterNames {
+		charFilter, ok := charFilters[name]
+		if !ok {
+			return nil, errInvalidPipelineConfig
+		}
+		pipelineCharFilters = append(pipelineCharFilters, charFilter)
+	}
+
+	pipelineTokenFilters := make([]metadata.TokenFilter, 0, len(config.TokenFilterNames))
+	for _, name := range config.TokenFilterNames {
+		tokenFilter, ok := tokenFilters[name]
+		if !ok {
+			return nil, errInvalidPipelineConfig
+		}
+		pipelineTokenFilters = append(pipelineTokenFilters, tokenFilter)
+	}
+
+	return metadata.NewAnalysisPipeline(tokenizer,
+		metadata.WithCharFilters(pipelineCharFilters...),
+		metadata.WithTokenFilters(pipelineTokenFilters...)), nil
+}
+
+func MakeCharFilter(c ComponentConfig) (metadata.CharFilter, error) {
+	switch strings.ToLower(c.Type) {
+	case "html_strip":
+		return metadata.HTMLStripCharFilter, nil
+	case "markdown_strip":
+		return metadata.MarkdownStripCharFilter, nil
+	case "nfkc":
+		return metadata.NFKCCharFilter, nil
+	case "pattern_replace":
+		config := &PatternReplaceCharFilterConfig{}
+		if json.Unmarshal(c.Config, config) != nil {
+			return nil, errInvalidCharFilterConfig
+		}
+		charFilter, err := metadata.NewPatternReplaceCharFilter(config.Pattern, config.Replacement)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", errInvalidCharFilterConfig, err)
+		}
+		return charFilter, nil
+	}
+	return nil, errInvalidCharFilterConfig
+}
+
+func MakeTokenFilter(c ComponentConfig, confDir string) (metadata.TokenFilter, error) {
+	switch strings.ToLower(c.Type) {
+	case "lowercase":
+		return metadata.LowercaseTokenFilter, nil
+	case "unique":
+		return metadata.UniqueTokenFilter, nil
+	case "ascii_folding":
+		return metadata.ASCIIFoldingTokenFilter, nil
+	case "stop":
+		config := &StopTokenFilterConfig{}
+		if json.Unmarshal(c.Config, config) != nil {
+			return nil, errInvalidTokenFilterConfig
+		}
+		return metadata.NewStopTokenFilter(config.StopWords), nil
+	case "length":
+		config := &LengthTokenFilterConfig{}
+		if json.Unmarshal(c.Config, config) != nil || config.Min < 0 || (config.Max != 0 && config.Max < config.Min) {
+			return nil, errInvalidTokenFilterConfig
+		}
+		return metadata.NewLengthTokenFilter(config.Min, config.Max), nil
+	case "trim":
+		config := &TrimTokenFilterConfig{}
+		if json.Unmarshal(c.Config, config) != nil {
+			return nil, errInvalidTokenFilterConfig
+		}
+		return metadata.NewTrimTokenFilter(config.Cutset), nil
+	case "stemmer":
+		config := &StemmerTokenFilterConfig{}
+		if json.Unmarshal(c.Config, config) != nil {
+			return nil, errInvalidTokenFilterConfig
+		}
+		stemmer, ok := metadata.Stemmers[strings.ToLower(config.Language)]
+		if !ok {
+			return nil, errInvalidTokenFilterConfig
+		}
+		return metadata.NewStemmerTokenFilter(stemmer), nil
+	case "synonym":
+		config := &SynonymsConfig{}
+		if json.Unmarshal(c.Config, config) != nil {
+			return nil, errInvalidSynonymsConfig
+		}
+		synonyms, phase, err := LoadSynonyms(config, confDir)
+		if err != nil {
+			return nil, err
+		}
+		return metadata.InPhase(metadata.NewSynonymTokenFilter(synonyms), phase), nil
+	}
+	return nil, errInvalidTokenFilterConfig
+}
+
+// LoadSynonyms parses the synonym rules of the file and the inline rules, a relative path is resolved against the
+// confDir.
+func LoadSynonyms(config *SynonymsConfig, confDir string) (metadata.Synonyms, metadata.AnalysisPhase, error) {
+	phase := metadata.AnalysisPhase(strings.ToLower(config.Phase))
+	switch phase {
+	case metadata.AnalysisPhaseAll, metadata.AnalysisPhaseIndex, metadata.AnalysisPhaseQuery:
+	default:
+		return nil, "", errInvalidSynonymsConfig
+	}
+	if config.Path == "" && len(config.Rules) == 0 {
+		return nil, "", errInvalidSynonymsConfig
+	}
+
+	expand := config.Expand == nil || *config.Expand
+	rules := strings.Join(config.Rules, "\n")
+	synonyms, err := metadata.ParseSynonyms(strings.NewReader(rules), expand)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid synonym rules: %s", err)
+	}
+
+	if config.Path != "" {
+		path := config.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(confDir, path)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, "", err
+		}
+		defer f.Close()
+
+		fileSynonyms, err := metadata.ParseSynonyms(f, expand)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid synonyms file %s: %s", path, err)
+		}
+		synonyms.Merge(fileSynonyms)
+	}
+	return synonyms, phase, nil
+}
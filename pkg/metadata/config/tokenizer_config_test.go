@@ -7,6 +7,10 @@ package config
 import (
 	"encoding/json"
 	"github.com/stretchr/testify/assert"
+	"github.com/vpoliboy/appmeta/pkg/metadata"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -122,3 +126,303 @@ func TestMakeStandardTokenizerFromConfig(t *testing.T) {
 	}
 
 }
+
+func TestCreatePipelineTokenizerFromConfig(t *testing.T) {
+
+	config :=
+		`{
+  "charFilterConfig": [
+    {"name": "Html", "type": "html_strip"},
+    {"name": "Dashes", "type": "pattern_replace", "config": {"pattern": "-+", "replacement": " "}}
+  ],
+  "tokenFilterConfig": [
+    {"name": "Lower", "type": "lowercase"},
+    {"name": "Trim", "type": "trim", "config": {"cutset": ".,!"}},
+    {"name": "Length", "type": "length", "config": {"min": 2, "max": 20}},
+    {"name": "Stop", "type": "stop", "config": {"stopWords": ["the"]}},
+    {"name": "Fold", "type": "ascii_folding"},
+    {"name": "Plurals", "type": "stemmer", "config": {"language": "minimal_english"}},
+    {"name": "Unique", "type": "unique"}
+  ],
+  "tokenizerConfig": [
+    {"name": "Whitespace", "type": "Whitespace"},
+    {
+      "name": "Description",
+      "type": "Pipeline",
+      "config": {
+        "charFilters": ["Html", "Dashes"],
+        "tokenizer": "Whitespace",
+        "tokenFilters": ["Lower", "Trim", "Length", "Stop", "Fold", "Plurals", "Unique"]
+      }
+    }
+  ],
+  "fieldConfig": {
+    "description": "Description"
+  }
+}
+`
+	a := &AnalyzerConfig{}
+	assert.Nil(t, json.Unmarshal([]byte(config), a))
+
+	tokenizersMapping, err := CreateFieldTokenizers(a)
+	assert.Nil(t, err)
+
+	tokens := tokenizersMapping["description"].Tokenize("<p>The Café-apps, the APPS!</p>")
+	assert.Equal(t, []string{"cafe", "app"}, tokens)
+}
+
+func TestCreatePipelineTokenizerFromConfig_Invalid(t *testing.T) {
+	testCases := map[string]string{
+		"unknownTokenizer":   `{"tokenizerConfig": [{"name": "P", "type": "Pipeline", "config": {"tokenizer": "Missing"}}]}`,
+		"unknownCharFilter":  `{"tokenizerConfig": [{"name": "P", "type": "Pipeline", "config": {"tokenizer": "Missing", "charFilters": ["Missing"]}}]}`,
+		"unknownTokenFilter": `{"tokenizerConfig": [{"name": "W", "type": "Whitespace"}, {"name": "P", "type": "Pipeline", "config": {"tokenizer": "W", "tokenFilters": ["Missing"]}}]}`,
+		"charFilterType":     `{"charFilterConfig": [{"name": "C", "type": "bogus"}]}`,
+		"badPattern":         `{"charFilterConfig": [{"name": "C", "type": "pattern_replace", "config": {"pattern": "(", "replacement": ""}}]}`,
+		"tokenFilterType":    `{"tokenFilterConfig": [{"name": "T", "type": "bogus"}]}`,
+		"badLength":          `{"tokenFilterConfig": [{"name": "T", "type": "length", "config": {"min": 5, "max": 2}}]}`,
+		"badStemmer":         `{"tokenFilterConfig": [{"name": "T", "type": "stemmer", "config": {"language": "klingon"}}]}`,
+		"badGrams":           `{"tokenizerConfig": [{"name": "N", "type": "ngram", "config": {"minGram": 3, "maxGram": 2}}]}`,
+		"wideGrams":          `{"tokenizerConfig": [{"name": "N", "type": "ngram", "config": {"minGram": 1, "maxGram": 8}}]}`,
+		"noGrams":            `{"tokenizerConfig": [{"name": "N", "type": "edge_ngram"}]}`,
+		"badTokenChars":      `{"tokenizerConfig": [{"name": "N", "type": "ngram", "config": {"minGram": 1, "maxGram": 2, "tokenChars": ["vowel"]}}]}`,
+	}
+
+	for name, config := range testCases {
+		t.Run(name, func(t *testing.T) {
+			a := &AnalyzerConfig{}
+			assert.Nil(t, json.Unmarshal([]byte(config), a))
+			_, err := CreateFieldTokenizers(a)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestMakeStandardTokenizerFromConfig_Stemmer(t *testing.T) {
+	tokenizer, err := MakeStandardTokenizerFromConfig(json.RawMessage(`{"stopWords": ["the"], "cutset": ",", "stemmer": "English"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"cach", "librari"}, tokenizer.Tokenize("the Caching, libraries"))
+	assert.Equal(t, tokenizer.Tokenize("cached library"), tokenizer.Tokenize("caching libraries"))
+
+	_, err = MakeStandardTokenizerFromConfig(json.RawMessage(`{"stopWords": [], "cutset": "", "stemmer": "klingon"}`))
+	assert.NotNil(t, err)
+}
+
+func TestCreateSynonymTokenizersFromConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "synonyms")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "synonyms.txt"), []byte("# databases\npg, postgres\n"), 0644))
+
+	config :=
+		`{
+  "tokenFilterConfig": [
+    {"name": "Lower", "type": "lowercase"},
+    {"name": "Synonyms", "type": "synonym", "config": {"path": "synonyms.txt", "rules": ["k8s, kubernetes"], "phase": "query"}}
+  ],
+  "tokenizerConfig": [
+    {"name": "Whitespace", "type": "Whitespace"},
+    {"name": "Words", "type": "Standard", "config": {"stopWords": [], "cutset": ",", "synonyms": {"rules": ["k8s => kubernetes"]}}},
+    {"name": "Description", "type": "Pipeline", "config": {"tokenizer": "Whitespace", "tokenFilters": ["Lower", "Synonyms"]}}
+  ],
+  "fieldConfig": {
+    "description": "Description",
+    "name": "Words"
+  }
+}
+`
+	a := &AnalyzerConfig{ConfDir: dir}
+	assert.Nil(t, json.Unmarshal([]byte(config), a))
+
+	tokenizersMapping, err := CreateFieldTokenizers(a)
+	assert.Nil(t, err)
+
+	description := tokenizersMapping["description"]
+	assert.Equal(t, []string{"k8s", "pg"}, description.Tokenize("K8s PG"))
+	assert.Equal(t, []string{"k8s", "kubernetes", "pg", "postgres"}, metadata.QueryTokens(description, "K8s PG").Terms())
+
+	// the synonyms of the standard tokenizer apply in both the phases by default
+	assert.Equal(t, []string{"kubernetes"}, tokenizersMapping["name"].Tokenize("k8s"))
+}
+
+func TestLoadSynonyms_Invalid(t *testing.T) {
+	testCases := map[string]*SynonymsConfig{
+		"noRules":     {},
+		"badPhase":    {Rules: []string{"a, b"}, Phase: "always"},
+		"badRule":     {Rules: []string{"a => b => c"}},
+		"missingFile": {Path: "missing.txt"},
+	}
+
+	for name, config := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := LoadSynonyms(config, os.TempDir())
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestMakeStandardTokenizerFromConfig_Unicode(t *testing.T) {
+	tokenizer, err := MakeStandardTokenizerFromConfig(json.RawMessage(`{"stopWords": [], "cutset": "", "separator": "words", "asciiFolding": true}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"jose", "muller", "株", "式", "会", "社", "app"}, tokenizer.Tokenize("José Müller (株式会社) ＡＰＰ"))
+}
+
+func TestCreateNGramTokenizersFromConfig(t *testing.T) {
+	config :=
+		`{
+  "tokenizerConfig": [
+    {"name": "TitleGrams", "type": "ngram", "config": {"minGram": 3, "maxGram": 4, "tokenChars": ["Letter", "digit"]}},
+    {"name": "EmailPrefixes", "type": "edge_ngram", "config": {"minGram": 1, "maxGram": 5}}
+  ],
+  "fieldConfig": {
+    "title": "TitleGrams",
+    "email": "EmailPrefixes"
+  }
+}
+`
+	a := &AnalyzerConfig{}
+	assert.Nil(t, json.Unmarshal([]byte(config), a))
+
+	tokenizersMapping, err := CreateFieldTokenizers(a)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"app", "appm", "ppm", "ppme", "pme", "v12"}, tokenizersMapping["title"].Tokenize("appme-v12"))
+	assert.Equal(t, []string{"v", "vi", "vij", "vija", "vijay"}, tokenizersMapping["email"].Tokenize("Vijay@appmeta.io"))
+}
+
+func TestCreateIdentifierTokenizersFromConfig(t *testing.T) {
+	config := `{
+  "tokenizerConfig": [
+    {"name": "U", "type": "Url"},
+    {"name": "E", "type": "Email"},
+    {"name": "S", "type": "Semver"}
+  ],
+  "fieldConfig": {"source": "U", "email": "E", "version": "S"}
+}`
+	a := &AnalyzerConfig{}
+	assert.Nil(t, json.Unmarshal([]byte(config), a))
+
+	tokenizersMapping, err := CreateFieldTokenizers(a)
+	assert.Nil(t, err)
+	assert.Contains(t, tokenizersMapping["source"].Tokenize("https://github.com/upbound/repo"), "github.com/upbound")
+	assert.Contains(t, tokenizersMapping["email"].Tokenize("vijay@hotmail.com"), "hotmail.com")
+	assert.Contains(t, tokenizersMapping["version"].Tokenize("1.0.1"), "1.0")
+}
+
+func TestCreateTokenizers(t *testing.T) {
+	config := `{
+  "tokenizerConfig": [
+    {"name": "Words", "type": "Whitespace"},
+    {"name": "Exact", "type": "ExactMatch"},
+    {"name": "Name", "type": "Chain", "config": {"tokenizers": ["Words", "Exact"]}}
+  ],
+  "fieldConfig": {"name": "Name"}
+}`
+	a := &AnalyzerConfig{}
+	assert.Nil(t, json.Unmarshal([]byte(config), a))
+
+	tokenizers, err := CreateTokenizers(a)
+	assert.Nil(t, err)
+	assert.Len(t, tokenizers.Named, 3)
+	assert.Len(t, tokenizers.Fields, 1)
+	assert.Equal(t, tokenizers.Named["Name"], tokenizers.Fields["name"])
+	assert.Equal(t, []string{"vijay", "poliboyina"}, tokenizers.Named["Words"].Tokenize("vijay poliboyina"))
+}
+
+func TestCreatePatternTokenizerFromConfig(t *testing.T) {
+	config := `{
+  "tokenizerConfig": [
+    {"name": "Paths", "type": "Pattern", "config": {"pattern": "[/|\\s]+"}},
+    {"name": "Tags", "type": "Pattern", "config": {"pattern": "#(\\w+)", "flags": "i", "group": 1}}
+  ],
+  "fieldConfig": {"description": "Paths", "title": "Tags"}
+}`
+	a := &AnalyzerConfig{}
+	assert.Nil(t, json.Unmarshal([]byte(config), a))
+
+	tokenizersMapping, err := CreateFieldTokenizers(a)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"foo", "bar", "baz"}, tokenizersMapping["description"].Tokenize("foo/bar|baz"))
+	assert.Equal(t, []string{"go", "search"}, tokenizersMapping["title"].Tokenize("#Go and #search"))
+
+	testCases := map[string]string{
+		`{"pattern": "(foo"}`:                  "tokenizerConfig[0].config (P): invalid pattern tokenizer config: error parsing regexp: missing closing ): `(foo`",
+		`{"pattern": "foo", "flags": "g"}`:     `tokenizerConfig[0].config (P): invalid pattern tokenizer config: invalid flag 'g', has to be one of i, m, s, U`,
+		`{"pattern": "(foo)", "group": 2}`:     "tokenizerConfig[0].config (P): invalid pattern tokenizer config: invalid group 2, the pattern has 1 groups",
+		`{"flags": "i"}`:                       "tokenizerConfig[0].config (P): invalid pattern tokenizer config: pattern is required",
+		`{"pattern": "foo", "group": "first"}`: "tokenizerConfig[0].config (P): cannot unmarshal string into Go struct field PatternTokenizerConfig.group of type int",
+	}
+	for patternConfig, expected := range testCases {
+		a := &AnalyzerConfig{}
+		assert.Nil(t, json.Unmarshal([]byte(`{"tokenizerConfig": [{"name": "P", "type": "pattern", "config": `+patternConfig+`}]}`), a))
+		_, err := CreateFieldTokenizers(a)
+		if assert.NotNil(t, err, patternConfig) {
+			assert.Equal(t, expected, err.Error())
+		}
+	}
+}
+
+func TestCreateTokenizers_ForwardReferences(t *testing.T) {
+	config := `{
+  "tokenizerConfig": [
+    {"name": "Description", "type": "Pipeline", "config": {"tokenizer": "Name", "tokenFilters": ["Unique"]}},
+    {"name": "Name", "type": "Chain", "config": {"tokenizers": ["Words", "Exact"]}},
+    {"name": "Words", "type": "Whitespace"},
+    {"name": "Exact", "type": "ExactMatch"}
+  ],
+  "tokenFilterConfig": [{"name": "Unique", "type": "unique"}],
+  "fieldConfig": {"name": "Name", "description": "Description"}
+}`
+	a := &AnalyzerConfig{}
+	assert.Nil(t, json.Unmarshal([]byte(config), a))
+
+	tokenizersMapping, err := CreateFieldTokenizers(a)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Vijay", "Poliboyina", "vijay poliboyina"}, tokenizersMapping["name"].Tokenize("Vijay Poliboyina"))
+	assert.Equal(t, []string{"vijay", "vijay vijay"}, tokenizersMapping["description"].Tokenize("vijay vijay"))
+}
+
+func TestAnalyzerConfig_Validate(t *testing.T) {
+	testCases := map[string]string{
+		`{"tokenizerConfig": [{"name": "W", "type": "whitespaces"}]}`: `tokenizerConfig[0].type (W): unknown type "whitespaces", has to be one of ` +
+			`chain, edge_ngram, email, exactmatch, ngram, nop, pattern, pipeline, semver, standard, url, whitespace`,
+		`{"tokenizerConfig": [{"type": "Whitespace"}]}`:                                             `tokenizerConfig[0].name: name is required`,
+		`{"tokenizerConfig": [{"name": "W", "type": "Whitespace"}, {"name": "W", "type": "Nop"}]}`:  `tokenizerConfig[1].name (W): duplicate name, already declared at tokenizerConfig[0]`,
+		`{"tokenizerConfig": [{"name": "W", "type": "Whitespace", "config": {"cutset": ","}}]}`:     `tokenizerConfig[0].config (W): the type does not take a config`,
+		`{"tokenizerConfig": [{"name": "S", "type": "Standard"}]}`:                                  `tokenizerConfig[0].config (S): config is required`,
+		`{"tokenizerConfig": [{"name": "S", "type": "Standard", "config": {"stopWord": ["the"]}}]}`: `tokenizerConfig[0].config (S): unknown field "stopWord"`,
+		`{"charFilterConfig": [{"name": "C", "type": "html"}]}`: `charFilterConfig[0].type (C): unknown type "html", has to be one of ` +
+			`html_strip, markdown_strip, nfkc, pattern_replace`,
+		`{"tokenFilterConfig": [{"name": "T", "type": "length", "config": {"min": 5, "max": 2}}]}`:                                               `tokenFilterConfig[0].config (T): invalid token filter config`,
+		`{"tokenizerConfig": [{"name": "C", "type": "Chain", "config": {"tokenizers": ["W", "Missing"]}}, {"name": "W", "type": "Whitespace"}]}`: `tokenizerConfig[0].config.tokenizers[1] (C): unknown tokenizer "Missing"`,
+		`{"tokenizerConfig": [{"name": "C", "type": "Chain", "config": {"tokenizers": []}}]}`:                                                    `tokenizerConfig[0].config.tokenizers (C): at least one tokenizer is required`,
+		`{"tokenizerConfig": [{"name": "P", "type": "Pipeline", "config": {"tokenizer": "P", "charFilters": ["Missing"]}}]}`: `tokenizerConfig[0].config.charFilters[0] (P): unknown char filter "Missing"; ` +
+			`tokenizerConfig[0].config.tokenizer (P): cyclic reference P -> P`,
+		`{"tokenizerConfig": [{"name": "A", "type": "Chain", "config": {"tokenizers": ["B"]}}, {"name": "B", "type": "Pipeline", "config": {"tokenizer": "A"}}]}`: `tokenizerConfig[1].config.tokenizer (B): cyclic reference A -> B -> A`,
+		`{"tokenizerConfig": [{"name": "N", "type": "ngram", "config": {"minGram": 3, "maxGram": 2}}]}`:                                                           `tokenizerConfig[0].config.maxGram (N): maxGram 2 is less than minGram 3`,
+		`{"tokenizerConfig": [{"name": "N", "type": "ngram", "config": {"minGram": 1, "maxGram": 10}}]}`:                                                          `tokenizerConfig[0].config.maxGram (N): maxGram - minGram is 9, the difference must be at most 3`,
+		`{"tokenizerConfig": [{"name": "E", "type": "edge_ngram", "config": {"minGram": 1, "maxGram": 50}}]}`:                                                     `tokenizerConfig[0].config.maxGram (E): maxGram 50 is greater than 20`,
+		`{"tokenizerConfig": [{"name": "E", "type": "edge_ngram", "config": {"minGram": 0, "maxGram": 5}}]}`:                                                      `tokenizerConfig[0].config.minGram (E): minGram must be positive`,
+		`{"tokenizerConfig": [{"name": "W", "type": "Whitespace"}], "fieldConfig": {"titel": "W", "name": "X", "any": "W"}}`: `fieldConfig.any (any): unknown field, has to be one of ` +
+			`[company description email license name source title version website]; fieldConfig.name (name): unknown tokenizer "X"; ` +
+			`fieldConfig.titel (titel): unknown field, has to be one of [company description email license name source title version website]`,
+	}
+
+	for config, expected := range testCases {
+		a := &AnalyzerConfig{}
+		assert.Nil(t, json.Unmarshal([]byte(config), a))
+		_, err := CreateTokenizers(a)
+		if assert.NotNil(t, err, config) {
+			assert.Equal(t, expected, err.Error(), config)
+		}
+	}
+
+	a := &AnalyzerConfig{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"tokenizerConfig": [{"name": "W", "type": "Bogus"}], "fieldConfig": {"title": "W"}}`), a))
+	err := a.Validate()
+	if assert.IsType(t, ConfigErrors{}, err) {
+		errs := err.(ConfigErrors)
+		assert.Len(t, errs, 1)
+		assert.Equal(t, &ConfigError{Path: "tokenizerConfig[0].type", Name: "W", Reason: `unknown type "Bogus", has to be one of ` +
+			`chain, edge_ngram, email, exactmatch, ngram, nop, pattern, pipeline, semver, standard, url, whitespace`}, errs[0])
+	}
+}
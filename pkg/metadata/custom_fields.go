@@ -0,0 +1,245 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+const (
+	customFieldNameRegexString = "^[a-z][a-zA-Z0-9_]*$"
+
+	errMessageFieldRequired    = "cannot be blank"
+	errMessageUnknownField     = "not a declared field"
+	errMessageInvalidFieldType = "must be a %s"
+)
+
+// FieldType is the type of the value of a custom field.
+type FieldType string
+
+const (
+	FieldTypeString  = FieldType("string")
+	FieldTypeNumber  = FieldType("number")
+	FieldTypeBoolean = FieldType("boolean")
+
+	// FieldTypeList is a list of strings e.g. the tags, the rules apply to each of the strings
+	FieldTypeList = FieldType("list")
+)
+
+var (
+	customFieldNameRegexp = regexp.MustCompile(customFieldNameRegexString)
+
+	// registry holds the current *fieldRegistry, it is nil until the custom fields are set
+	registry atomic.Value
+
+	builtinRegistry = &fieldRegistry{searchFields: builtinSearchFields, customFields: map[SearchField]*CustomField{}}
+)
+
+// fieldRegistry is the set of the search fields, the fixed ones along with the custom fields that are declared in the
+// config on top of them, the custom fields are searchable the same way as the fixed fields. A registry is never
+// modified, SetCustomFields swaps in a new one so that the searches and the indexing that run along with it see either
+// the previous or the new fields but never a mix of them.
+type fieldRegistry struct {
+	searchFields map[SearchField]bool
+	customFields map[SearchField]*CustomField
+}
+
+// currentFields returns the current registry of the fields, the fixed fields only until the custom fields are set.
+func currentFields() *fieldRegistry {
+	if fields, ok := registry.Load().(*fieldRegistry); ok {
+		return fields
+	}
+	return builtinRegistry
+}
+
+// CustomField is a field of the metadata that is declared in the config, its values are kept in Metadata.Fields.
+type CustomField struct {
+	Name     SearchField
+	Type     FieldType
+	Required bool
+
+	// Rules validate each value of the field, a string for the string and the list fields, a float64 for the number
+	// fields.
+	Rules []validation.Rule
+
+	// Tokenizer analyzes the field unless the field is mapped to a tokenizer in the analyzer config, exact match if nil.
+	Tokenizer Tokenizer
+}
+
+// SetCustomFields replaces the custom fields with the given ones, the fields become searchable and are validated
+// along with the fixed fields of the metadata. The fields are swapped in at once and are safe to set along with the
+// service, but the indexed metadata is not reanalyzed i.e. the custom fields are meant to be set before the service
+// is created.
+func SetCustomFields(fields ...*CustomField) error {
+	declared := map[SearchField]*CustomField{}
+	for _, field := range fields {
+		switch {
+		case !customFieldNameRegexp.MatchString(string(field.Name)):
+			return fmt.Errorf("invalid field name %q, must match regex: %s", field.Name, customFieldNameRegexString)
+		case builtinSearchFields[field.Name]:
+			return fmt.Errorf("field %s is a built-in field", field.Name)
+		case declared[field.Name] != nil:
+			return fmt.Errorf("field %s is declared more than once", field.Name)
+		}
+		switch field.Type {
+		case FieldTypeString, FieldTypeNumber, FieldTypeBoolean, FieldTypeList:
+		default:
+			return fmt.Errorf("field %s has an invalid type %q, has to be one of %s, %s, %s or %s", field.Name,
+				field.Type, FieldTypeString, FieldTypeNumber, FieldTypeBoolean, FieldTypeList)
+		}
+		declared[field.Name] = field
+	}
+
+	searchFields := make(map[SearchField]bool, len(builtinSearchFields)+len(declared))
+	for name := range builtinSearchFields {
+		searchFields[name] = true
+	}
+	for name := range declared {
+		searchFields[name] = true
+	}
+	registry.Store(&fieldRegistry{searchFields: searchFields, customFields: declared})
+	return nil
+}
+
+// CustomFields returns the declared custom fields sorted by the name.
+func CustomFields() []*CustomField {
+	customFields := currentFields().customFields
+	fields := make([]*CustomField, 0, len(customFields))
+	for _, field := range customFields {
+		fields = append(fields, field)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return fields
+}
+
+// validateCustomFields validates the values of the custom fields (a map of the values by the name), the undeclared
+// fields are errors.
+func validateCustomFields(value interface{}) error {
+	fields, _ := value.(map[string]interface{})
+	customFields := currentFields().customFields
+	errs := validation.Errors{}
+	for name := range fields {
+		if _, ok := customFields[SearchField(name)]; !ok {
+			errs[name] = errors.New(errMessageUnknownField)
+		}
+	}
+	for _, field := range customFields {
+		if err := field.validate(fields[string(field.Name)]); err != nil {
+			errs[string(field.Name)] = err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (f *CustomField) validate(value interface{}) error {
+	values, ok := f.typedValues(value)
+	if !ok {
+		return fmt.Errorf(errMessageInvalidFieldType, f.Type)
+	}
+	if len(values) == 0 {
+		if f.Required {
+			return errors.New(errMessageFieldRequired)
+		}
+		return nil
+	}
+	for _, v := range values {
+		if err := validation.Validate(v, f.Rules...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// typedValues converts the decoded value (JSON or yaml) of the field to the values of its type, i.e. strings for the
+// string and the list fields, float64 for the number fields and bool for the boolean fields. A missing value and an
+// empty string or list have no values.
+func (f *CustomField) typedValues(value interface{}) ([]interface{}, bool) {
+	if value == nil {
+		return nil, true
+	}
+	switch f.Type {
+	case FieldTypeString:
+		s, ok := value.(string)
+		if !ok {
+			return nil, false
+		}
+		if s == "" {
+			return nil, true
+		}
+		return []interface{}{s}, true
+	case FieldTypeNumber:
+		n, ok := toFloat(value)
+		return []interface{}{n}, ok
+	case FieldTypeBoolean:
+		b, ok := value.(bool)
+		return []interface{}{b}, ok
+	case FieldTypeList:
+		if strs, ok := value.([]string); ok {
+			list := make([]interface{}, 0, len(strs))
+			for _, v := range strs {
+				list = append(list, v)
+			}
+			return list, true
+		}
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil, false
+		}
+		for _, v := range list {
+			if _, ok := v.(string); !ok {
+				return nil, false
+			}
+		}
+		return list, true
+	}
+	return nil, false
+}
+
+// stringValues returns the values of the field in the metadata as the strings that are analyzed, the numbers are
+// formatted the shortest way e.g. 3 for both 3 and 3.0 so that the yaml and the JSON payloads are indexed the same.
+func (f *CustomField) stringValues(m *Metadata) []string {
+	values, ok := f.typedValues(m.Fields[string(f.Name)])
+	if !ok {
+		return nil
+	}
+	strs := make([]string, 0, len(values))
+	for _, v := range values {
+		switch v := v.(type) {
+		case string:
+			strs = append(strs, v)
+		case float64:
+			strs = append(strs, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			strs = append(strs, strconv.FormatBool(v))
+		}
+	}
+	return strs
+}
+
+// toFloat converts the numbers decoded from JSON (float64) or yaml (int, float64) to a float64.
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
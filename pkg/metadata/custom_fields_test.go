@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+func TestSetCustomFields(t *testing.T) {
+	defer SetCustomFields()
+
+	testCases := map[string]struct {
+		fields               []*CustomField
+		expectedErrorMessage string
+	}{
+		"valid":         {fields: []*CustomField{{Name: "category", Type: FieldTypeString}, {Name: "supportTier", Type: FieldTypeNumber}}},
+		"invalidName":   {fields: []*CustomField{{Name: "Category", Type: FieldTypeString}}, expectedErrorMessage: `invalid field name "Category"`},
+		"builtinField":  {fields: []*CustomField{{Name: "title", Type: FieldTypeString}}, expectedErrorMessage: "field title is a built-in field"},
+		"anyField":      {fields: []*CustomField{{Name: "any", Type: FieldTypeString}}, expectedErrorMessage: "field any is a built-in field"},
+		"duplicateName": {fields: []*CustomField{{Name: "tags", Type: FieldTypeList}, {Name: "tags", Type: FieldTypeString}}, expectedErrorMessage: "field tags is declared more than once"},
+		"invalidType":   {fields: []*CustomField{{Name: "tags", Type: "array"}}, expectedErrorMessage: `field tags has an invalid type "array"`},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(tt *testing.T) {
+			err := SetCustomFields(v.fields...)
+			if v.expectedErrorMessage == "" {
+				assert.Nil(tt, err)
+			} else if assert.NotNil(tt, err) {
+				assert.Contains(tt, err.Error(), v.expectedErrorMessage)
+			}
+		})
+	}
+
+	// the fields replace the previous ones
+	assert.Nil(t, SetCustomFields(&CustomField{Name: "category", Type: FieldTypeString}))
+	assert.Nil(t, SetCustomFields(&CustomField{Name: "tags", Type: FieldTypeList}))
+	assert.False(t, currentFields().searchFields["category"])
+	assert.True(t, currentFields().searchFields["tags"])
+	assert.Contains(t, IndexedFields(), SearchField("tags"))
+	assert.Nil(t, SetCustomFields())
+	assert.False(t, currentFields().searchFields["tags"])
+}
+
+func TestSetCustomFields_Concurrent(t *testing.T) {
+	defer SetCustomFields()
+
+	// the fields are swapped in at once, the readers see either the previous or the new fields (run with -race)
+	analyzer := &Analyzer{defaultSearchFieldTokenizerMapping}
+	m := newTestMetadata("appmeta", "Vijay Poliboyina")
+	m.Fields = map[string]interface{}{"tags": []interface{}{"sql"}}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			assert.Nil(t, SetCustomFields(&CustomField{Name: "tags", Type: FieldTypeList}))
+			assert.Nil(t, SetCustomFields())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_ = Query{"tags": "sql"}.Validate()
+			_ = m.Validate()
+			analyzer.AnalyzePayload(m)
+		}
+	}()
+	wg.Wait()
+}
+
+func TestMetadata_ValidateCustomFields(t *testing.T) {
+	defer SetCustomFields()
+
+	assert.Nil(t, SetCustomFields(
+		&CustomField{Name: "category", Type: FieldTypeString, Required: true,
+			Rules: []validation.Rule{validation.In("database", "monitoring").Error("must be one of database, monitoring")}},
+		&CustomField{Name: "tags", Type: FieldTypeList,
+			Rules: []validation.Rule{validation.Match(regexp.MustCompile("^[a-z]+$")).Error("must be lowercase")}},
+		&CustomField{Name: "supportTier", Type: FieldTypeNumber, Rules: []validation.Rule{validation.Min(1.0), validation.Max(3.0)}},
+		&CustomField{Name: "deprecated", Type: FieldTypeBoolean},
+	))
+
+	testCases := map[string]struct {
+		fields               map[string]interface{}
+		expectedErrorMessage string
+	}{
+		"valid":            {fields: map[string]interface{}{"category": "database", "tags": []interface{}{"sql", "fast"}, "supportTier": 2, "deprecated": false}},
+		"validJsonNumber":  {fields: map[string]interface{}{"category": "database", "supportTier": 2.0}},
+		"validStringSlice": {fields: map[string]interface{}{"category": "database", "tags": []string{"sql"}}},
+		"missingRequired":  {fields: map[string]interface{}{"tags": []interface{}{"sql"}}, expectedErrorMessage: "fields: (category: cannot be blank.)"},
+		"emptyRequired":    {fields: map[string]interface{}{"category": ""}, expectedErrorMessage: "category: cannot be blank"},
+		"invalidValue":     {fields: map[string]interface{}{"category": "storage"}, expectedErrorMessage: "category: must be one of database, monitoring"},
+		"invalidListValue": {fields: map[string]interface{}{"category": "database", "tags": []interface{}{"sql", "No"}}, expectedErrorMessage: "tags: must be lowercase"},
+		"invalidListType":  {fields: map[string]interface{}{"category": "database", "tags": "sql"}, expectedErrorMessage: "tags: must be a list"},
+		"invalidNumber":    {fields: map[string]interface{}{"category": "database", "supportTier": 4}, expectedErrorMessage: "supportTier: must be no greater than 3"},
+		"invalidType":      {fields: map[string]interface{}{"category": "database", "deprecated": "no"}, expectedErrorMessage: "deprecated: must be a boolean"},
+		"unknownField":     {fields: map[string]interface{}{"category": "database", "runtime": "go"}, expectedErrorMessage: "runtime: not a declared field"},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(tt *testing.T) {
+			m := newTestMetadata("appmeta", "Vijay Poliboyina")
+			m.Fields = v.fields
+			err := m.Validate()
+			if v.expectedErrorMessage == "" {
+				assert.Nil(tt, err)
+			} else if assert.NotNil(tt, err) {
+				assert.Contains(tt, err.Error(), v.expectedErrorMessage)
+			}
+		})
+	}
+}
+
+func TestAnalyzer_AnalyzeCustomFields(t *testing.T) {
+	defer SetCustomFields()
+
+	assert.Nil(t, SetCustomFields(
+		&CustomField{Name: "runtime", Type: FieldTypeString, Tokenizer: DefaultPerWordTokenizer},
+		&CustomField{Name: "tags", Type: FieldTypeList},
+		&CustomField{Name: "supportTier", Type: FieldTypeNumber},
+		&CustomField{Name: "deprecated", Type: FieldTypeBoolean},
+	))
+
+	m := newTestMetadata("appmeta", "Vijay Poliboyina")
+	m.Fields = map[string]interface{}{"runtime": "Go Lang", "tags": []interface{}{"Search", "Index"}, "supportTier": 2.0, "deprecated": true}
+
+	terms := (&Analyzer{defaultSearchFieldTokenizerMapping}).AnalyzePayload(m)
+	assert.Equal(t, []string{"go", "lang"}, terms["runtime"].Terms())
+	assert.Equal(t, []string{"search", "index"}, terms["tags"].Terms())
+	assert.Equal(t, []string{"2"}, terms["supportTier"].Terms())
+	assert.Equal(t, []string{"true"}, terms["deprecated"].Terms())
+
+	// the values of a list are positionGap positions apart
+	assert.Equal(t, 1+positionGap, terms["tags"][1].Position)
+
+	// the analyzer config takes precedence over the declared tokenizer
+	terms = (&Analyzer{map[SearchField]Tokenizer{"runtime": DefaultExactMatchTokenizer}}).AnalyzePayload(m)
+	assert.Equal(t, []string{"go lang"}, terms["runtime"].Terms())
+}
+
+func TestInMemoryIndexer_SuggestCustomFields(t *testing.T) {
+	defer SetCustomFields()
+
+	assert.Nil(t, SetCustomFields(
+		&CustomField{Name: "category", Type: FieldTypeString},
+		&CustomField{Name: "tags", Type: FieldTypeList},
+		&CustomField{Name: "supportTier", Type: FieldTypeNumber},
+	))
+
+	indexer := newInMemoryIndexer(logrus.New())
+	analyzer := &Analyzer{defaultSearchFieldTokenizerMapping}
+	for i, tags := range [][]interface{}{{"Search", "Security"}, {"search"}, {"Storage"}} {
+		m := newTestMetadata(fmt.Sprintf("app %d", i), "Vijay Poliboyina")
+		m.Fields = map[string]interface{}{"category": "Database", "tags": tags, "supportTier": 1.0}
+		_, err := indexer.Index(analyzer.AnalyzePayload(m), m)
+		assert.Nil(t, err)
+	}
+
+	suggestions, _ := indexer.Suggest("tags", "s", 10)
+	assert.Equal(t, []Suggestion{{"Search", 2}, {"Security", 1}, {"Storage", 1}}, suggestions)
+	suggestions, _ = indexer.Suggest("category", "DATA", 10)
+	assert.Equal(t, []Suggestion{{"Database", 3}}, suggestions)
+
+	// the custom string and list fields can be completed, the other custom fields are rejected
+	assert.Nil(t, (&SuggestRequest{Field: "tags", Prefix: "s", Size: 5}).Validate())
+	err := (&SuggestRequest{Field: "supportTier", Prefix: "1", Size: 5}).Validate()
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "supportTier is not a valid suggest field")
+	}
+}
+
+func TestInMemoryIndexer_ReindexDroppedCustomField(t *testing.T) {
+	defer SetCustomFields()
+
+	assert.Nil(t, SetCustomFields(&CustomField{Name: "tags", Type: FieldTypeList}))
+	indexer := newInMemoryIndexer(logrus.New()).(*inMemoryIndexer)
+	analyzer := &Analyzer{defaultSearchFieldTokenizerMapping}
+
+	m := newTestMetadata("appmeta", "Vijay Poliboyina")
+	m.Fields = map[string]interface{}{"tags": []interface{}{"sql"}}
+	id, err := indexer.Index(analyzer.AnalyzePayload(m), m)
+	assert.Nil(t, err)
+
+	// the postings of a field that is no longer declared are dropped on the next update
+	assert.Nil(t, SetCustomFields())
+	m.Fields = nil
+	assert.Nil(t, indexer.Reindex(id, analyzer.AnalyzePayload(m), m))
+
+	hits, err := indexer.Execute(&QueryClause{Field: "tags", Value: "sql"})
+	assert.Nil(t, err)
+	assert.Empty(t, hits)
+	assert.NotContains(t, indexer.searchIndex, SearchField("tags"))
+	assert.Zero(t, indexer.fieldLengths["tags"])
+}
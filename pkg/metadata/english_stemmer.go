@@ -0,0 +1,300 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import "strings"
+
+const (
+	// EnglishStemmer is the Porter2 (Snowball) English stemmer e.g. caching, cached and cache all become cach
+	EnglishStemmer = "english"
+)
+
+type suffixRule struct {
+	suffix      string
+	replacement string
+}
+
+var (
+	// englishExceptions are the words that are stemmed as a whole, before any of the steps
+	englishExceptions = map[string]string{
+		"skis":   "ski",
+		"skies":  "sky",
+		"dying":  "die",
+		"lying":  "lie",
+		"tying":  "tie",
+		"idly":   "idl",
+		"gently": "gentl",
+		"ugly":   "ugli",
+		"early":  "earli",
+		"only":   "onli",
+		"singly": "singl",
+		"sky":    "sky",
+		"news":   "news",
+		"howe":   "howe",
+		"atlas":  "atlas",
+		"cosmos": "cosmos",
+		"bias":   "bias",
+		"andes":  "andes",
+	}
+
+	// englishInvariants are the words that are left as is after the step 1a
+	englishInvariants = toSet([]string{"inning", "outing", "canning", "herring", "earring", "proceed", "exceed", "succeed"})
+
+	// englishR1Prefixes are the prefixes whose R1 region starts right after them
+	englishR1Prefixes = []string{"gener", "commun", "arsen"}
+
+	// the suffix rules of the steps 2, 3 and 4 are ordered by the length so that the longest suffix is matched first
+	englishStep2Rules = []suffixRule{
+		{"ization", "ize"}, {"ational", "ate"}, {"fulness", "ful"}, {"ousness", "ous"}, {"iveness", "ive"},
+		{"tional", "tion"}, {"biliti", "ble"}, {"lessli", "less"},
+		{"entli", "ent"}, {"ation", "ate"}, {"alism", "al"}, {"aliti", "al"}, {"ousli", "ous"}, {"iviti", "ive"},
+		{"fulli", "ful"},
+		{"enci", "ence"}, {"anci", "ance"}, {"abli", "able"}, {"izer", "ize"}, {"ator", "ate"}, {"alli", "al"},
+		{"bli", "ble"}, {"ogi", "og"},
+		{"li", ""},
+	}
+
+	englishStep3Rules = []suffixRule{
+		{"ational", "ate"}, {"tional", "tion"}, {"alize", "al"}, {"icate", "ic"}, {"iciti", "ic"}, {"ative", ""},
+		{"ical", "ic"}, {"ness", ""}, {"ful", ""},
+	}
+
+	englishStep4Suffixes = []string{
+		"ement", "ance", "ence", "able", "ible", "ment", "ant", "ent", "ism", "ate", "iti", "ous", "ive", "ize", "ion",
+		"al", "er", "ic",
+	}
+)
+
+func isEnglishVowel(c byte) bool {
+	switch c {
+	case 'a', 'e', 'i', 'o', 'u', 'y':
+		return true
+	}
+	return false
+}
+
+func containsEnglishVowel(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if isEnglishVowel(s[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// endsWithShortSyllable checks if the word ends with a non-vowel, a vowel and a non-vowel other than w, x and Y, or is
+// a vowel followed by a non-vowel.
+func endsWithShortSyllable(w string) bool {
+	n := len(w)
+	switch {
+	case n == 2:
+		return isEnglishVowel(w[0]) && !isEnglishVowel(w[1])
+	case n > 2:
+		last := w[n-1]
+		return !isEnglishVowel(w[n-3]) && isEnglishVowel(w[n-2]) && !isEnglishVowel(last) &&
+			last != 'w' && last != 'x' && last != 'Y'
+	}
+	return false
+}
+
+// englishRegion returns the start of the region after the first non-vowel that follows a vowel at or after from.
+func englishRegion(w string, from int) int {
+	for i := from + 1; i < len(w); i++ {
+		if !isEnglishVowel(w[i]) && isEnglishVowel(w[i-1]) {
+			return i + 1
+		}
+	}
+	return len(w)
+}
+
+// englishStem implements the Porter2 stemming algorithm (https://snowballstem.org/algorithms/english/stemmer.html)
+// for a lowercased word. The steps remove the suffixes only from the R1 and R2 regions of the word:
+//    0. removes the possessive apostrophes
+//    1. removes the plurals and the -ed, -ing endings and turns the terminal y to i
+//    2. maps the double suffixes to the single ones e.g. -ization to -ize
+//    3. removes or maps the -ic-, -ful, -ness etc. suffixes
+//    4. removes the -ant, -ence etc. suffixes in R2
+//    5. removes the final e or the double l
+func englishStem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	if stem, ok := englishExceptions[word]; ok {
+		return stem
+	}
+
+	w := []byte(strings.TrimPrefix(word, "'"))
+	for i := range w {
+		// the y that acts as a consonant is marked as Y so that it is not a vowel
+		if w[i] == 'y' && (i == 0 || isEnglishVowel(w[i-1])) {
+			w[i] = 'Y'
+		}
+	}
+	s := string(w)
+
+	r1 := -1
+	for _, prefix := range englishR1Prefixes {
+		if strings.HasPrefix(s, prefix) {
+			r1 = len(prefix)
+			break
+		}
+	}
+	if r1 < 0 {
+		r1 = englishRegion(s, 0)
+	}
+	r2 := englishRegion(s, r1)
+
+	s = englishStep0(s)
+	s = englishStep1a(s)
+	if englishInvariants[s] {
+		return s
+	}
+	s = englishStep1b(s, r1)
+	s = englishStep1c(s)
+	s = englishStep2(s, r1)
+	s = englishStep3(s, r1, r2)
+	s = englishStep4(s, r2)
+	s = englishStep5(s, r1, r2)
+
+	return strings.Replace(s, "Y", "y", -1)
+}
+
+func englishStep0(s string) string {
+	for _, suffix := range []string{"'s'", "'s", "'"} {
+		if strings.HasSuffix(s, suffix) {
+			return s[:len(s)-len(suffix)]
+		}
+	}
+	return s
+}
+
+func englishStep1a(s string) string {
+	n := len(s)
+	switch {
+	case strings.HasSuffix(s, "sses"):
+		return s[:n-2]
+	case strings.HasSuffix(s, "ied") || strings.HasSuffix(s, "ies"):
+		// ties becomes tie but cries becomes cri
+		if n > 4 {
+			return s[:n-2]
+		}
+		return s[:n-1]
+	case strings.HasSuffix(s, "us") || strings.HasSuffix(s, "ss"):
+		return s
+	case strings.HasSuffix(s, "s") && n > 2 && containsEnglishVowel(s[:n-2]):
+		// the vowel can not be right before the s e.g. gas and this are left as is
+		return s[:n-1]
+	}
+	return s
+}
+
+func englishStep1b(s string, r1 int) string {
+	for _, suffix := range []string{"eedly", "ingly", "edly", "eed", "ing", "ed"} {
+		if !strings.HasSuffix(s, suffix) {
+			continue
+		}
+		stem := s[:len(s)-len(suffix)]
+		if strings.HasPrefix(suffix, "ee") {
+			if len(stem) >= r1 {
+				return stem + "ee"
+			}
+			return s
+		}
+		if !containsEnglishVowel(stem) {
+			return s
+		}
+
+		switch n := len(stem); {
+		case strings.HasSuffix(stem, "at") || strings.HasSuffix(stem, "bl") || strings.HasSuffix(stem, "iz"):
+			return stem + "e"
+		case n > 1 && stem[n-1] == stem[n-2] && strings.IndexByte("bdfgmnprt", stem[n-1]) >= 0:
+			return stem[:n-1]
+		case r1 >= n && endsWithShortSyllable(stem):
+			// a short word e.g. hoping becomes hope
+			return stem + "e"
+		}
+		return stem
+	}
+	return s
+}
+
+func englishStep1c(s string) string {
+	n := len(s)
+	if n > 2 && (s[n-1] == 'y' || s[n-1] == 'Y') && !isEnglishVowel(s[n-2]) {
+		return s[:n-1] + "i"
+	}
+	return s
+}
+
+func englishStep2(s string, r1 int) string {
+	for _, rule := range englishStep2Rules {
+		if !strings.HasSuffix(s, rule.suffix) {
+			continue
+		}
+		stem := s[:len(s)-len(rule.suffix)]
+		if len(stem) < r1 {
+			return s
+		}
+		switch rule.suffix {
+		case "ogi":
+			if !strings.HasSuffix(stem, "l") {
+				return s
+			}
+		case "li":
+			if len(stem) == 0 || strings.IndexByte("cdeghkmnrt", stem[len(stem)-1]) < 0 {
+				return s
+			}
+		}
+		return stem + rule.replacement
+	}
+	return s
+}
+
+func englishStep3(s string, r1, r2 int) string {
+	for _, rule := range englishStep3Rules {
+		if !strings.HasSuffix(s, rule.suffix) {
+			continue
+		}
+		stem := s[:len(s)-len(rule.suffix)]
+		if len(stem) < r1 || (rule.suffix == "ative" && len(stem) < r2) {
+			return s
+		}
+		return stem + rule.replacement
+	}
+	return s
+}
+
+func englishStep4(s string, r2 int) string {
+	for _, suffix := range englishStep4Suffixes {
+		if !strings.HasSuffix(s, suffix) {
+			continue
+		}
+		stem := s[:len(s)-len(suffix)]
+		if len(stem) < r2 {
+			return s
+		}
+		if suffix == "ion" && !strings.HasSuffix(stem, "s") && !strings.HasSuffix(stem, "t") {
+			return s
+		}
+		return stem
+	}
+	return s
+}
+
+func englishStep5(s string, r1, r2 int) string {
+	n := len(s)
+	switch {
+	case strings.HasSuffix(s, "e"):
+		stem := s[:n-1]
+		if len(stem) >= r2 || (len(stem) >= r1 && !endsWithShortSyllable(stem)) {
+			return stem
+		}
+	case strings.HasSuffix(s, "l"):
+		if n-1 >= r2 && strings.HasSuffix(s[:n-1], "l") {
+			return s[:n-1]
+		}
+	}
+	return s
+}
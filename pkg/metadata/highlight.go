@@ -0,0 +1,266 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	DefaultPreTag  = "<em>"
+	DefaultPostTag = "</em>"
+
+	// fragmentSize is the approximate size of a highlighted fragment in bytes, values that are not longer are
+	// highlighted as a whole.
+	fragmentSize = 100
+
+	// maxFragments is the maximum number of the fragments returned per field.
+	maxFragments = 3
+)
+
+var (
+	// fieldValues maps the search fields to the values of the field in the metadata.
+	fieldValues = map[SearchField]func(*Metadata) []string{
+		titleField:       func(m *Metadata) []string { return []string{m.Title} },
+		versionField:     func(m *Metadata) []string { return []string{m.Version} },
+		companyField:     func(m *Metadata) []string { return []string{m.Company} },
+		websiteField:     func(m *Metadata) []string { return []string{m.Website} },
+		sourceField:      func(m *Metadata) []string { return []string{m.SourceURL} },
+		licenseField:     func(m *Metadata) []string { return []string{m.License} },
+		descriptionField: func(m *Metadata) []string { return []string{m.Description} },
+		nameField: func(m *Metadata) []string {
+			names := make([]string, 0, len(m.Maintainers))
+			for _, maintainer := range m.Maintainers {
+				names = append(names, maintainer.Name)
+			}
+			return names
+		},
+		emailField: func(m *Metadata) []string {
+			emails := make([]string, 0, len(m.Maintainers))
+			for _, maintainer := range m.Maintainers {
+				emails = append(emails, maintainer.Email)
+			}
+			return emails
+		},
+	}
+)
+
+// fieldValuesOf returns the function that extracts the values of the field, either a fixed or a custom field, from the
+// metadata.
+func fieldValuesOf(field SearchField) (func(*Metadata) []string, bool) {
+	if values, ok := fieldValues[field]; ok {
+		return values, true
+	}
+	if custom, ok := currentFields().customFields[field]; ok {
+		return custom.stringValues, true
+	}
+	return nil, false
+}
+
+// HighlightRequest asks for the fragments of the Fields of each hit with the matched terms wrapped in the PreTag and
+// the PostTag (<em> and </em> by default).
+type HighlightRequest struct {
+	Fields  []SearchField `json:"fields" yaml:"fields"`
+	PreTag  string        `json:"pre_tag,omitempty" yaml:"pre_tag,omitempty"`
+	PostTag string        `json:"post_tag,omitempty" yaml:"post_tag,omitempty"`
+}
+
+func (h *HighlightRequest) Validate() error {
+	for _, field := range h.Fields {
+		if _, ok := fieldValuesOf(field); !ok {
+			return validation.NewInternalError(fmt.Errorf(" %s is not a valid highlight field", field))
+		}
+	}
+	return nil
+}
+
+func (h *HighlightRequest) tags() (string, string) {
+	pre, post := h.PreTag, h.PostTag
+	if pre == "" && post == "" {
+		pre, post = DefaultPreTag, DefaultPostTag
+	}
+	return pre, post
+}
+
+// highlightLeaves collects the leaves of the clause by the field, the leaves under the MustNot clauses are skipped as
+// they never match the hits.
+func highlightLeaves(clause *QueryClause, leaves map[SearchField][]*QueryClause) {
+	if clause.isLeaf() {
+		leaves[clause.Field] = append(leaves[clause.Field], clause)
+		return
+	}
+	for _, clauses := range [][]*QueryClause{clause.Must, clause.Should} {
+		for _, c := range clauses {
+			highlightLeaves(c, leaves)
+		}
+	}
+}
+
+// matchesTerm checks if the analyzed leaf matches the term, all the terms of a phrase are matched individually.
+func (c *QueryClause) matchesTerm(term string) bool {
+	switch {
+	case len(c.phraseTerms) > 0:
+		for _, t := range c.phraseTerms {
+			if t == term {
+				return true
+			}
+		}
+		return false
+	case c.Wildcard:
+		return wildcardMatch([]rune(c.Value), []rune(term))
+	case c.Fuzziness > 0:
+		_, ok := levenshtein([]rune(c.Value), []rune(term), c.Fuzziness)
+		return ok
+	}
+	return c.Value == term
+}
+
+// highlight sets the highlighted fragments of the requested fields on the hits, the clause is the analyzed clause
+// that matched the hits.
+func (svc *metadataSearchService) highlight(hits []*MetadataWithID, clause *QueryClause, request *HighlightRequest) {
+	leaves := map[SearchField][]*QueryClause{}
+	highlightLeaves(clause, leaves)
+	pre, post := request.tags()
+
+	for _, hit := range hits {
+		for _, field := range request.Fields {
+			// the any field leaves are already rewritten to the leaves of each field by the analysis
+			fieldLeaves := leaves[field]
+			if len(fieldLeaves) == 0 {
+				continue
+			}
+			matches := func(term string) bool {
+				for _, leaf := range fieldLeaves {
+					if leaf.matchesTerm(term) {
+						return true
+					}
+				}
+				return false
+			}
+
+			values, _ := fieldValuesOf(field)
+			var fragments []string
+			for _, value := range values(hit.Metadata) {
+				tokens := svc.analyzer.AnalyzeFieldTokens(field, value)
+				fragments = append(fragments, highlightValue(value, tokens, matches, pre, post)...)
+			}
+			if len(fragments) > maxFragments {
+				fragments = fragments[:maxFragments]
+			}
+			if len(fragments) > 0 {
+				if hit.Highlight == nil {
+					hit.Highlight = map[SearchField][]string{}
+				}
+				hit.Highlight[field] = fragments
+			}
+		}
+	}
+}
+
+// highlightValue returns the fragments of the value around the matched tokens with the tokens wrapped in the tags, the
+// tokens without the offsets are skipped. A fragment spans about fragmentSize bytes around a match snapped to the word
+// boundaries, the overlapping fragments are merged.
+func highlightValue(value string, tokens TokenStream, matches func(string) bool, pre, post string) []string {
+	var matched TokenStream
+	for _, token := range tokens {
+		if token.hasOffsets() && matches(token.Term) {
+			matched = append(matched, token)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	// a chain of tokenizers can emit the overlapping tokens, keep the earliest of the overlapping ones
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].StartOffset < matched[j].StartOffset })
+	nonOverlapping := matched[:1]
+	for _, token := range matched[1:] {
+		if token.StartOffset >= nonOverlapping[len(nonOverlapping)-1].EndOffset {
+			nonOverlapping = append(nonOverlapping, token)
+		}
+	}
+	matched = nonOverlapping
+
+	if len(value) <= fragmentSize {
+		return []string{wrapTokens(value, 0, len(value), matched, pre, post)}
+	}
+
+	type window struct{ start, end int }
+	var windows []window
+	for _, token := range matched {
+		w := window{
+			start: fragmentStart(value, token.StartOffset-fragmentSize/2, token.StartOffset),
+			end:   fragmentEnd(value, token.EndOffset+fragmentSize/2, token.EndOffset),
+		}
+		if n := len(windows); n > 0 && w.start <= windows[n-1].end {
+			if w.end > windows[n-1].end {
+				windows[n-1].end = w.end
+			}
+			continue
+		}
+		if len(windows) == maxFragments {
+			break
+		}
+		windows = append(windows, w)
+	}
+
+	fragments := make([]string, 0, len(windows))
+	for _, w := range windows {
+		fragments = append(fragments, wrapTokens(value, w.start, w.end, matched, pre, post))
+	}
+	return fragments
+}
+
+// fragmentStart moves the start of a fragment forward to the beginning of a word, never past the match.
+func fragmentStart(value string, start, match int) int {
+	if start <= 0 {
+		return 0
+	}
+	if i := strings.IndexFunc(value[start:match], unicode.IsSpace); i >= 0 {
+		_, size := utf8.DecodeRuneInString(value[start+i:])
+		return start + i + size
+	}
+	for start < match && !utf8.RuneStart(value[start]) {
+		start++
+	}
+	return start
+}
+
+// fragmentEnd moves the end of a fragment back to the end of a word, never before the match.
+func fragmentEnd(value string, end, match int) int {
+	if end >= len(value) {
+		return len(value)
+	}
+	if i := strings.LastIndexFunc(value[match:end], unicode.IsSpace); i >= 0 {
+		return match + i
+	}
+	for end > match && !utf8.RuneStart(value[end]) {
+		end--
+	}
+	return end
+}
+
+// wrapTokens returns value[start:end] with the tokens that are within the range wrapped in the tags.
+func wrapTokens(value string, start, end int, tokens TokenStream, pre, post string) string {
+	var sb strings.Builder
+	cursor := start
+	for _, token := range tokens {
+		if token.StartOffset < cursor || token.EndOffset > end {
+			continue
+		}
+		sb.WriteString(value[cursor:token.StartOffset])
+		sb.WriteString(pre)
+		sb.WriteString(value[token.StartOffset:token.EndOffset])
+		sb.WriteString(post)
+		cursor = token.EndOffset
+	}
+	sb.WriteString(value[cursor:end])
+	return strings.TrimSpace(sb.String())
+}
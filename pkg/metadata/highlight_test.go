@@ -0,0 +1,31 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestHighlightValue(t *testing.T) {
+	matches := func(term string) bool { return term == "cloud" || term == "database" }
+
+	tokens := Tokens(DefaultPerWordTokenizer, "A fast database for the Cloud!")
+	assert.Equal(t, []string{"A fast [database] for the [Cloud]!"}, highlightValue("A fast database for the Cloud!", tokens, matches, "[", "]"))
+
+	long := strings.Repeat("lorem ipsum ", 10) + "cloud native " + strings.Repeat("dolor sit ", 20) + "database"
+	tokens = Tokens(DefaultPerWordTokenizer, long)
+	fragments := highlightValue(long, tokens, matches, "<em>", "</em>")
+	if assert.Len(t, fragments, 2) {
+		assert.Contains(t, fragments[0], "<em>cloud</em> native")
+		assert.True(t, strings.HasSuffix(fragments[1], "<em>database</em>"))
+		for _, fragment := range fragments {
+			assert.True(t, len(fragment) < fragmentSize+len("<em>database</em>"), fragment)
+		}
+	}
+
+	assert.Nil(t, highlightValue("nothing here", Tokens(DefaultPerWordTokenizer, "nothing here"), matches, "<em>", "</em>"))
+}
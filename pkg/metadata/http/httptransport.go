@@ -17,23 +17,52 @@ import (
 	"github.com/vpoliboy/appmeta/pkg/metadata"
 	"gopkg.in/yaml.v2"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
 const (
 	ContentTypeYaml        = "application/x-yaml"
 	ContentTypeJson        = "application/json"
+	ContentTypeMergePatch  = "application/merge-patch+json"
 	NoContentType          = ""
 	ctxKeyMetadataEncoding = "mime"
 	jsonEncoding           = "json"
+
+	paramFrom        = "from"
+	paramSize        = "size"
+	paramSort        = "sort"
+	paramSearchAfter = "search_after"
+	paramQueryString = "q"
+	paramOperator    = "operator"
+	paramAggs        = "aggs"
+	paramHighlight   = "highlight"
+	paramPreTag      = "highlight_pre_tag"
+	paramPostTag     = "highlight_post_tag"
+	paramExplain     = "explain"
+	paramField       = "field"
+	paramPrefix      = "prefix"
 )
 
 var (
 	errUnsupportedMimeType  = newError(http.StatusUnsupportedMediaType).WithMessage("application/x-yaml is the only supported content-type")
 	errInvalidPayloadFormat = newError(http.StatusBadRequest).WithMessage("content does not match metadata schema")
 	errInvalidUUIDinPath    = newError(http.StatusBadRequest).WithMessage("missing or invalid uuid in the request")
+	errInvalidPatchFormat   = newError(http.StatusBadRequest).WithMessage("patch is not a valid merge patch document")
+	errInvalidSearchFormat  = newError(http.StatusBadRequest).WithMessage("content does not match search request schema")
+	errInvalidAnalyzeFormat = newError(http.StatusBadRequest).WithMessage("content does not match analyze request schema")
 )
 
+type updateRequest struct {
+	id       uuid.UUID
+	metadata *metadata.Metadata
+}
+
+type patchRequest struct {
+	id    uuid.UUID
+	patch map[string]interface{}
+}
+
 func MakeHttpHandler(base string, router *mux.Router, middleware mux.MiddlewareFunc, svc metadata.Service, _ *logrus.Logger) http.Handler {
 
 	options := []kithttp.ServerOption{
@@ -80,22 +109,45 @@ func MakeHttpHandler(base string, router *mux.Router, middleware mux.MiddlewareF
 
 	searchHandler := kithttp.NewServer(
 		endpoint.Endpoint(func(ctx context.Context, v interface{}) (interface{}, error) {
-			filters := v.(metadata.Query)
-			if len(filters) == 0 {
-				return svc.GetAll(ctx)
-			}
-			return svc.Search(ctx, filters)
+			return svc.Search(ctx, v.(*metadata.SearchRequest))
+		}),
+		decodeSearchRequestWrapper(true),
+		encodeMetadataResponse,
+		options...,
+	)
+
+	structuredSearchHandler := kithttp.NewServer(
+		endpoint.Endpoint(func(ctx context.Context, v interface{}) (interface{}, error) {
+			return svc.Search(ctx, v.(*metadata.SearchRequest))
+		}),
+		decodeSearchBodyFromRequest,
+		encodeMetadataResponse,
+		options...,
+	)
+
+	suggestHandler := kithttp.NewServer(
+		endpoint.Endpoint(func(ctx context.Context, v interface{}) (interface{}, error) {
+			return svc.Suggest(ctx, v.(*metadata.SuggestRequest))
+		}),
+		decodeSuggestRequest,
+		encodeMetadataResponse,
+		options...,
+	)
+
+	analyzeHandler := kithttp.NewServer(
+		endpoint.Endpoint(func(ctx context.Context, v interface{}) (interface{}, error) {
+			return svc.Analyze(ctx, v.(*metadata.AnalyzeRequest))
 		}),
-		decodeSearchFiltersFromRequest,
+		decodeAnalyzeRequest,
 		encodeMetadataResponse,
 		options...,
 	)
 
 	getAllHandler := kithttp.NewServer(
-		endpoint.Endpoint(func(ctx context.Context, _ interface{}) (interface{}, error) {
-			return svc.GetAll(ctx)
+		endpoint.Endpoint(func(ctx context.Context, v interface{}) (interface{}, error) {
+			return svc.Search(ctx, v.(*metadata.SearchRequest))
 		}),
-		kithttp.NopRequestDecoder,
+		decodeSearchRequestWrapper(false),
 		encodeMetadataResponse,
 		options...,
 	)
@@ -110,20 +162,56 @@ func MakeHttpHandler(base string, router *mux.Router, middleware mux.MiddlewareF
 		options...,
 	)
 
+	updateHandler := kithttp.NewServer(
+		endpoint.Endpoint(func(ctx context.Context, v interface{}) (interface{}, error) {
+			req := v.(*updateRequest)
+			return nil, svc.Update(ctx, req.id, req.metadata)
+		}),
+		decodeUpdateRequest,
+		encodeNoContentResponse,
+		options...,
+	)
+
+	patchHandler := kithttp.NewServer(
+		endpoint.Endpoint(func(ctx context.Context, v interface{}) (interface{}, error) {
+			req := v.(*patchRequest)
+			return nil, svc.Patch(ctx, req.id, req.patch)
+		}),
+		decodePatchRequest,
+		encodeNoContentResponse,
+		options...,
+	)
+
+	deleteHandler := kithttp.NewServer(
+		endpoint.Endpoint(func(ctx context.Context, v interface{}) (interface{}, error) {
+			id := v.(uuid.UUID)
+			return nil, svc.Delete(ctx, id)
+		}),
+		decodeUUIDFromRequestPath,
+		encodeNoContentResponse,
+		options...,
+	)
+
 	healthHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		version := svc.Version()
+		reloadStatus := svc.ReloadStatus()
+
+		// a failed reload leaves the service working with the previous analysis
 		healthStatus := "green"
 		if err := svc.Health(); err != nil {
 			healthStatus = "red"
+		} else if reloadStatus.State == metadata.ReloadStateFailed {
+			healthStatus = "yellow"
 		}
 
 		w.Header().Set("Content-Type", ContentTypeJson)
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(struct {
-			Version string `json:"version"`
-			Health  string `json:"health"`
-		}{version, healthStatus})
+			Version string                `json:"version"`
+			Health  string                `json:"health"`
+			Reload  metadata.ReloadStatus `json:"reload"`
+		}{version, healthStatus, reloadStatus})
 	})
 
 	subRouter := router.PathPrefix(base).Subrouter()
@@ -132,8 +220,14 @@ func MakeHttpHandler(base string, router *mux.Router, middleware mux.MiddlewareF
 	subRouter.Handle("/metadata", middleware(indexHandler)).Methods(http.MethodPost)
 	subRouter.Handle("/metadata", middleware(getAllHandler)).Methods(http.MethodGet)
 	subRouter.Handle("/metadata/_search", middleware(searchHandler)).Methods(http.MethodGet)
+	subRouter.Handle("/metadata/_search", middleware(structuredSearchHandler)).Methods(http.MethodPost)
+	subRouter.Handle("/metadata/_suggest", middleware(suggestHandler)).Methods(http.MethodGet)
 	subRouter.Handle("/metadata/_health", middleware(healthHandler)).Methods(http.MethodGet)
 	subRouter.Handle("/metadata/{uuid}", middleware(getHandler)).Methods(http.MethodGet)
+	subRouter.Handle("/metadata/{uuid}", middleware(updateHandler)).Methods(http.MethodPut)
+	subRouter.Handle("/metadata/{uuid}", middleware(patchHandler)).Methods(http.MethodPatch)
+	subRouter.Handle("/metadata/{uuid}", middleware(deleteHandler)).Methods(http.MethodDelete)
+	subRouter.Handle("/_analyze", middleware(analyzeHandler)).Methods(http.MethodPost)
 
 	subRouter.NotFoundHandler = http.NotFoundHandler()
 	subRouter.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
@@ -178,6 +272,70 @@ func decodeMetadataFromRequest(_ context.Context, r *http.Request) (interface{},
 	return metadata, nil
 }
 
+func decodeUpdateRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeUUIDFromRequestPath(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	m, err := decodeMetadataFromRequest(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return &updateRequest{id.(uuid.UUID), m.(*metadata.Metadata)}, nil
+}
+
+// decodePatchRequest decodes the body as a JSON Merge Patch document, yaml documents are converted to the equivalent
+// json document so that the same merge semantics apply to both.
+func decodePatchRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var (
+		patch map[string]interface{}
+		ok    bool
+	)
+
+	id, err := decodeUUIDFromRequestPath(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := strings.ToLower(r.Header.Get("content-type"))
+	switch contentType {
+	case NoContentType, ContentTypeYaml:
+		var doc interface{}
+		if err = yaml.NewDecoder(r.Body).Decode(&doc); err != nil {
+			return nil, errInvalidPatchFormat
+		}
+		if patch, ok = yamlToJson(doc).(map[string]interface{}); !ok {
+			return nil, errInvalidPatchFormat
+		}
+	case ContentTypeJson, ContentTypeMergePatch:
+		if err = json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+			return nil, errInvalidPatchFormat
+		}
+	default:
+		return nil, errUnsupportedMimeType
+	}
+	return &patchRequest{id.(uuid.UUID), patch}, nil
+}
+
+// yamlToJson converts the map[interface{}]interface{} produced by the yaml decoder to map[string]interface{}
+func yamlToJson(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[fmt.Sprint(k)] = yamlToJson(val)
+		}
+		return m
+	case []interface{}:
+		for i, val := range t {
+			t[i] = yamlToJson(val)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
 func encodeIndexResponseWrapper(resourceBase string) kithttp.EncodeResponseFunc {
 	return kithttp.EncodeResponseFunc(func(_ context.Context, w http.ResponseWriter, v interface{}) error {
 		id := v.(uuid.UUID)
@@ -187,16 +345,182 @@ func encodeIndexResponseWrapper(resourceBase string) kithttp.EncodeResponseFunc
 	})
 }
 
-func decodeSearchFiltersFromRequest(_ context.Context, r *http.Request) (interface{}, error) {
-	query := metadata.Query{}
+func encodeNoContentResponse(_ context.Context, w http.ResponseWriter, _ interface{}) error {
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// searchBody is the body of the POST search request.
+type searchBody struct {
+	Query       *metadata.QueryClause `json:"query" yaml:"query"`
+	QueryString string                `json:"q" yaml:"q"`
+	Operator    string                `json:"operator" yaml:"operator"`
+	From        int                   `json:"from" yaml:"from"`
+	Size        *int                  `json:"size" yaml:"size"`
+	Sort        string                `json:"sort" yaml:"sort"`
+	SearchAfter string                `json:"search_after" yaml:"search_after"`
+
+	Aggs      map[string]*metadata.Aggregation `json:"aggs" yaml:"aggs"`
+	Highlight *metadata.HighlightRequest       `json:"highlight" yaml:"highlight"`
+	Explain   bool                             `json:"explain" yaml:"explain"`
+}
+
+// decodeSearchBodyFromRequest decodes the structured search request from the json or yaml body
+func decodeSearchBodyFromRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var (
+		body = &searchBody{}
+		err  error
+	)
+
+	contentType := strings.ToLower(r.Header.Get("content-type"))
+	switch contentType {
+	case NoContentType, ContentTypeYaml:
+		if err = yaml.NewDecoder(r.Body).Decode(body); err != nil {
+			return nil, errInvalidSearchFormat
+		}
+	case ContentTypeJson:
+		if err = json.NewDecoder(r.Body).Decode(body); err != nil {
+			return nil, errInvalidSearchFormat
+		}
+	default:
+		return nil, errUnsupportedMimeType
+	}
+
+	request := &metadata.SearchRequest{
+		Clause:      body.Query,
+		QueryString: body.QueryString,
+		Operator:    body.Operator,
+		From:        body.From,
+		Size:        metadata.DefaultPageSize,
+		SearchAfter: body.SearchAfter,
+		Aggs:        body.Aggs,
+		Highlight:   body.Highlight,
+		Explain:     body.Explain,
+	}
+	if body.Size != nil {
+		request.Size = *body.Size
+	}
+	if request.Sort, err = metadata.ParseSort(body.Sort); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// decodeAnalyzeRequest decodes the field or the tokenizer along with the text to analyze from the json or yaml body
+func decodeAnalyzeRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var (
+		request = &metadata.AnalyzeRequest{}
+		err     error
+	)
+
+	contentType := strings.ToLower(r.Header.Get("content-type"))
+	switch contentType {
+	case NoContentType, ContentTypeYaml:
+		if err = yaml.NewDecoder(r.Body).Decode(request); err != nil {
+			return nil, errInvalidAnalyzeFormat
+		}
+	case ContentTypeJson:
+		if err = json.NewDecoder(r.Body).Decode(request); err != nil {
+			return nil, errInvalidAnalyzeFormat
+		}
+	default:
+		return nil, errUnsupportedMimeType
+	}
+	return request, nil
+}
+
+// decodeSuggestRequest decodes the field, prefix and size query params of the suggest request
+func decodeSuggestRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var err error
 
 	queryParams := r.URL.Query()
-	for k, v := range queryParams {
-		if len(v) > 0 {
-			query[metadata.SearchField(k)] = v[0]
+	request := &metadata.SuggestRequest{
+		Field:  metadata.SearchField(queryParams.Get(paramField)),
+		Prefix: queryParams.Get(paramPrefix),
+		Size:   metadata.DefaultSuggestSize,
+	}
+	if v := queryParams.Get(paramSize); v != "" {
+		if request.Size, err = strconv.Atoi(v); err != nil {
+			return nil, newError(http.StatusBadRequest).WithMessage("size: must be a number")
+		}
+	}
+	return request, nil
+}
+
+// decodeHighlight decodes the comma separated list of the fields to highlight
+func decodeHighlight(fields, preTag, postTag string) *metadata.HighlightRequest {
+	highlight := &metadata.HighlightRequest{PreTag: preTag, PostTag: postTag}
+	for _, field := range strings.Split(fields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			highlight.Fields = append(highlight.Fields, metadata.SearchField(field))
 		}
 	}
-	return query, nil
+	return highlight
+}
+
+// decodeSearchRequestWrapper decodes the pagination and sort query params along with the lucene like query string in
+// the q param, rest of the query params are decoded as the search filters if withFilters is set. Each value of a
+// repeated filter has to match.
+func decodeSearchRequestWrapper(withFilters bool) kithttp.DecodeRequestFunc {
+	return kithttp.DecodeRequestFunc(func(_ context.Context, r *http.Request) (interface{}, error) {
+		var (
+			err     error
+			filters []*metadata.QueryClause
+		)
+
+		request := &metadata.SearchRequest{Size: metadata.DefaultPageSize}
+
+		queryParams := r.URL.Query()
+		for k, v := range queryParams {
+			if len(v) == 0 {
+				continue
+			}
+			switch k {
+			case paramFrom:
+				if request.From, err = strconv.Atoi(v[0]); err != nil {
+					return nil, newError(http.StatusBadRequest).WithMessage("from: must be a number")
+				}
+			case paramSize:
+				if request.Size, err = strconv.Atoi(v[0]); err != nil {
+					return nil, newError(http.StatusBadRequest).WithMessage("size: must be a number")
+				}
+			case paramSort:
+				if request.Sort, err = metadata.ParseSort(v[0]); err != nil {
+					return nil, err
+				}
+			case paramSearchAfter:
+				request.SearchAfter = v[0]
+			case paramOperator:
+				request.Operator = v[0]
+			case paramAggs:
+				if request.Aggs, err = metadata.ParseAggs(v[0]); err != nil {
+					return nil, err
+				}
+			case paramHighlight:
+				request.Highlight = decodeHighlight(v[0], queryParams.Get(paramPreTag), queryParams.Get(paramPostTag))
+			case paramPreTag, paramPostTag:
+			case paramExplain:
+				if request.Explain, err = strconv.ParseBool(v[0]); err != nil {
+					return nil, newError(http.StatusBadRequest).WithMessage("explain: must be a boolean")
+				}
+			case paramQueryString:
+				if withFilters {
+					request.QueryString = v[0]
+				}
+			default:
+				if !withFilters {
+					continue
+				}
+				for _, value := range v {
+					filters = append(filters, metadata.TermClause(metadata.SearchField(k), value))
+				}
+			}
+		}
+		if len(filters) > 0 {
+			request.Clause = metadata.AllOf(filters...)
+		}
+		return request, nil
+	})
 }
 
 func encodeMetadataResponse(ctx context.Context, w http.ResponseWriter, v interface{}) error {
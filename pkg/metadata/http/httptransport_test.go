@@ -6,6 +6,9 @@ package http
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -13,6 +16,8 @@ import (
 	"gopkg.in/yaml.v2"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 )
 
@@ -55,11 +60,11 @@ description: |
 	res, err = http.Get(server.URL + "/metadata/_search?name=vijayx")
 	assert.Nil(t, err)
 	assert.Equal(t, http.StatusOK, res.StatusCode)
-	var hits []metadata.MetadataWithID
+	var hits metadata.SearchResponse
 
 	err = yaml.NewDecoder(res.Body).Decode(&hits)
 	assert.Nil(t, err)
-	assert.Len(t, hits, 0)
+	assert.Len(t, hits.Hits, 0)
 	res.Body.Close()
 
 	res, err = http.Get(server.URL + "/metadata/_search?name=vijay")
@@ -67,6 +72,902 @@ description: |
 	assert.Equal(t, http.StatusOK, res.StatusCode)
 	err = yaml.NewDecoder(res.Body).Decode(&hits)
 	assert.Nil(t, err)
-	assert.Len(t, hits, 1)
+	assert.Len(t, hits.Hits, 1)
 	res.Body.Close()
 }
+
+func TestDelete(t *testing.T) {
+
+	logger := logrus.New()
+	service := metadata.NewService(logger)
+	handler := MakeHttpHandler("", mux.NewRouter(), nopMiddleware, service, logger)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	m1 := []byte(`title: Valid App 2
+version: 1.0.1
+maintainers:
+- name: Vijay Poliboyina
+  email: apptwo@hotmail.com
+company: Upbound Inc.
+website: https://upbound.io
+source: https://github.com/upbound/repo
+license: Apache-2.0
+description: |
+ ### Why app 2 is the best
+ Because it simply is...`)
+
+	res, err := http.Post(server.URL+"/metadata", ContentTypeYaml, bytes.NewReader(m1))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	location := res.Header.Get("Location")
+	res.Body.Close()
+
+	req, err := http.NewRequest(http.MethodDelete, server.URL+location, nil)
+	assert.Nil(t, err)
+	res, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	res.Body.Close()
+
+	res, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	res.Body.Close()
+
+	res, err = http.Get(server.URL + "/metadata/_search?name=vijay")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	var hits metadata.SearchResponse
+	err = yaml.NewDecoder(res.Body).Decode(&hits)
+	assert.Nil(t, err)
+	assert.Len(t, hits.Hits, 0)
+	res.Body.Close()
+}
+
+func TestUpdateAndPatch(t *testing.T) {
+
+	logger := logrus.New()
+	service := metadata.NewService(logger)
+	handler := MakeHttpHandler("", mux.NewRouter(), nopMiddleware, service, logger)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	m1 := []byte(`title: Valid App 2
+version: 1.0.1
+maintainers:
+- name: Vijay Poliboyina
+  email: apptwo@hotmail.com
+company: Upbound Inc.
+website: https://upbound.io
+source: https://github.com/upbound/repo
+license: Apache-2.0
+description: |
+ ### Why app 2 is the best
+ Because it simply is...`)
+
+	res, err := http.Post(server.URL+"/metadata", ContentTypeYaml, bytes.NewReader(m1))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	location := res.Header.Get("Location")
+	res.Body.Close()
+
+	m2 := bytes.Replace(m1, []byte("Upbound Inc."), []byte("Feye Inc."), 1)
+	req, err := http.NewRequest(http.MethodPut, server.URL+location, bytes.NewReader(m2))
+	assert.Nil(t, err)
+	res, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	res.Body.Close()
+
+	req, err = http.NewRequest(http.MethodPatch, server.URL+location, bytes.NewReader([]byte(`{"license": "MIT-0"}`)))
+	assert.Nil(t, err)
+	req.Header.Set("Content-Type", ContentTypeMergePatch)
+	res, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	res.Body.Close()
+
+	// the patched document has to go through the same validation
+	req, err = http.NewRequest(http.MethodPatch, server.URL+location, bytes.NewReader([]byte(`license: null`)))
+	assert.Nil(t, err)
+	req.Header.Set("Content-Type", ContentTypeYaml)
+	res, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res.Body.Close()
+
+	res, err = http.Get(server.URL + location)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	var hit metadata.MetadataWithID
+	err = yaml.NewDecoder(res.Body).Decode(&hit)
+	assert.Nil(t, err)
+	assert.Equal(t, "Feye Inc.", hit.Company)
+	assert.Equal(t, "MIT-0", hit.License)
+	res.Body.Close()
+
+	res, err = http.Get(server.URL + "/metadata/_search?company=upbound")
+	assert.Nil(t, err)
+	var hits metadata.SearchResponse
+	err = yaml.NewDecoder(res.Body).Decode(&hits)
+	assert.Nil(t, err)
+	assert.Len(t, hits.Hits, 0)
+	res.Body.Close()
+}
+
+func TestSearchPagination(t *testing.T) {
+
+	logger := logrus.New()
+	service := metadata.NewService(logger)
+	handler := MakeHttpHandler("", mux.NewRouter(), nopMiddleware, service, logger)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	for _, version := range []string{"1.10.0", "1.2.0", "1.9.1", "2.0.0-rc.1", "2.0.0"} {
+		m := []byte(`title: Valid App
+version: ` + version + `
+maintainers:
+- name: Vijay Poliboyina
+  email: apptwo@hotmail.com
+company: Upbound Inc.
+website: https://upbound.io
+source: https://github.com/upbound/repo
+license: Apache-2.0
+description: Because it simply is`)
+		res, err := http.Post(server.URL+"/metadata", ContentTypeYaml, bytes.NewReader(m))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+		res.Body.Close()
+	}
+
+	var (
+		versions []string
+		cursor   string
+	)
+	for i := 0; i < 3; i++ {
+		res, err := http.Get(server.URL + "/metadata/_search?name=vijay&sort=-version&size=2&search_after=" + cursor)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		var page metadata.SearchResponse
+		err = yaml.NewDecoder(res.Body).Decode(&page)
+		assert.Nil(t, err)
+		res.Body.Close()
+
+		assert.Equal(t, 5, page.Total)
+		for _, hit := range page.Hits {
+			versions = append(versions, hit.Version)
+		}
+		cursor = page.Next
+	}
+	assert.Equal(t, []string{"2.0.0", "2.0.0-rc.1", "1.10.0", "1.9.1", "1.2.0"}, versions)
+	assert.Empty(t, cursor)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/metadata?from=4&size=2&sort=version", nil)
+	assert.Nil(t, err)
+	req.Header.Set("Accept", ContentTypeJson)
+	res, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, ContentTypeJson, res.Header.Get("Content-Type"))
+	var page metadata.SearchResponse
+	err = json.NewDecoder(res.Body).Decode(&page)
+	assert.Nil(t, err)
+	res.Body.Close()
+	assert.Equal(t, 5, page.Total)
+	if assert.Len(t, page.Hits, 1) {
+		assert.Equal(t, "2.0.0", page.Hits[0].Version)
+	}
+
+	for _, query := range []string{"size=-1", "size=x", "sort=maintainers", "search_after=garbage", "from=1&search_after=abc"} {
+		res, err = http.Get(server.URL + "/metadata?" + query)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, query)
+		res.Body.Close()
+	}
+}
+
+func TestBooleanSearch(t *testing.T) {
+
+	logger := logrus.New()
+	service := metadata.NewService(logger)
+	handler := MakeHttpHandler("", mux.NewRouter(), nopMiddleware, service, logger)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	for _, v := range []struct{ title, name, company string }{
+		{"Valid App", "Vijay Poliboyina", "Upbound Inc."},
+		{"Other App", "John Doe", "Upbound Inc."},
+		{"Legacy App", "Jane Doe", "Feye Inc."},
+	} {
+		m := []byte(`title: ` + v.title + `
+version: 1.0.1
+maintainers:
+- name: ` + v.name + `
+  email: apptwo@hotmail.com
+company: ` + v.company + `
+website: https://upbound.io
+source: https://github.com/upbound/repo
+license: Apache-2.0
+description: Because it simply is`)
+		res, err := http.Post(server.URL+"/metadata", ContentTypeYaml, bytes.NewReader(m))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+		res.Body.Close()
+	}
+
+	decode := func(res *http.Response, err error) metadata.SearchResponse {
+		var page metadata.SearchResponse
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Nil(t, yaml.NewDecoder(res.Body).Decode(&page))
+		res.Body.Close()
+		return page
+	}
+
+	// repeated filters have to match all the values
+	page := decode(http.Get(server.URL + "/metadata/_search?name=doe&name=jane"))
+	assert.Equal(t, 1, page.Total)
+
+	page = decode(http.Get(server.URL + "/metadata/_search?q=" + url.QueryEscape(`license:apache-2.0 AND (name:vijay OR company:feye) -title:"legacy app"`)))
+	if assert.Equal(t, 1, page.Total) {
+		assert.Equal(t, "Valid App", page.Hits[0].Title)
+	}
+
+	body := []byte(`{
+  "query": {
+    "must": [{"field": "license", "value": "apache-2.0"}],
+    "should": [{"field": "name", "value": "doe"}, {"field": "company", "value": "upbound"}],
+    "minimum_should_match": 2
+  },
+  "size": 5
+}`)
+	page = decode(http.Post(server.URL+"/metadata/_search", ContentTypeJson, bytes.NewReader(body)))
+	if assert.Equal(t, 1, page.Total) {
+		assert.Equal(t, "Other App", page.Hits[0].Title)
+	}
+
+	// aggregations over the whole catalog and within a search
+	page = decode(http.Get(server.URL + "/metadata/_search?size=0&aggs=" + url.QueryEscape("company:1,license,version_histogram:minor")))
+	assert.Equal(t, 3, page.Total)
+	assert.Empty(t, page.Hits)
+	assert.Equal(t, &metadata.AggregationResult{Buckets: []metadata.Bucket{{Key: "inc.", Count: 3}}, Other: 3}, page.Aggs["company"])
+	assert.Equal(t, &metadata.AggregationResult{Buckets: []metadata.Bucket{{Key: "apache-2.0", Count: 3}}}, page.Aggs["license"])
+	assert.Equal(t, &metadata.AggregationResult{Buckets: []metadata.Bucket{{Key: "1.0.x", Count: 3}}}, page.Aggs["version_histogram"])
+
+	body = []byte(`{
+  "q": "name:doe",
+  "aggs": {"companies": {"terms": {"field": "company"}}}
+}`)
+	page = decode(http.Post(server.URL+"/metadata/_search", ContentTypeJson, bytes.NewReader(body)))
+	assert.Equal(t, &metadata.AggregationResult{Buckets: []metadata.Bucket{{Key: "inc.", Count: 2}, {Key: "feye", Count: 1}, {Key: "upbound", Count: 1}}}, page.Aggs["companies"])
+
+	for _, body := range []string{`{"query": {"field": "unknown", "value": "x"}}`, `{"q": "name:(vijay"}`, `{"query": {"should": [{"field": "name", "value": "doe"}], "minimum_should_match": 2}}`,
+		`{"aggs": {"x": {"terms": {"field": "any"}}}}`, `{"aggs": {"x": {}}}`, `{"aggs": {"x": {"semver_histogram": {"interval": "patch"}}}}`} {
+		res, err := http.Post(server.URL+"/metadata/_search", ContentTypeJson, bytes.NewReader([]byte(body)))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, body)
+		res.Body.Close()
+	}
+}
+
+// newTestServer serves a new service with the options, the caller closes it.
+func newTestServer(t *testing.T, opts ...metadata.ServiceOption) *httptest.Server {
+	logger := logrus.New()
+	service := metadata.NewService(logger, opts...)
+	return httptest.NewServer(MakeHttpHandler("", mux.NewRouter(), nopMiddleware, service, logger))
+}
+
+// withTokenizers maps the fields to the built-in tokenizers of the service except for the overridden ones.
+func withTokenizers(overrides map[metadata.SearchField]metadata.Tokenizer) metadata.ServiceOption {
+	mappings := map[metadata.SearchField]metadata.Tokenizer{
+		"title":       metadata.DefaultExactMatchTokenizer,
+		"version":     metadata.DefaultSemverTokenizer,
+		"company":     metadata.DefaultPerWordTokenizer,
+		"website":     metadata.DefaultURLTokenizer,
+		"source":      metadata.DefaultURLTokenizer,
+		"license":     metadata.DefaultExactMatchTokenizer,
+		"description": metadata.DefaultPerWordTokenizer,
+		"name":        metadata.TokenizerChain(metadata.DefaultPerWordTokenizer, metadata.DefaultExactMatchTokenizer),
+		"email":       metadata.DefaultEmailTokenizer,
+	}
+	for field, tokenizer := range overrides {
+		mappings[field] = tokenizer
+	}
+	return metadata.WithMappings(mappings)
+}
+
+// testApp is the metadata indexed by the search tests, the fields that are left empty are the ones of a valid app.
+type testApp struct {
+	title, version, email, company, website, source, license, description string
+}
+
+func (app testApp) yaml() string {
+	or := func(value, fallback string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	}
+	return `title: ` + or(app.title, "Valid App") + `
+version: ` + or(app.version, "1.0.1") + `
+maintainers:
+- name: Vijay Poliboyina
+  email: ` + or(app.email, "apptwo@hotmail.com") + `
+company: ` + or(app.company, "Upbound Inc.") + `
+website: ` + or(app.website, "https://upbound.io") + `
+source: ` + or(app.source, "https://github.com/upbound/repo") + `
+license: ` + or(app.license, "Apache-2.0") + `
+description: ` + or(app.description, "A valid app")
+}
+
+// indexApps posts the yaml payloads to the server.
+func indexApps(t *testing.T, serverURL string, yamls ...string) {
+	for _, m := range yamls {
+		res, err := http.Post(serverURL+"/metadata", ContentTypeYaml, strings.NewReader(m))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+		res.Body.Close()
+	}
+}
+
+// search gets the search results of the url encoded query.
+func search(t *testing.T, serverURL string, query string) metadata.SearchResponse {
+	res, err := http.Get(serverURL + "/metadata/_search?" + query)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode, query)
+	var page metadata.SearchResponse
+	assert.Nil(t, yaml.NewDecoder(res.Body).Decode(&page))
+	res.Body.Close()
+	return page
+}
+
+// assertTotals asserts the total hits of each of the url encoded queries.
+func assertTotals(t *testing.T, serverURL string, totals map[string]int) {
+	for query, expected := range totals {
+		assert.Equal(t, expected, search(t, serverURL, query).Total, query)
+	}
+}
+
+func TestQueryAnalysis(t *testing.T) {
+
+	server := newTestServer(t)
+	defer server.Close()
+
+	indexApps(t, server.URL,
+		testApp{description: "A fast database for the cloud"}.yaml(),
+		testApp{description: "A fast cache in front of the slow database"}.yaml())
+
+	assertTotals(t, server.URL, map[string]int{
+		"description=" + url.QueryEscape("Fast Database"):                     2,
+		"description=" + url.QueryEscape("fast database cloud"):               1,
+		"description=" + url.QueryEscape("cloud cache") + "&operator=or":      2,
+		"q=" + url.QueryEscape(`description:"fast database"`):                 1,
+		"q=" + url.QueryEscape(`description:"database fast"`):                 0,
+		"q=" + url.QueryEscape(`description:"database fast"~2`):               1,
+		"q=" + url.QueryEscape(`description:"fast database"~5`):               1,
+		"q=" + url.QueryEscape(`description:"fast database"~6`):               2,
+		"q=" + url.QueryEscape(`description:"fast database for the cloud"`):   1,
+		"q=" + url.QueryEscape(`description:"fast database cloud"`):           0,
+		"q=" + url.QueryEscape(`"slow database" AND name:"vijay poliboyina"`): 1,
+		"any=" + url.QueryEscape("Fast Cloud"):                                1,
+		"title=valid":                                                         0,
+		"title=" + url.QueryEscape("val*"):                                    2,
+		"name=" + url.QueryEscape("VIJ*"):                                     2,
+		"description=" + url.QueryEscape("*base"):                             2,
+		"company=" + url.QueryEscape("upbnd~1"):                               0,
+		"company=" + url.QueryEscape("upbnd~2"):                               2,
+		"company=" + url.QueryEscape("upbnd~"):                                2,
+		"q=" + url.QueryEscape("description:clowd~1 AND cach*"):               0,
+		"q=" + url.QueryEscape("description:clowd~1 OR cach*"):                2,
+	})
+
+	page := search(t, server.URL, "highlight=description,name&q="+url.QueryEscape(`description:"slow database" vijay`))
+	if assert.Len(t, page.Hits, 1) {
+		assert.Equal(t, map[metadata.SearchField][]string{
+			"description": {"A fast cache in front of the <em>slow</em> <em>database</em>"},
+			"name":        {"<em>Vijay</em> Poliboyina"},
+		}, page.Hits[0].Highlight)
+	}
+
+	body := []byte(`{"q": "description:fast", "highlight": {"fields": ["description", "title"], "pre_tag": "**", "post_tag": "**"}}`)
+	res, err := http.Post(server.URL+"/metadata/_search", ContentTypeJson, bytes.NewReader(body))
+	assert.Nil(t, err)
+	page = metadata.SearchResponse{}
+	assert.Nil(t, yaml.NewDecoder(res.Body).Decode(&page))
+	res.Body.Close()
+	if assert.Len(t, page.Hits, 2) {
+		for _, hit := range page.Hits {
+			assert.Equal(t, "A **fast** ", hit.Highlight["description"][0][:11])
+			assert.NotContains(t, hit.Highlight, metadata.SearchField("title"))
+		}
+	}
+
+	for _, query := range []string{"description=fast&operator=xor", "highlight=unknown&q=fast", "company=" + url.QueryEscape("upbnd~3"), "q=" + url.QueryEscape("company:up*~1")} {
+		res, err := http.Get(server.URL + "/metadata/_search?" + query)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, query)
+		res.Body.Close()
+	}
+}
+
+func TestSuggest(t *testing.T) {
+
+	server := newTestServer(t)
+	defer server.Close()
+
+	for _, title := range []string{"Valid App", "Valid App", "Validator", "Other App"} {
+		indexApps(t, server.URL, testApp{title: title, description: "App metadata"}.yaml())
+	}
+
+	testCases := map[string][]metadata.Suggestion{
+		"field=title&prefix=val":        {{Text: "Valid App", Count: 2}, {Text: "Validator", Count: 1}},
+		"field=title&prefix=val&size=1": {{Text: "Valid App", Count: 2}},
+		"field=company&prefix=UP":       {{Text: "Upbound Inc.", Count: 4}},
+		"field=name&prefix=vijay%20p":   {{Text: "Vijay Poliboyina", Count: 4}},
+		"field=title&prefix=xyz":        {},
+	}
+
+	for query, expected := range testCases {
+		res, err := http.Get(server.URL + "/metadata/_suggest?" + query)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode, query)
+		var suggestions metadata.SuggestResponse
+		assert.Nil(t, yaml.NewDecoder(res.Body).Decode(&suggestions))
+		res.Body.Close()
+		assert.ElementsMatch(t, expected, suggestions.Suggestions, query)
+	}
+
+	for _, query := range []string{"field=description&prefix=a", "field=title&prefix=a&size=0", "field=title&size=x"} {
+		res, err := http.Get(server.URL + "/metadata/_suggest?" + query)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, query)
+		res.Body.Close()
+	}
+}
+
+func TestStemming(t *testing.T) {
+
+	stemming := metadata.NewStandardTokenizer(metadata.WithStemmer(metadata.Stemmers[metadata.EnglishStemmer]))
+	server := newTestServer(t, withTokenizers(map[metadata.SearchField]metadata.Tokenizer{
+		"company":     stemming,
+		"description": stemming,
+	}))
+	defer server.Close()
+
+	for title, description := range map[string]string{
+		"cache":  "A cache in front of the slow databases",
+		"cached": "Serves the cached pages",
+		"proxy":  "Connection pooling proxy",
+	} {
+		indexApps(t, server.URL, testApp{title: title, company: "Caching Solutions", description: description}.yaml())
+	}
+
+	assertTotals(t, server.URL, map[string]int{
+		"description=caching":  2,
+		"description=CACHED":   2,
+		"description=database": 1,
+		"description=pools":    1,
+		"company=cache":        3,
+		"company=solution":     3,
+		"q=" + url.QueryEscape(`description:"slow database"`):   1,
+		"q=" + url.QueryEscape(`description:"caching pages"~1`): 1,
+	})
+
+	// the whole stemmed words are highlighted
+	highlights := []string{}
+	for _, hit := range search(t, server.URL, "highlight=description&description=caching").Hits {
+		highlights = append(highlights, hit.Highlight["description"]...)
+	}
+	assert.ElementsMatch(t, []string{"A <em>cache</em> in front of the slow databases", "Serves the <em>cached</em> pages"}, highlights)
+}
+
+func TestSynonyms(t *testing.T) {
+
+	synonyms, err := metadata.ParseSynonyms(strings.NewReader("k8s, kubernetes\npg, postgres, postgresql\nmit, mit-license"), true)
+	assert.Nil(t, err)
+
+	server := newTestServer(t, withTokenizers(map[metadata.SearchField]metadata.Tokenizer{
+		"license": metadata.NewAnalysisPipeline(metadata.DefaultExactMatchTokenizer,
+			metadata.WithTokenFilters(metadata.InPhase(metadata.NewSynonymTokenFilter(synonyms), metadata.AnalysisPhaseQuery))),
+		"description": metadata.NewStandardTokenizer(
+			metadata.WithSynonyms(synonyms, metadata.AnalysisPhaseQuery),
+			metadata.WithStemmer(metadata.Stemmers[metadata.EnglishStemmer])),
+	}))
+	defer server.Close()
+
+	indexApps(t, server.URL,
+		testApp{title: "operator", license: "mit-license", description: "Kubernetes operator for Postgres clusters"}.yaml(),
+		testApp{title: "dashboard", license: "BSD-3-Clause", description: "Dashboard for k8s clusters"}.yaml(),
+		testApp{title: "backup", license: "Apache-2.0", description: "Backups of PostgreSQL databases"}.yaml())
+
+	assertTotals(t, server.URL, map[string]int{
+		"description=k8s":                               2,
+		"description=kubernetes":                        2,
+		"description=pg":                                2,
+		"description=" + url.QueryEscape("pg clusters"): 1,
+		"description=" + url.QueryEscape("pg clusters") + "&operator=or": 3,
+		"license=mit":         1,
+		"license=MIT-License": 1,
+		"q=" + url.QueryEscape(`description:"k8s operator"`):    1,
+		"q=" + url.QueryEscape(`description:"k8s clusters"`):    1,
+		"q=" + url.QueryEscape(`description:"operator for pg"`): 1,
+	})
+}
+
+func TestWildcardAnalysis(t *testing.T) {
+
+	server := newTestServer(t, withTokenizers(map[metadata.SearchField]metadata.Tokenizer{
+		"description": metadata.NewStandardTokenizer(metadata.WithASCIIFolding(),
+			metadata.WithStemmer(metadata.Stemmers[metadata.EnglishStemmer])),
+	}))
+	defer server.Close()
+
+	indexApps(t, server.URL,
+		testApp{description: "José indexes the databases"}.yaml(),
+		testApp{description: "Jose caches the queries"}.yaml())
+
+	// the literal segments of the patterns are normalized, folded and stemmed like the indexed terms
+	assertTotals(t, server.URL, map[string]int{
+		"description=" + url.QueryEscape("jos*"):       2,
+		"description=" + url.QueryEscape("JOSÉ*"):      2,
+		"description=" + url.QueryEscape("ｊｏｓé*"):      2,
+		"description=" + url.QueryEscape("databases*"): 1,
+		"description=" + url.QueryEscape("Caches*"):    1,
+		"description=" + url.QueryEscape("i?dexes"):    1,
+		"name=" + url.QueryEscape("VIJ*"):              2,
+	})
+}
+
+func TestIndexTimeSynonyms(t *testing.T) {
+
+	synonyms, err := metadata.ParseSynonyms(strings.NewReader("k8s, kubernetes"), true)
+	assert.Nil(t, err)
+
+	server := newTestServer(t, withTokenizers(map[metadata.SearchField]metadata.Tokenizer{
+		"description": metadata.NewStandardTokenizer(metadata.WithSynonyms(synonyms, metadata.AnalysisPhaseIndex)),
+	}))
+	defer server.Close()
+
+	indexApps(t, server.URL, testApp{title: "operator", description: "k8s operator for postgres"}.yaml())
+
+	// the synonyms are indexed on the position of the original term, so the phrases match with either of them
+	assertTotals(t, server.URL, map[string]int{
+		"q=" + url.QueryEscape(`description:"k8s operator"`):                 1,
+		"q=" + url.QueryEscape(`description:"kubernetes operator"`):          1,
+		"q=" + url.QueryEscape(`description:"kubernetes operator postgres"`): 0,
+		"q=" + url.QueryEscape(`description:"operator kubernetes"`):          0,
+	})
+}
+
+func TestNGramSearch(t *testing.T) {
+
+	server := newTestServer(t, withTokenizers(map[metadata.SearchField]metadata.Tokenizer{
+		"title": metadata.NewNGramTokenizer(3, 3, metadata.WithTokenChars(metadata.TokenCharClasses["letter"], metadata.TokenCharClasses["digit"])),
+		"email": metadata.NewEdgeNGramTokenizer(2, 20),
+	}))
+	defer server.Close()
+
+	for title, email := range map[string]string{
+		"appmeta-server": "vijay@hotmail.com",
+		"appmeta-client": "vpoliboy@gmail.com",
+		"upbound-server": "ops@upbound.io",
+	} {
+		indexApps(t, server.URL, testApp{title: title, email: email}.yaml())
+	}
+
+	assertTotals(t, server.URL, map[string]int{
+		"title=server":            2,
+		"title=meta":              2,
+		"title=appmeta-server":    1,
+		"title=Client":            1,
+		"title=clients":           0,
+		"email=vp":                1,
+		"email=vijay@hotmail.com": 1,
+		"email=ops@":              1,
+		"email=gmail":             0,
+	})
+}
+
+func TestIdentifierSearch(t *testing.T) {
+
+	server := newTestServer(t)
+	defer server.Close()
+
+	indexApps(t, server.URL,
+		testApp{title: "operator", version: "1.0.1", email: "vijay@hotmail.com",
+			website: "https://upbound.io/operator?tab=docs", source: "https://github.com/upbound/operator"}.yaml(),
+		testApp{title: "dashboard", version: "1.1.0-rc.1", email: "ops@upbound.io",
+			website: "https://upbound.io/dashboard/tab=docs", source: "https://github.com/upbound/dashboard"}.yaml(),
+		testApp{title: "backup", version: "2.0.0", email: "vpoliboy@gmail.com",
+			website: "https://upbound.io", source: "https://gitlab.com/vpoliboy/backup"}.yaml())
+
+	assertTotals(t, server.URL, map[string]int{
+		"source=github.com/upbound":                                        2,
+		"source=" + url.QueryEscape("https://github.com/upbound/operator"): 1,
+		"source=gitlab.com":                                                1,
+		"source=github":                                                    2,
+		"website=upbound.io":                                               3,
+		// an escaped ? is literal, the unescaped one is a wildcard
+		"website=" + url.QueryEscape(`https://upbound.io/operator\?tab=docs`):  1,
+		"website=" + url.QueryEscape(`https://upbound.io/dashboard\?tab=docs`): 0,
+		"website=" + url.QueryEscape("https://upbound.io/dashboard?tab=docs"):  1,
+		"website=" + url.QueryEscape(`https://upbound.io/*?tab=docs`):          2,
+		"email=hotmail.com": 1,
+		"email=vijay":       1,
+		"email=" + url.QueryEscape("ops@upbound.io"): 1,
+		"version=1":      2,
+		"version=1.0":    1,
+		"version=v1.0.1": 1,
+		"version=rc.1":   1,
+		"version=2.0":    1,
+		"version=3":      0,
+	})
+
+	// the histogram still buckets the versions
+	page := search(t, server.URL, "size=0&aggs=version_histogram")
+	assert.Equal(t, &metadata.AggregationResult{Buckets: []metadata.Bucket{{Key: "1.x", Count: 2}, {Key: "2.x", Count: 1}}}, page.Aggs["version_histogram"])
+}
+
+func TestAnalyze(t *testing.T) {
+
+	logger := logrus.New()
+	service := metadata.NewService(logger, metadata.WithTokenizers(map[string]metadata.Tokenizer{
+		"Grams": metadata.NewNGramTokenizer(2, 3),
+	}))
+	handler := MakeHttpHandler("", mux.NewRouter(), nopMiddleware, service, logger)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	analyze := func(body string) (int, metadata.AnalyzeResponse) {
+		var response metadata.AnalyzeResponse
+		res, err := http.Post(server.URL+"/_analyze", ContentTypeJson, strings.NewReader(body))
+		assert.Nil(t, err)
+		defer res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			assert.Nil(t, yaml.NewDecoder(res.Body).Decode(&response))
+		}
+		return res.StatusCode, response
+	}
+
+	status, response := analyze(`{"field": "email", "text": "Vijay@hotmail.com"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, metadata.TokenStream{
+		{Term: "vijay@hotmail.com", Position: 0, StartOffset: 0, EndOffset: 17, Type: metadata.TokenTypeKeyword},
+		{Term: "vijay", Position: 1, StartOffset: 0, EndOffset: 5, Type: metadata.TokenTypeWord},
+		{Term: "hotmail.com", Position: 2, StartOffset: 6, EndOffset: 17, Type: metadata.TokenTypeWord},
+		{Term: "hotmail", Position: 3, StartOffset: 6, EndOffset: 13, Type: metadata.TokenTypeWord},
+		{Term: "com", Position: 4, StartOffset: 14, EndOffset: 17, Type: metadata.TokenTypeWord},
+	}, response.Tokens)
+
+	// the configured tokenizers are analyzed with by the name, in either phase
+	status, response = analyze(`{"tokenizer": "Grams", "text": "abcd"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{"ab", "abc", "bc", "bcd", "cd"}, response.Tokens.Terms())
+
+	status, response = analyze(`{"tokenizer": "Grams", "text": "abcd", "phase": "query"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{"abc", "bcd"}, response.Tokens.Terms())
+
+	// the built-in tokenizers by the name of their type
+	status, response = analyze(`{"tokenizer": "semver", "text": "v1.2.3-rc.1"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{"1", "1.2", "1.2.3-rc.1", "rc.1"}, response.Tokens.Terms())
+
+	status, response = analyze(`{"field": "description", "text": "the"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotNil(t, response.Tokens)
+	assert.Len(t, response.Tokens, 0)
+
+	for _, body := range []string{
+		`{"text": "abcd"}`,
+		`{"field": "title", "tokenizer": "Grams", "text": "abcd"}`,
+		`{"field": "any", "text": "abcd"}`,
+		`{"field": "unknown", "text": "abcd"}`,
+		`{"tokenizer": "unknown", "text": "abcd"}`,
+		`{"tokenizer": "Grams", "text": "abcd", "phase": "search"}`,
+		`{"tokenizer": `,
+	} {
+		status, _ = analyze(body)
+		assert.Equal(t, http.StatusBadRequest, status, body)
+	}
+}
+
+func TestExplain(t *testing.T) {
+
+	logger := logrus.New()
+	service := metadata.NewService(logger)
+	handler := MakeHttpHandler("", mux.NewRouter(), nopMiddleware, service, logger)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	for _, app := range []struct{ title, description string }{
+		{"operator", "A fast database operator"},
+		{"dashboard", "Dashboards of the clusters"},
+	} {
+		m := []byte(`title: ` + app.title + `
+version: 1.0.1
+maintainers:
+- name: Vijay Poliboyina
+  email: vijay@hotmail.com
+company: Upbound Inc.
+website: https://upbound.io
+source: https://github.com/upbound/` + app.title + `
+license: Apache-2.0
+description: ` + app.description)
+		res, err := http.Post(server.URL+"/metadata", ContentTypeYaml, bytes.NewReader(m))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+		res.Body.Close()
+	}
+
+	res, err := http.Get(server.URL + "/metadata/_search?q=" + url.QueryEscape("operator database") + "&explain=true")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	var page metadata.SearchResponse
+	assert.Nil(t, yaml.NewDecoder(res.Body).Decode(&page))
+	res.Body.Close()
+	if assert.Len(t, page.Hits, 1) {
+		assert.Equal(t, map[metadata.SearchField][]string{
+			"title":       {"operator"},
+			"source":      {"operator"},
+			"description": {"database", "operator"},
+		}, page.Hits[0].Explanation)
+	}
+
+	// wildcards report the expanded terms, the must not clauses never match
+	body := `{"q": "description:dash* -title:operator", "explain": true}`
+	res, err = http.Post(server.URL+"/metadata/_search", ContentTypeJson, strings.NewReader(body))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	page = metadata.SearchResponse{}
+	assert.Nil(t, yaml.NewDecoder(res.Body).Decode(&page))
+	res.Body.Close()
+	if assert.Len(t, page.Hits, 1) {
+		assert.Equal(t, map[metadata.SearchField][]string{"description": {"dashboards"}}, page.Hits[0].Explanation)
+	}
+
+	// not explained unless requested
+	res, err = http.Get(server.URL + "/metadata/_search?q=operator")
+	assert.Nil(t, err)
+	page = metadata.SearchResponse{}
+	assert.Nil(t, yaml.NewDecoder(res.Body).Decode(&page))
+	res.Body.Close()
+	if assert.Len(t, page.Hits, 1) {
+		assert.Nil(t, page.Hits[0].Explanation)
+	}
+
+	res, err = http.Get(server.URL + "/metadata/_search?q=operator&explain=maybe")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res.Body.Close()
+}
+
+func TestReload(t *testing.T) {
+
+	logger := logrus.New()
+	service := metadata.NewService(logger)
+	handler := MakeHttpHandler("", mux.NewRouter(), nopMiddleware, service, logger)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	indexApps(t, server.URL,
+		testApp{title: "appmeta server", email: "vijay@hotmail.com"}.yaml(),
+		testApp{title: "appmeta client", email: "vijay@hotmail.com"}.yaml())
+
+	type health struct {
+		Health string                `json:"health"`
+		Reload metadata.ReloadStatus `json:"reload"`
+	}
+	getHealth := func() health {
+		res, err := http.Get(server.URL + "/metadata/_health")
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		var h health
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(&h))
+		res.Body.Close()
+		return h
+	}
+
+	assert.Equal(t, 0, search(t, server.URL, "title=appmeta").Total)
+	assert.Equal(t, metadata.ReloadStateIdle, getHealth().Reload.State)
+
+	err := service.Reload(context.Background(), func() (map[metadata.SearchField]metadata.Tokenizer, map[string]metadata.Tokenizer, error) {
+		return map[metadata.SearchField]metadata.Tokenizer{"title": metadata.DefaultPerWordTokenizer},
+			map[string]metadata.Tokenizer{"words": metadata.DefaultPerWordTokenizer}, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, search(t, server.URL, "title=appmeta").Total)
+	assert.Equal(t, 1, search(t, server.URL, "title=client").Total)
+
+	h := getHealth()
+	assert.Equal(t, "green", h.Health)
+	assert.Equal(t, metadata.ReloadStateReloaded, h.Reload.State)
+	assert.Equal(t, uint64(2), h.Reload.Reindexed)
+	assert.NotNil(t, h.Reload.FinishedAt)
+
+	// the reloaded tokenizers can be analyzed with
+	res, err := http.Post(server.URL+"/_analyze", ContentTypeJson, strings.NewReader(`{"tokenizer": "words", "text": "a b"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	res.Body.Close()
+
+	// a failed reload keeps the current analysis
+	err = service.Reload(context.Background(), func() (map[metadata.SearchField]metadata.Tokenizer, map[string]metadata.Tokenizer, error) {
+		return nil, nil, errors.New("invalid analyzer config")
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, search(t, server.URL, "title=appmeta").Total)
+
+	h = getHealth()
+	assert.Equal(t, "yellow", h.Health)
+	assert.Equal(t, metadata.ReloadStateFailed, h.Reload.State)
+	assert.Equal(t, "invalid analyzer config", h.Reload.Error)
+}
+
+func TestCustomFields(t *testing.T) {
+
+	assert.Nil(t, metadata.SetCustomFields(
+		&metadata.CustomField{Name: "category", Type: metadata.FieldTypeString, Required: true},
+		&metadata.CustomField{Name: "tags", Type: metadata.FieldTypeList},
+		&metadata.CustomField{Name: "runtime", Type: metadata.FieldTypeString, Tokenizer: metadata.DefaultPerWordTokenizer},
+	))
+	defer metadata.SetCustomFields()
+
+	server := newTestServer(t)
+	defer server.Close()
+
+	indexApps(t, server.URL, testApp{title: "operator", email: "vijay@hotmail.com", source: "https://github.com/upbound/operator",
+		description: "A fast database operator"}.yaml()+`
+fields:
+  category: database
+  tags: [sql, operator]
+  runtime: Go Lang`)
+
+	jsonPayload := `{"title": "dashboard", "version": "1.0.1", "maintainers": [{"name": "Vijay Poliboyina", "email": "vijay@hotmail.com"}],
+		"company": "Upbound Inc.", "website": "https://upbound.io", "source": "https://github.com/upbound/dashboard",
+		"license": "Apache-2.0", "description": "Dashboards of the clusters",
+		"fields": {"category": "monitoring", "tags": ["ui", "sql"], "runtime": "Node JS"}}`
+	res, err := http.Post(server.URL+"/metadata", ContentTypeJson, strings.NewReader(jsonPayload))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	res.Body.Close()
+
+	assertTotals(t, server.URL, map[string]int{
+		"tags=sql":          2,
+		"tags=ui":           1,
+		"category=Database": 1,
+		"runtime=go":        1,
+		"q=" + url.QueryEscape("category:monitoring AND tags:sql"): 1,
+		"q=js": 1,
+	})
+
+	page := search(t, server.URL, "runtime=lang&highlight=runtime")
+	if assert.Len(t, page.Hits, 1) {
+		assert.Equal(t, "database", page.Hits[0].Fields["category"])
+		assert.Equal(t, []interface{}{"sql", "operator"}, page.Hits[0].Fields["tags"])
+		assert.Equal(t, []string{"Go <em>Lang</em>"}, page.Hits[0].Highlight["runtime"])
+	}
+
+	page = search(t, server.URL, "size=0&aggs=tags")
+	if assert.Contains(t, page.Aggs, "tags") {
+		assert.Equal(t, metadata.Bucket{Key: "sql", Count: 2}, page.Aggs["tags"].Buckets[0])
+	}
+
+	// the custom fields are validated along with the fixed ones
+	for _, fields := range []string{`{"tags": ["sql"]}`, `{"category": "database", "language": "go"}`, `{"category": "database", "tags": "sql"}`} {
+		body := strings.Replace(jsonPayload, `{"category": "monitoring", "tags": ["ui", "sql"], "runtime": "Node JS"}`, fields, 1)
+		res, err = http.Post(server.URL+"/metadata", ContentTypeJson, strings.NewReader(body))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, fields)
+		res.Body.Close()
+	}
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"strings"
+	"unicode"
+)
+
+var (
+	// DefaultURLTokenizer breaks an URL into the URL, the scheme, the host, the labels of the host, the host along with
+	// each path prefix and the path segments e.g. https://github.com/upbound/repo is searchable by github.com/upbound.
+	DefaultURLTokenizer = &urlTokenizer{}
+
+	// DefaultEmailTokenizer breaks an email address into the address, the local part, the domain and the labels of the
+	// domain e.g. vijay@hotmail.com is searchable by vijay, hotmail.com or hotmail.
+	DefaultEmailTokenizer = &emailTokenizer{}
+
+	// DefaultSemverTokenizer breaks a semantic version into the major, the major.minor, the version (without the v
+	// prefix and the build metadata) and the prerelease e.g. 1.0.1-rc.1 is searchable by 1, 1.0 or rc.1.
+	DefaultSemverTokenizer = &semverTokenizer{}
+)
+
+// identifierTokens builds the token stream of the parts of an identifier, a part is a byte range of the normalized
+// (NFKC) and lowercased input and a part repeating the term of an earlier one is skipped. Each part takes its own
+// position so that the parts of a search value all have to match.
+type identifierTokens struct {
+	lower   string
+	toInput func(start, end int) (int, int)
+	tokens  TokenStream
+}
+
+// newIdentifierTokens returns the builder of the input along with the range of the input without the surrounding
+// whitespace.
+func newIdentifierTokens(input string) (*identifierTokens, int, int) {
+	lower, toInput := normalizeWithOffsets(input)
+	start := len(lower) - len(strings.TrimLeftFunc(lower, unicode.IsSpace))
+	end := len(strings.TrimRightFunc(lower, unicode.IsSpace))
+	if end < start {
+		end = start
+	}
+	return &identifierTokens{lower: lower, toInput: toInput}, start, end
+}
+
+func (b *identifierTokens) add(start, end int, tokenType string) {
+	if start >= end {
+		return
+	}
+	term := b.lower[start:end]
+	for _, token := range b.tokens {
+		if token.Term == term {
+			return
+		}
+	}
+	startOffset, endOffset := b.toInput(start, end)
+	b.tokens = append(b.tokens, Token{
+		Term:        term,
+		Position:    len(b.tokens),
+		StartOffset: startOffset,
+		EndOffset:   endOffset,
+		Type:        tokenType,
+	})
+}
+
+// addLabels adds the dot separated labels of the range when there are more than one.
+func (b *identifierTokens) addLabels(start, end int) {
+	if !strings.Contains(b.lower[start:end], ".") {
+		return
+	}
+	for from := start; from <= end; {
+		i := strings.IndexByte(b.lower[from:end], '.')
+		if i < 0 {
+			i = end - from
+		}
+		b.add(from, from+i, TokenTypeWord)
+		from += i + 1
+	}
+}
+
+// indexAny is strings.IndexAny of s[from:to] as an index of s, or to when none of the chars is found.
+func indexAny(s string, from, to int, chars string) int {
+	if i := strings.IndexAny(s[from:to], chars); i >= 0 {
+		return from + i
+	}
+	return to
+}
+
+type urlTokenizer struct {
+}
+
+func (t *urlTokenizer) Tokenize(input string) []string {
+	return t.TokenStream(input).Terms()
+}
+
+// TokenStream parses the [scheme://][userinfo@]host[:port][/path][?query][#fragment] parts of the URL leniently, the
+// search values without the scheme e.g. github.com/upbound are parsed the same way.
+func (t *urlTokenizer) TokenStream(input string) TokenStream {
+	b, start, end := newIdentifierTokens(input)
+	for end > start && b.lower[end-1] == '/' {
+		end--
+	}
+	b.add(start, end, TokenTypeKeyword)
+
+	authority := start
+	if i := strings.Index(b.lower[start:end], "://"); i > 0 {
+		b.add(start, start+i, TokenTypeWord)
+		authority = start + i + len("://")
+	}
+
+	authorityEnd := indexAny(b.lower, authority, end, "/?#")
+	if i := strings.LastIndexByte(b.lower[authority:authorityEnd], '@'); i >= 0 {
+		authority += i + 1
+	}
+	hostEnd := indexAny(b.lower, authority, authorityEnd, ":")
+	b.add(authority, hostEnd, TokenTypeWord)
+	b.addLabels(authority, hostEnd)
+
+	pathEnd := indexAny(b.lower, authorityEnd, end, "?#")
+	for from := authorityEnd; from < pathEnd; {
+		from++
+		segmentEnd := indexAny(b.lower, from, pathEnd, "/")
+		if segmentEnd > from {
+			b.add(authority, segmentEnd, TokenTypeWord)
+			b.add(from, segmentEnd, TokenTypeWord)
+		}
+		from = segmentEnd
+	}
+	return b.tokens
+}
+
+type emailTokenizer struct {
+}
+
+func (t *emailTokenizer) Tokenize(input string) []string {
+	return t.TokenStream(input).Terms()
+}
+
+// TokenStream splits the address on the last @, a search value without the @ is a domain when it has a dot e.g.
+// hotmail.com, either a local part or a label otherwise.
+func (t *emailTokenizer) TokenStream(input string) TokenStream {
+	b, start, end := newIdentifierTokens(input)
+	b.add(start, end, TokenTypeKeyword)
+
+	domain := start
+	if i := strings.LastIndexByte(b.lower[start:end], '@'); i >= 0 {
+		b.add(start, start+i, TokenTypeWord)
+		domain = start + i + 1
+	}
+	b.add(domain, end, TokenTypeWord)
+	b.addLabels(domain, end)
+	return b.tokens
+}
+
+type semverTokenizer struct {
+}
+
+func (t *semverTokenizer) Tokenize(input string) []string {
+	return t.TokenStream(input).Terms()
+}
+
+// TokenStream breaks the [v]major[.minor[.patch]][-prerelease][+build] versions into the parts, the search values like
+// 1 or 1.0 match all the versions of the major or the minor. The values that are not versions are kept as is.
+func (t *semverTokenizer) TokenStream(input string) TokenStream {
+	b, value, end := newIdentifierTokens(input)
+	start := value
+	if start < end && b.lower[start] == 'v' {
+		start++
+	}
+
+	versionEnd := indexAny(b.lower, start, end, "+")
+	coreEnd := indexAny(b.lower, start, versionEnd, "-")
+
+	var parts []int
+	for from := start; from <= coreEnd; {
+		partEnd := indexAny(b.lower, from, coreEnd, ".")
+		if partEnd == from || strings.TrimLeft(b.lower[from:partEnd], "0123456789") != "" {
+			parts = nil
+			break
+		}
+		parts = append(parts, partEnd)
+		from = partEnd + 1
+	}
+	if len(parts) == 0 || len(parts) > 3 || (coreEnd < versionEnd && coreEnd+1 == versionEnd) {
+		// not a version, or a version with an empty prerelease
+		b.add(value, end, TokenTypeKeyword)
+		return b.tokens
+	}
+
+	for _, partEnd := range parts[:len(parts)-1] {
+		b.add(start, partEnd, TokenTypeWord)
+	}
+	b.add(start, versionEnd, TokenTypeKeyword)
+	if coreEnd < versionEnd {
+		b.add(coreEnd+1, versionEnd, TokenTypeWord)
+	}
+	return b.tokens
+}
@@ -15,6 +15,8 @@ import (
 var (
 	errUUIDGenError = errors.New("error generating uuid")
 	errNotFound     = errors.New("not found")
+
+	errRebuildInProgress = errors.New("index rebuild already in progress")
 )
 
 var (
@@ -27,6 +29,15 @@ type MetadataWithID struct {
 	// Auto generated on a new indexing request
 	ID uuid.UUID `json:"_id" yaml:"_id"`
 
+	// Relevance of the metadata for the search query, only set on the search hits
+	Score float64 `json:"_score,omitempty" yaml:"_score,omitempty"`
+
+	// Fragments of the requested fields with the matched terms highlighted, only set on the search hits
+	Highlight map[SearchField][]string `json:"highlight,omitempty" yaml:"highlight,omitempty"`
+
+	// Indexed terms of each field that matched the query, only set on the search hits when explain is requested
+	Explanation map[SearchField][]string `json:"explanation,omitempty" yaml:"explanation,omitempty"`
+
 	// User-supplied metadata structure
 	*Metadata
 }
@@ -35,17 +46,36 @@ type MetadataWithID struct {
 type Indexer interface {
 
 	// Indexes the fields for searchability and stores in the repo, returns an auto-generated UUID on success.
-	Index(map[SearchField][]string, *Metadata) (uuid.UUID, error)
+	Index(map[SearchField]TokenStream, *Metadata) (uuid.UUID, error)
 
-	// Delete and remove the indexing structures corresponding to the metadata ID from the repo
+	// Delete and remove the indexing structures corresponding to the metadata ID from the repo, if no ID is there
+	// then errNotFound is returned
 	Delete(uuid.UUID) error
 
+	// Reindex replaces the metadata payload stored under the given ID and updates the indexing structures to reflect
+	// the new terms. If no ID is there then errNotFound is returned
+	Reindex(uuid.UUID, map[SearchField]TokenStream, *Metadata) error
+
 	// Singlefield search - Returns all the metadata payloads that match the 'value' for the given 'field'
 	SearchBySingleField(field SearchField, value string) ([]*MetadataWithID, error)
 
 	// Multifield search - Returns all the metadata payloads that match ALL the values for the given fields
-	// This is AND filter in that all the filters have to match for the metadata to be considered a hit
-	Search(Query) ([]*MetadataWithID, error)
+	// This is AND filter in that all the filters have to match for the metadata to be considered a hit.
+	// The hits are scored with BM25, weighed by the boosts of the matched fields and sorted by the score.
+	Search(Query, Boosts) ([]*MetadataWithID, error)
+
+	// Boolean search - Returns all the metadata payloads that match the clause, scored and sorted like Search.
+	Execute(*QueryClause) ([]*MetadataWithID, error)
+
+	// Aggregate buckets the hits by the aggregations, nil hits aggregate all the metadata.
+	Aggregate([]*MetadataWithID, map[string]*Aggregation) (map[string]*AggregationResult, error)
+
+	// Explain sets the indexed terms of each hit that matched the leaves of the clause by the field.
+	Explain([]*MetadataWithID, *QueryClause) error
+
+	// Suggest returns the top completions of the prefix for the field, ranked by the number of the metadata that
+	// contain the completion.
+	Suggest(field SearchField, prefix string, size int) ([]Suggestion, error)
 
 	// Returns all the metadatas
 	GetAll() ([]*MetadataWithID, error)
@@ -53,24 +83,50 @@ type Indexer interface {
 	// Get the metadata with the specified ID, if no ID is there then errNotFound is returned
 	Get(uuid.UUID) (*MetadataWithID, error)
 
+	// Rebuild reindexes all the stored metadata with the analyze func into a fresh inverted index while the current
+	// one keeps serving, the changes made meanwhile are tracked. The returned commit applies the tracked changes to the
+	// fresh index and swaps it in, only one rebuild can be in progress at a time.
+	Rebuild(analyze func(*Metadata) map[SearchField]TokenStream) (commit func(), err error)
+
 	// Health API
 	Health() error
 
 	// Number of metadata payloads that are currently indexed.
 	Size() uint64
+
+	// Close flushes any pending state and releases the resources held by the indexer.
+	Close() error
 }
 
 type uuidSet map[uuid.UUID]bool
-type TermIndex map[string]uuidSet
 
-// inMemoryIndexer implements the indexer interface by two data structures
-//	1. searchIndex of type map[SearchField]map[string]UUID
-//        - maintains the inverted index of fields -> fieldValues/terms -> metadata UUIDs
+// postingList maps the metadata UUIDs to the positions of the term in the field of that metadata, the positions are
+// sorted in the ascending order and the number of positions is the frequency of the term.
+type postingList map[uuid.UUID][]int
+
+type TermIndex map[string]postingList
+
+// inMemoryIndexer implements the indexer interface by three data structures
+//	1. searchIndex of type map[SearchField]map[string]map[UUID]int
+//        - maintains the inverted index of fields -> fieldValues/terms -> metadata UUIDs -> term positions
 //  2. uuid2MetadataIndex of type similar to ConcurrentMap[uuid.UUID]Metadata
 //        - maintains the UUID to metadata payload mapping
+//  3. uuid2Terms of type map[UUID]map[SearchField]TokenStream
+//        - maintains the forward index of metadata UUID -> fields -> terms, used to clean up the inverted index on delete
+//          and as the field length for scoring.
 type inMemoryIndexer struct {
 	searchMutex *sync.RWMutex
 	searchIndex map[SearchField]TermIndex
+	uuid2Terms  map[uuid.UUID]map[SearchField]TokenStream
+
+	// total number of terms per field across all the metadata, used for the average field length in scoring.
+	fieldLengths map[SearchField]int
+
+	// sorted terms per field for the wildcard and fuzzy expansions
+	termDictionary *termDictionary
+
+	// completions of the title, company and maintainer names
+	suggester *suggester
 
 	// similar to ConcurrentMap[uuid.UUID]Metadata
 	uuid2MetadataIndex *sync.Map
@@ -78,204 +134,272 @@ type inMemoryIndexer struct {
 	// atomic counter for number of items in the index
 	metadataCount uint64
 	logger        *logrus.Logger
+
+	// IDs of the metadata changed since the rebuild in progress started, nil when no rebuild is in progress
+	rebuildChanges uuidSet
 }
 
 func newInMemoryIndexer(logger *logrus.Logger) Indexer {
 	return &inMemoryIndexer{
 		searchMutex:        &sync.RWMutex{},
 		searchIndex:        map[SearchField]TermIndex{},
+		uuid2Terms:         map[uuid.UUID]map[SearchField]TokenStream{},
+		fieldLengths:       map[SearchField]int{},
+		termDictionary:     newTermDictionary(),
+		suggester:          newSuggester(),
 		uuid2MetadataIndex: &sync.Map{},
 		metadataCount:      0,
 		logger:             logger,
 	}
 }
 
-func (repo *inMemoryIndexer) Index(searchTerms map[SearchField][]string, p *Metadata) (uuid.UUID, error) {
-
-	var (
-		termValueIndex TermIndex
-		ok             bool
-	)
+func (repo *inMemoryIndexer) Index(searchTerms map[SearchField]TokenStream, p *Metadata) (uuid.UUID, error) {
 
 	metadataID, err := uuid.NewUUID()
 	if err != nil {
 		return uuid.Nil, errUUIDGenError
 	}
+	repo.indexWithID(metadataID, searchTerms, p)
+	return metadataID, nil
+}
+
+// indexWithID stores the payload and its postings under the given ID, the ID is expected to be unique.
+func (repo *inMemoryIndexer) indexWithID(metadataID uuid.UUID, searchTerms map[SearchField]TokenStream, p *Metadata) {
+
+	repo.searchMutex.Lock()
+	defer repo.searchMutex.Unlock()
 
 	// From this point it is safe to assume no errors or inconsistencies will happen.
 	repo.uuid2MetadataIndex.Store(metadataID, p)
 	atomic.AddUint64(&repo.metadataCount, 1)
+	repo.suggester.add(p)
 
 	// Modify the search inverted index as the Metadata is already inserted into the uuidset
-	repo.searchMutex.Lock()
-	defer repo.searchMutex.Unlock()
+	repo.addPostings(metadataID, searchTerms)
+	repo.trackChange(metadataID)
+}
 
+// addPostings adds the terms of the metadata to the inverted index, has to be called with the searchMutex held.
+func (repo *inMemoryIndexer) addPostings(metadataID uuid.UUID, searchTerms map[SearchField]TokenStream) {
+	repo.uuid2Terms[metadataID] = searchTerms
 	for fieldName, terms := range searchTerms {
 
 		// Check for the existence of the field key
-		if termValueIndex, ok = repo.searchIndex[fieldName]; !ok {
+		termValueIndex, ok := repo.searchIndex[fieldName]
+		if !ok {
 			termValueIndex = TermIndex{}
 			repo.searchIndex[fieldName] = termValueIndex
 		}
+		repo.fieldLengths[fieldName] += len(terms)
 
-		// Modify the terms to metadata id mapping
-		for _, term := range terms {
-			uuids, ok := termValueIndex[term]
+		// Modify the terms to metadata id mapping along with the positions of the tokens, the stream is ordered by the
+		// position so the positions are appended in the ascending order.
+		for _, token := range terms {
+			postings, ok := termValueIndex[token.Term]
 			if !ok {
-				uuids = uuidSet{}
-				termValueIndex[term] = uuids
+				postings = postingList{}
+				termValueIndex[token.Term] = postings
+				repo.termDictionary.invalidate(fieldName)
 			}
-			uuids[metadataID] = true
+			postings[metadataID] = append(postings[metadataID], token.Position)
 		}
 	}
-	return metadataID, nil
-}
-
-func (repo *inMemoryIndexer) Delete(uuid.UUID) error {
-	return errors.New("delete not implemented")
 }
 
-func (repo *inMemoryIndexer) SearchBySingleField(fieldName SearchField, term string) ([]*MetadataWithID, error) {
-	if fieldName == anyField {
-		return repo.SearchAny(term)
-	}
-
-	repo.searchMutex.RLock()
-	defer repo.searchMutex.RUnlock()
-
-	uuids, err := repo.getUUIDsByField(fieldName, term)
-	if err != nil || len(uuids) == 0 {
-		return nil, err
-	}
-
-	// We got the UUIDs of all matched Metadata structures, now get the actual values.
-	metadatas := make([]*MetadataWithID, 0, len(uuids))
-	for uuid := range uuids {
-		if v, ok := repo.uuid2MetadataIndex.Load(uuid); ok {
-			metadatas = append(metadatas, &MetadataWithID{uuid, v.(*Metadata)})
+// removePostings removes the terms of the metadata from the inverted index, has to be called with the searchMutex held.
+func (repo *inMemoryIndexer) removePostings(id uuid.UUID) {
+	for fieldName, terms := range repo.uuid2Terms[id] {
+		repo.fieldLengths[fieldName] -= len(terms)
+		termValueIndex, ok := repo.searchIndex[fieldName]
+		if !ok {
+			continue
+		}
+		for _, token := range terms {
+			postings, ok := termValueIndex[token.Term]
+			if !ok {
+				continue
+			}
+			delete(postings, id)
+			if len(postings) == 0 {
+				delete(termValueIndex, token.Term)
+				repo.termDictionary.invalidate(fieldName)
+			}
+		}
+		if len(termValueIndex) == 0 {
+			delete(repo.searchIndex, fieldName)
 		}
 	}
-	return metadatas, nil
+	delete(repo.uuid2Terms, id)
 }
 
-func (repo *inMemoryIndexer) getUUIDsByField(fieldName SearchField, term string) (uuidSet, error) {
-	var (
-		termIndex TermIndex
-		ok        bool
-	)
-
-	if termIndex, ok = repo.searchIndex[fieldName]; !ok {
-		return nil, nil
+// trackChange records the change of the metadata for the rebuild in progress, has to be called with the searchMutex
+// held.
+func (repo *inMemoryIndexer) trackChange(id uuid.UUID) {
+	if repo.rebuildChanges != nil {
+		repo.rebuildChanges[id] = true
 	}
-	return termIndex[term], nil
 }
 
-// SearchAny tries to match the given term against all the fields. Just a wrapper
-// around the getUUIDsAnyField with the rw mutex.
-func (repo *inMemoryIndexer) SearchAny(term string) ([]*MetadataWithID, error) {
-	repo.searchMutex.RLock()
-	defer repo.searchMutex.RUnlock()
+// Delete removes the metadata payload along with all of its postings from the inverted index. Terms and fields that
+// are left without any postings are pruned so that the index does not grow with the retired payloads.
+func (repo *inMemoryIndexer) Delete(id uuid.UUID) error {
+	repo.searchMutex.Lock()
+	defer repo.searchMutex.Unlock()
 
-	metadataIds, err := repo.getUUIDsAnyField(term)
-	if err != nil {
-		return nil, err
+	v, ok := repo.uuid2MetadataIndex.Load(id)
+	if !ok {
+		return errNotFound
 	}
-	return repo.get(metadataIds)
+	repo.uuid2MetadataIndex.Delete(id)
+	atomic.AddUint64(&repo.metadataCount, ^uint64(0))
+	repo.suggester.remove(v.(*Metadata))
+	repo.removePostings(id)
+	repo.trackChange(id)
+	return nil
 }
 
-func (repo *inMemoryIndexer) merge(first, second uuidSet) uuidSet {
-	union := uuidSet{}
-	for k := range first {
-		union[k] = true
-	}
-	for k := range second {
-		union[k] = true
+// termPositions collects the positions of each term of the token stream
+func termPositions(tokens TokenStream) map[string][]int {
+	positions := map[string][]int{}
+	for _, token := range tokens {
+		positions[token.Term] = append(positions[token.Term], token.Position)
 	}
-	return union
+	return positions
 }
 
-// Loops through all the fields trying to search for the given term in the corresponding index/map.
-// Slightly expensive which can be avoided with another dedicated index but with more memory requirements.
-func (repo *inMemoryIndexer) getUUIDsAnyField(term string) (uuidSet, error) {
-	uuids := uuidSet{}
-	for _, termIndex := range repo.searchIndex {
-		termUUIds := termIndex[term]
-		uuids = repo.merge(uuids, termUUIds)
+func equalPositions(first, second []int) bool {
+	if len(first) != len(second) {
+		return false
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			return false
+		}
 	}
-	return uuids, nil
+	return true
 }
 
-// Searches the given filters/query against the inverted index and returns the hits.
-// Each filter/field->term expression is evaluated separately and a matched Metadata is checked against a previously
-// matched set to be considered as a hit. Therefore a metadata item is considered a hit only if it matches against all
-// the filters specified in the query. Any is a special meta search field that is used to match against all the other
-// field values.
-func (repo *inMemoryIndexer) Search(query Query) ([]*MetadataWithID, error) {
-	var (
-		filteredUUIDs uuidSet
-		err           error
-		firstTime     = true
-	)
+// Reindex diffs the previously indexed terms of the payload against the given terms so that only the postings of the
+// terms that were added, removed or whose positions changed are touched, rest of the postings are left as is.
+func (repo *inMemoryIndexer) Reindex(id uuid.UUID, searchTerms map[SearchField]TokenStream, p *Metadata) error {
+	repo.searchMutex.Lock()
+	defer repo.searchMutex.Unlock()
 
-	repo.searchMutex.RLock()
-	defer repo.searchMutex.RUnlock()
+	v, ok := repo.uuid2MetadataIndex.Load(id)
+	if !ok {
+		return errNotFound
+	}
 
-	// Prioritize the any field first if in the query
-	if term, ok := query[anyField]; ok {
-		if filteredUUIDs, err = repo.getUUIDsAnyField(term); err != nil {
-			return nil, err
-		}
-		delete(query, anyField)
-		firstTime = false
+	// the fields of the old terms are visited as well, a custom field that is no longer declared is dropped
+	oldTerms := repo.uuid2Terms[id]
+	fields := make(map[SearchField]bool, len(oldTerms)+len(searchTerms))
+	for fieldName := range oldTerms {
+		fields[fieldName] = true
+	}
+	for fieldName := range searchTerms {
+		fields[fieldName] = true
 	}
+	for fieldName := range fields {
+		oldPositions := termPositions(oldTerms[fieldName])
+		newPositions := termPositions(searchTerms[fieldName])
+		if len(oldPositions) == 0 && len(newPositions) == 0 {
+			continue
+		}
 
-	for fieldName, term := range query {
-		matchedUUIDs, err := repo.getUUIDsByField(fieldName, term)
-		if err != nil {
-			return nil, err
+		termValueIndex, ok := repo.searchIndex[fieldName]
+		if !ok {
+			termValueIndex = TermIndex{}
+			repo.searchIndex[fieldName] = termValueIndex
 		}
-		if firstTime {
-			filteredUUIDs = matchedUUIDs
-			firstTime = false
-		} else {
-			filteredUUIDs = repo.intersectionOf(matchedUUIDs, filteredUUIDs)
+		repo.fieldLengths[fieldName] += len(searchTerms[fieldName]) - len(oldTerms[fieldName])
+
+		// Drop the postings of the terms that are not part of the payload anymore
+		for term := range oldPositions {
+			if _, ok := newPositions[term]; ok {
+				continue
+			}
+			if postings, ok := termValueIndex[term]; ok {
+				delete(postings, id)
+				if len(postings) == 0 {
+					delete(termValueIndex, term)
+					repo.termDictionary.invalidate(fieldName)
+				}
+			}
 		}
-		if len(filteredUUIDs) == 0 {
-			return noHits, nil
+
+		// Add the postings of the terms that are new to the payload or have different positions
+		for term, positions := range newPositions {
+			if equalPositions(oldPositions[term], positions) {
+				continue
+			}
+			postings, ok := termValueIndex[term]
+			if !ok {
+				postings = postingList{}
+				termValueIndex[term] = postings
+				repo.termDictionary.invalidate(fieldName)
+			}
+			postings[id] = positions
+		}
+
+		if len(termValueIndex) == 0 {
+			delete(repo.searchIndex, fieldName)
 		}
 	}
-	return repo.get(filteredUUIDs)
+
+	repo.uuid2Terms[id] = searchTerms
+	repo.uuid2MetadataIndex.Store(id, p)
+	repo.suggester.remove(v.(*Metadata))
+	repo.suggester.add(p)
+	repo.trackChange(id)
+	return nil
+}
+
+func (repo *inMemoryIndexer) SearchBySingleField(fieldName SearchField, term string) ([]*MetadataWithID, error) {
+	return repo.Search(Query{fieldName: term}, nil)
+}
+
+// SearchAny tries to match the given term against all the fields. Just a wrapper
+// around the Search with the any field.
+func (repo *inMemoryIndexer) SearchAny(term string) ([]*MetadataWithID, error) {
+	return repo.Search(Query{anyField: term}, nil)
 }
 
-func (repo *inMemoryIndexer) intersectionOf(first, second uuidSet) uuidSet {
-	if len(first) > len(second) {
-		return repo.intersectionOf(second, first)
+// Searches the given filters/query against the inverted index and returns the hits.
+// A metadata item is considered a hit only if it matches against all the filters specified in the query. Any is a
+// special meta search field that is used to match against all the other field values.
+func (repo *inMemoryIndexer) Search(query Query, boosts Boosts) ([]*MetadataWithID, error) {
+	return repo.Execute(query.Clause(boosts))
+}
+
+// Execute evaluates the clause against the inverted index and returns the hits sorted by the score.
+func (repo *inMemoryIndexer) Execute(clause *QueryClause) ([]*MetadataWithID, error) {
+	repo.searchMutex.RLock()
+	defer repo.searchMutex.RUnlock()
+
+	matches := repo.evaluate(clause)
+	if len(matches) == 0 {
+		return noHits, nil
 	}
 
-	intersection := uuidSet{}
-	for k := range first {
-		if _, ok := second[k]; ok {
-			intersection[k] = true
+	hits := make([]*MetadataWithID, 0, len(matches))
+	for id, score := range matches {
+		if v, ok := repo.uuid2MetadataIndex.Load(id); ok {
+			hits = append(hits, &MetadataWithID{ID: id, Score: score, Metadata: v.(*Metadata)})
 		}
 	}
-	return intersection
+	sortByScore(hits)
+	return hits, nil
 }
 
-func (repo *inMemoryIndexer) get(matchSet uuidSet) ([]*MetadataWithID, error) {
-	payloads := make([]*MetadataWithID, 0, len(matchSet))
-	for uuid := range matchSet {
-		if v, ok := repo.uuid2MetadataIndex.Load(uuid); ok {
-			payloads = append(payloads, &MetadataWithID{uuid, v.(*Metadata)})
-		}
-	}
-	return payloads, nil
+func (repo *inMemoryIndexer) Suggest(field SearchField, prefix string, size int) ([]Suggestion, error) {
+	return repo.suggester.suggest(field, prefix, size), nil
 }
 
 func (repo *inMemoryIndexer) GetAll() ([]*MetadataWithID, error) {
 
-	payloads := make([]*MetadataWithID, 0, repo.Size()+64)
+	payloads := make([]*MetadataWithID, 0, repo.Size())
 	repo.uuid2MetadataIndex.Range(func(key, val interface{}) bool {
-		payloads = append(payloads, &MetadataWithID{key.(uuid.UUID), val.(*Metadata)})
+		payloads = append(payloads, &MetadataWithID{ID: key.(uuid.UUID), Metadata: val.(*Metadata)})
 		return true
 	})
 	return payloads, nil
@@ -284,11 +408,47 @@ func (repo *inMemoryIndexer) GetAll() ([]*MetadataWithID, error) {
 func (repo *inMemoryIndexer) Get(id uuid.UUID) (*MetadataWithID, error) {
 
 	if v, ok := repo.uuid2MetadataIndex.Load(id); ok {
-		return &MetadataWithID{id, v.(*Metadata)}, nil
+		return &MetadataWithID{ID: id, Metadata: v.(*Metadata)}, nil
 	}
 	return nil, errNotFound
 }
 
+// Rebuild analyzes the stored metadata into a fresh inverted index without holding the searchMutex, the metadata
+// indexed, reindexed or deleted meanwhile is analyzed again (or dropped) by the commit. The metadata itself and the
+// suggestions do not depend on the analysis and are kept as is.
+func (repo *inMemoryIndexer) Rebuild(analyze func(*Metadata) map[SearchField]TokenStream) (func(), error) {
+	repo.searchMutex.Lock()
+	if repo.rebuildChanges != nil {
+		repo.searchMutex.Unlock()
+		return nil, errRebuildInProgress
+	}
+	repo.rebuildChanges = uuidSet{}
+	repo.searchMutex.Unlock()
+
+	fresh := newInMemoryIndexer(repo.logger).(*inMemoryIndexer)
+	repo.uuid2MetadataIndex.Range(func(key, val interface{}) bool {
+		fresh.addPostings(key.(uuid.UUID), analyze(val.(*Metadata)))
+		return true
+	})
+
+	return func() {
+		repo.searchMutex.Lock()
+		defer repo.searchMutex.Unlock()
+
+		for id := range repo.rebuildChanges {
+			fresh.removePostings(id)
+			if v, ok := repo.uuid2MetadataIndex.Load(id); ok {
+				fresh.addPostings(id, analyze(v.(*Metadata)))
+			}
+		}
+		repo.searchIndex = fresh.searchIndex
+		repo.uuid2Terms = fresh.uuid2Terms
+		repo.fieldLengths = fresh.fieldLengths
+		repo.termDictionary = fresh.termDictionary
+		repo.rebuildChanges = nil
+	}, nil
+}
+
 func (repo *inMemoryIndexer) Health() error {
 	return nil
 }
@@ -296,3 +456,7 @@ func (repo *inMemoryIndexer) Health() error {
 func (repo *inMemoryIndexer) Size() uint64 {
 	return atomic.LoadUint64(&repo.metadataCount)
 }
+
+func (repo *inMemoryIndexer) Close() error {
+	return nil
+}
@@ -6,8 +6,10 @@ package metadata
 
 import (
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 )
 
@@ -16,7 +18,7 @@ func TestInMemoryIndexer_IndexAndSearch(t *testing.T) {
 	indexer := newInMemoryIndexer(logrus.New())
 	analyzer := &Analyzer{defaultSearchFieldTokenizerMapping}
 
-	hits, err := indexer.Search(Query{nameField: "vijay"})
+	hits, err := indexer.Search(Query{nameField: "vijay"}, nil)
 	assert.Nil(t, err)
 	assert.Len(t, hits, 0)
 
@@ -54,36 +56,141 @@ func TestInMemoryIndexer_IndexAndSearch(t *testing.T) {
 
 	assert.Nil(t, err)
 
-	hits, err = indexer.Search(Query{nameField: "vijay"})
+	hits, err = indexer.Search(Query{nameField: "vijay"}, nil)
 	assert.Nil(t, err)
 	assert.Len(t, hits, 1)
 
-	hits, err = indexer.Search(Query{descriptionField: "metadata"})
+	hits, err = indexer.Search(Query{descriptionField: "metadata"}, nil)
 	assert.Nil(t, err)
 	assert.Len(t, hits, 2)
 
-	hits, err = indexer.Search(Query{nameField: "poliboyina"})
+	hits, err = indexer.Search(Query{nameField: "poliboyina"}, nil)
 	assert.Nil(t, err)
 	assert.Len(t, hits, 2)
 
-	hits, err = indexer.Search(Query{nameField: "poliboyina", titleField: "appmeta"})
+	hits, err = indexer.Search(Query{nameField: "poliboyina", titleField: "appmeta"}, nil)
 	assert.Nil(t, err)
 	assert.Len(t, hits, 1)
 
-	hits, err = indexer.Search(Query{nameField: "v poliboyina"})
+	hits, err = indexer.Search(Query{nameField: "v poliboyina"}, nil)
 	assert.Nil(t, err)
 	assert.Len(t, hits, 1)
 
-	hits, err = indexer.Search(Query{companyField: "feye"})
+	hits, err = indexer.Search(Query{companyField: "feye"}, nil)
 	assert.Nil(t, err)
 	assert.Len(t, hits, 2)
 
-	hits, err = indexer.Search(Query{companyField: "cfeye"})
+	hits, err = indexer.Search(Query{companyField: "cfeye"}, nil)
 	assert.Nil(t, err)
 	assert.Len(t, hits, 0)
 
 }
 
+func TestInMemoryIndexer_Delete(t *testing.T) {
+
+	indexer := newInMemoryIndexer(logrus.New()).(*inMemoryIndexer)
+	analyzer := &Analyzer{defaultSearchFieldTokenizerMapping}
+
+	m := &Metadata{
+		Title:   "appmeta",
+		Version: "0.1.0",
+		Maintainers: []Maintainer{
+			{"Vijay Poliboyina", "vijaykp@gmail.com"},
+		},
+		Company:     "feye Inc.",
+		Website:     "https://feye.io",
+		SourceURL:   "https://github.com/feye.io",
+		License:     "Apache-2.0",
+		Description: "App metadata service",
+	}
+	id, err := indexer.Index(analyzer.AnalyzePayload(m), m)
+	assert.Nil(t, err)
+
+	m2 := &Metadata{
+		Title:   "appmeta2",
+		Version: "0.1.0",
+		Maintainers: []Maintainer{
+			{"V Poliboyina", "vijaykp@gmail.com"},
+		},
+		Company:     "feye Inc.",
+		Website:     "https://feye.io",
+		SourceURL:   "https://github.com/feye.io",
+		License:     "Apache-2.0",
+		Description: "Retired app",
+	}
+	_, err = indexer.Index(analyzer.AnalyzePayload(m2), m2)
+	assert.Nil(t, err)
+
+	assert.Nil(t, indexer.Delete(id))
+	assert.Equal(t, uint64(1), indexer.Size())
+	assert.True(t, IsNotFoundError(indexer.Delete(id)))
+
+	_, err = indexer.Get(id)
+	assert.True(t, IsNotFoundError(err))
+
+	hits, err := indexer.Search(Query{nameField: "vijay"}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, hits, 0)
+
+	hits, err = indexer.Search(Query{nameField: "poliboyina"}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, hits, 1)
+
+	// terms that were only referenced by the deleted payload are pruned
+	_, ok := indexer.searchIndex[titleField]["appmeta"]
+	assert.False(t, ok)
+	_, ok = indexer.searchIndex[descriptionField]["metadata"]
+	assert.False(t, ok)
+	assert.Len(t, indexer.uuid2Terms, 1)
+}
+
+func TestInMemoryIndexer_Reindex(t *testing.T) {
+
+	indexer := newInMemoryIndexer(logrus.New()).(*inMemoryIndexer)
+	analyzer := &Analyzer{defaultSearchFieldTokenizerMapping}
+
+	m := &Metadata{
+		Title:   "appmeta",
+		Version: "0.1.0",
+		Maintainers: []Maintainer{
+			{"Vijay Poliboyina", "vijaykp@gmail.com"},
+		},
+		Company:     "feye Inc.",
+		Website:     "https://feye.io",
+		SourceURL:   "https://github.com/feye.io",
+		License:     "Apache-2.0",
+		Description: "App metadata service",
+	}
+	id, err := indexer.Index(analyzer.AnalyzePayload(m), m)
+	assert.Nil(t, err)
+
+	updated := *m
+	updated.Company = "Upbound Inc."
+	updated.Description = "App metadata search service"
+	assert.Nil(t, indexer.Reindex(id, analyzer.AnalyzePayload(&updated), &updated))
+	assert.Equal(t, uint64(1), indexer.Size())
+
+	hits, err := indexer.Search(Query{companyField: "feye"}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, hits, 0)
+	_, ok := indexer.searchIndex[companyField]["feye"]
+	assert.False(t, ok)
+
+	hits, err = indexer.Search(Query{companyField: "upbound", descriptionField: "search"}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, hits, 1)
+
+	hits, err = indexer.Search(Query{descriptionField: "metadata"}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, hits, 1)
+
+	result, err := indexer.Get(id)
+	assert.Nil(t, err)
+	assert.Equal(t, "Upbound Inc.", result.Company)
+
+	assert.True(t, IsNotFoundError(indexer.Reindex(uuid.New(), analyzer.AnalyzePayload(m), m)))
+}
+
 func TestInMemoryIndexer_ConcurrentIndexAndSearch(t *testing.T) {
 	t.SkipNow()
 
@@ -93,6 +200,7 @@ func TestInMemoryIndexer_ConcurrentIndexAndSearch(t *testing.T) {
 	analyzer := &Analyzer{defaultSearchFieldTokenizerMapping}
 
 	for i := 0; i < count; i++ {
+		i := i
 		t.Run(fmt.Sprintf("p-%d", i), func(tt *testing.T) {
 			tt.Parallel()
 
@@ -112,7 +220,7 @@ func TestInMemoryIndexer_ConcurrentIndexAndSearch(t *testing.T) {
 			_, err := indexer.Index(s, m)
 			assert.Nil(tt, err)
 
-			hits, err := indexer.Search(Query{titleField: fmt.Sprintf("appmeta%d", i)})
+			hits, err := indexer.Search(Query{titleField: fmt.Sprintf("appmeta%d", i)}, nil)
 			assert.Nil(tt, err)
 			assert.Len(tt, hits, 1)
 		})
@@ -120,3 +228,443 @@ func TestInMemoryIndexer_ConcurrentIndexAndSearch(t *testing.T) {
 	assert.Equal(t, count, int(indexer.Size()))
 
 }
+
+func TestInMemoryIndexer_SearchScoring(t *testing.T) {
+
+	indexer := newInMemoryIndexer(logrus.New())
+	analyzer := &Analyzer{defaultSearchFieldTokenizerMapping}
+
+	descriptions := map[string]string{
+		"mention":  "A web frontend for browsing photos, optionally backed by a database of some sort",
+		"database": "Database proxy that pools database connections",
+		"none":     "Static site generator",
+	}
+	for title, description := range descriptions {
+		m := newTestMetadata(title, "Vijay Poliboyina")
+		m.Description = description
+		_, err := indexer.Index(analyzer.AnalyzePayload(m), m)
+		assert.Nil(t, err)
+	}
+
+	hits, err := indexer.Search(Query{descriptionField: "database"}, nil)
+	assert.Nil(t, err)
+	if assert.Len(t, hits, 2) {
+		assert.Equal(t, "database", hits[0].Title)
+		assert.Equal(t, "mention", hits[1].Title)
+		assert.True(t, hits[0].Score > hits[1].Score)
+	}
+
+	// match on a boosted field outweighs the matches on the other fields
+	hits, err = indexer.Search(Query{anyField: "mention"}, Boosts{titleField: 3})
+	assert.Nil(t, err)
+	if assert.Len(t, hits, 1) {
+		assert.Equal(t, "mention", hits[0].Title)
+		assert.True(t, hits[0].Score > 0)
+	}
+}
+
+func TestParseBoostedField(t *testing.T) {
+
+	field, boost, err := parseBoostedField("title^3")
+	assert.Nil(t, err)
+	assert.Equal(t, titleField, field)
+	assert.Equal(t, 3.0, boost)
+
+	field, boost, err = parseBoostedField("title")
+	assert.Nil(t, err)
+	assert.Equal(t, titleField, field)
+	assert.Equal(t, defaultBoost, boost)
+
+	for _, invalid := range []SearchField{"title^", "title^-1", "title^x", "title^NaN"} {
+		_, _, err = parseBoostedField(invalid)
+		assert.NotNil(t, err, string(invalid))
+	}
+}
+
+func TestInMemoryIndexer_Execute(t *testing.T) {
+
+	indexer := newInMemoryIndexer(logrus.New())
+	analyzer := &Analyzer{defaultSearchFieldTokenizerMapping}
+
+	for title, name := range map[string]string{"one": "Vijay Poliboyina", "two": "John Doe", "three": "Jane Doe", "legacy": "Vijay Doe"} {
+		m := newTestMetadata(title, name)
+		_, err := indexer.Index(analyzer.AnalyzePayload(m), m)
+		assert.Nil(t, err)
+	}
+
+	titles := func(hits []*MetadataWithID) []string {
+		var result []string
+		for _, hit := range hits {
+			result = append(result, hit.Title)
+		}
+		return result
+	}
+
+	testCases := map[string]struct {
+		clause   *QueryClause
+		expected []string
+	}{
+		"should": {
+			clause:   &QueryClause{Should: []*QueryClause{TermClause(nameField, "vijay"), TermClause(nameField, "john")}},
+			expected: []string{"one", "two", "legacy"},
+		},
+		"mustNot": {
+			clause:   &QueryClause{Must: []*QueryClause{TermClause(nameField, "vijay")}, MustNot: []*QueryClause{TermClause(titleField, "legacy")}},
+			expected: []string{"one"},
+		},
+		"onlyMustNot": {
+			clause:   &QueryClause{MustNot: []*QueryClause{TermClause(nameField, "doe")}},
+			expected: []string{"one"},
+		},
+		"minimumShouldMatch": {
+			clause: &QueryClause{
+				Should:             []*QueryClause{TermClause(nameField, "vijay"), TermClause(nameField, "doe"), TermClause(titleField, "two")},
+				MinimumShouldMatch: 2,
+			},
+			expected: []string{"two", "legacy"},
+		},
+		"nested": {
+			clause: AllOf(
+				TermClause(licenseField, "apache-2.0"),
+				&QueryClause{Should: []*QueryClause{TermClause(nameField, "jane"), TermClause(nameField, "poliboyina")}},
+			),
+			expected: []string{"one", "three"},
+		},
+		"prefix": {
+			clause:   &QueryClause{Field: nameField, Value: "vij*", Wildcard: true},
+			expected: []string{"one", "legacy"},
+		},
+		"wildcard": {
+			clause:   &QueryClause{Field: titleField, Value: "*e?", Wildcard: true},
+			expected: []string{"three"},
+		},
+		"wildcardAny": {
+			clause:   &QueryClause{Field: anyField, Value: "j*n*", Wildcard: true},
+			expected: []string{"two", "three"},
+		},
+		"fuzzy": {
+			clause:   &QueryClause{Field: nameField, Value: "jahn", Fuzziness: 1},
+			expected: []string{"two"},
+		},
+		"fuzzyTwoEdits": {
+			clause:   &QueryClause{Field: nameField, Value: "jahn", Fuzziness: 2},
+			expected: []string{"two", "three"},
+		},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(tt *testing.T) {
+			hits, err := indexer.Execute(v.clause)
+			assert.Nil(tt, err)
+			assert.ElementsMatch(tt, v.expected, titles(hits))
+		})
+	}
+}
+
+func TestInMemoryIndexer_PhraseAcrossValues(t *testing.T) {
+
+	indexer := newInMemoryIndexer(logrus.New())
+	analyzer := &Analyzer{defaultSearchFieldTokenizerMapping}
+
+	m := newTestMetadata("appmeta", "Vijay Poliboyina")
+	m.Maintainers = append(m.Maintainers, Maintainer{"John Doe", "john@doe.com"})
+	_, err := indexer.Index(analyzer.AnalyzePayload(m), m)
+	assert.Nil(t, err)
+
+	phrase := func(terms ...string) *QueryClause {
+		clause := &QueryClause{Field: nameField, Phrase: true, phraseTerms: terms}
+		for i := range terms {
+			clause.phrasePositions = append(clause.phrasePositions, i)
+		}
+		return clause
+	}
+
+	hits, err := indexer.Execute(phrase("john", "doe"))
+	assert.Nil(t, err)
+	assert.Len(t, hits, 1)
+
+	// the names of the maintainers are positionGap positions apart
+	hits, err = indexer.Execute(phrase("poliboyina", "john"))
+	assert.Nil(t, err)
+	assert.Len(t, hits, 0)
+}
+
+func TestInMemoryIndexer_Explain(t *testing.T) {
+
+	indexer := newInMemoryIndexer(logrus.New())
+	analyzer := &Analyzer{defaultSearchFieldTokenizerMapping}
+
+	for _, description := range []string{"fast database for the cloud storage", "database fast cloud"} {
+		m := newTestMetadata("appmeta", "Vijay Poliboyina")
+		m.Description = description
+		_, err := indexer.Index(analyzer.AnalyzePayload(m), m)
+		assert.Nil(t, err)
+	}
+
+	leaf := func(value string) *QueryClause { return &QueryClause{Field: descriptionField, Value: value} }
+	phrase := &QueryClause{Field: descriptionField, Phrase: true, phraseTerms: []string{"fast", "database"},
+		phrasePositions: []int{0, 1}}
+
+	// the phrase matches the first only, the group of fast and missing matches neither
+	clause := &QueryClause{Should: []*QueryClause{
+		phrase,
+		{Must: []*QueryClause{leaf("fast"), leaf("missing")}},
+		leaf("cloud"),
+		{Field: descriptionField, Value: "dat*", Wildcard: true},
+	}, MustNot: []*QueryClause{leaf("storage")}}
+	hits, err := indexer.Execute(&QueryClause{Should: []*QueryClause{leaf("cloud")}})
+	assert.Nil(t, err)
+	assert.Nil(t, indexer.Explain(hits, clause))
+
+	explanations := map[string]map[SearchField][]string{}
+	for _, hit := range hits {
+		explanations[hit.Description] = hit.Explanation
+	}
+	assert.Equal(t, map[string]map[SearchField][]string{
+		"fast database for the cloud storage": nil,
+		"database fast cloud":                 {descriptionField: {"cloud", "database"}},
+	}, explanations)
+
+	clause.MustNot = nil
+	assert.Nil(t, indexer.Explain(hits, clause))
+	for _, hit := range hits {
+		explanations[hit.Description] = hit.Explanation
+	}
+	assert.Equal(t, map[SearchField][]string{descriptionField: {"cloud", "database", "fast"}},
+		explanations["fast database for the cloud storage"])
+}
+
+func TestWithinSlop(t *testing.T) {
+
+	testCases := map[string]struct {
+		positions [][]int
+		offsets   []int
+		slop      int
+		expected  bool
+	}{
+		"adjacent":        {positions: [][]int{{0, 4}, {5}}, offsets: []int{0, 1}, slop: 0, expected: true},
+		"notAdjacent":     {positions: [][]int{{0}, {2}}, offsets: []int{0, 1}, slop: 0, expected: false},
+		"gap":             {positions: [][]int{{0}, {2}}, offsets: []int{0, 1}, slop: 1, expected: true},
+		"phraseGap":       {positions: [][]int{{0}, {2}}, offsets: []int{0, 2}, slop: 0, expected: true},
+		"reversed":        {positions: [][]int{{1}, {0}}, offsets: []int{0, 1}, slop: 1, expected: false},
+		"reversedInSlop":  {positions: [][]int{{1}, {0}}, offsets: []int{0, 1}, slop: 2, expected: true},
+		"threeTerms":      {positions: [][]int{{0, 7}, {3, 8}, {9}}, offsets: []int{0, 1, 2}, slop: 0, expected: true},
+		"threeTermsInGap": {positions: [][]int{{0}, {3}, {4}}, offsets: []int{0, 1, 2}, slop: 2, expected: true},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(tt *testing.T) {
+			assert.Equal(tt, v.expected, withinSlop(v.positions, v.offsets, v.slop))
+		})
+	}
+}
+
+func TestWildcardMatch(t *testing.T) {
+
+	testCases := map[string]bool{
+		"vij*|vijay":   true,
+		"vij*|vi":      false,
+		"*sql*|mysql":  true,
+		"*sql*|sqlite": true,
+		"*sql*|sq":     false,
+		"j?n?|jane":    true,
+		"j?n?|jan":     false,
+		"a*b*c|abbbc":  true,
+		"a*b*c|acb":    false,
+		"*|":           true,
+	}
+
+	for k, expected := range testCases {
+		parts := strings.Split(k, "|")
+		assert.Equal(t, expected, wildcardMatch([]rune(parts[0]), []rune(parts[1])), k)
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+
+	distance, ok := levenshtein([]rune("upbnd"), []rune("upbound"), 2)
+	assert.True(t, ok)
+	assert.Equal(t, 2, distance)
+
+	_, ok = levenshtein([]rune("upbnd"), []rune("upbound"), 1)
+	assert.False(t, ok)
+
+	distance, ok = levenshtein([]rune("poliboyína"), []rune("poliboyina"), 1)
+	assert.True(t, ok)
+	assert.Equal(t, 1, distance)
+}
+
+func TestInMemoryIndexer_Suggest(t *testing.T) {
+
+	indexer := newInMemoryIndexer(logrus.New())
+	analyzer := &Analyzer{defaultSearchFieldTokenizerMapping}
+
+	var ids []uuid.UUID
+	for _, title := range []string{"Valid App", "valid  app", "Validator", "Vault", "Other App"} {
+		m := newTestMetadata(title, "Vijay Poliboyina")
+		id, err := indexer.Index(analyzer.AnalyzePayload(m), m)
+		assert.Nil(t, err)
+		ids = append(ids, id)
+	}
+
+	suggestions, err := indexer.Suggest(titleField, "VA", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []Suggestion{{"Valid App", 2}, {"Validator", 1}, {"Vault", 1}}, suggestions)
+
+	suggestions, _ = indexer.Suggest(titleField, "valid ", 10)
+	assert.Equal(t, []Suggestion{{"Valid App", 2}}, suggestions)
+
+	suggestions, _ = indexer.Suggest(titleField, "va", 1)
+	assert.Equal(t, []Suggestion{{"Valid App", 2}}, suggestions)
+
+	suggestions, _ = indexer.Suggest(nameField, "vij", 10)
+	assert.Equal(t, []Suggestion{{"Vijay Poliboyina", 5}}, suggestions)
+
+	suggestions, _ = indexer.Suggest(titleField, "x", 10)
+	assert.Empty(t, suggestions)
+
+	// the completions follow the deletes and the updates
+	assert.Nil(t, indexer.Delete(ids[0]))
+	m := newTestMetadata("Vaultage", "Vijay Poliboyina")
+	assert.Nil(t, indexer.Reindex(ids[1], analyzer.AnalyzePayload(m), m))
+
+	suggestions, _ = indexer.Suggest(titleField, "va", 10)
+	assert.Equal(t, []Suggestion{{"Validator", 1}, {"Vault", 1}, {"Vaultage", 1}}, suggestions)
+
+	suggestions, _ = indexer.Suggest(nameField, "vij", 10)
+	assert.Equal(t, []Suggestion{{"Vijay Poliboyina", 4}}, suggestions)
+
+	// the keys are normalized and folded, the text is the value first added
+	for _, title := range []string{"Café Search", "CAFE  search", "Ｃａｆé Search"} {
+		m := newTestMetadata(title, "Jane Doe")
+		_, err := indexer.Index(analyzer.AnalyzePayload(m), m)
+		assert.Nil(t, err)
+	}
+	for _, prefix := range []string{"cafe", "CAFÉ S", "ｃａｆ"} {
+		suggestions, _ = indexer.Suggest(titleField, prefix, 10)
+		assert.Equal(t, []Suggestion{{"Café Search", 3}}, suggestions, prefix)
+	}
+}
+
+func BenchmarkSuggest(b *testing.B) {
+
+	words := []string{"valid", "vault", "value", "search", "secure", "server", "cache", "café", "cloud", "data"}
+	s := newSuggester()
+	for i := 0; i < 100000; i++ {
+		m := newTestMetadata(fmt.Sprintf("%s %s %d", words[i%len(words)], words[i/len(words)%len(words)], i),
+			"Vijay Poliboyina")
+		s.add(m)
+	}
+
+	prefixes := []string{"v", "va", "valid", "se", "cafe c", "cloud data 1"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.suggest(titleField, prefixes[i%len(prefixes)], DefaultSuggestSize)
+	}
+}
+
+func TestInMemoryIndexer_Aggregate(t *testing.T) {
+
+	indexer := newInMemoryIndexer(logrus.New())
+	analyzer := &Analyzer{defaultSearchFieldTokenizerMapping}
+
+	for i, version := range []string{"0.1.0", "1.0.0", "1.2.0", "1.2.3-beta", "2.0.0", "2.0.0-1.2.3"} {
+		m := newTestMetadata(fmt.Sprintf("app %d", i), "Vijay Poliboyina")
+		m.Version = version
+		if i%2 == 0 {
+			m.License = "MIT"
+		}
+		_, err := indexer.Index(analyzer.AnalyzePayload(m), m)
+		assert.Nil(t, err)
+	}
+
+	aggs := map[string]*Aggregation{
+		"licenses": {Terms: &TermsAggregation{Field: licenseField}},
+		"top":      {Terms: &TermsAggregation{Field: licenseField, Size: 1}},
+		"major":    {SemverHistogram: &SemverHistogramAggregation{}},
+		"minor":    {SemverHistogram: &SemverHistogramAggregation{Interval: IntervalMinor}},
+		"versions": {Terms: &TermsAggregation{Field: versionField}},
+	}
+
+	results, err := indexer.Aggregate(nil, aggs)
+	assert.Nil(t, err)
+	assert.Equal(t, &AggregationResult{Buckets: []Bucket{{"apache-2.0", 3}, {"mit", 3}}}, results["licenses"])
+	assert.Equal(t, &AggregationResult{Buckets: []Bucket{{"apache-2.0", 3}}, Other: 3}, results["top"])
+	// the prerelease of 2.0.0-1.2.3 neither counts in 1.x nor is a bucket of the versions
+	assert.Equal(t, &AggregationResult{Buckets: []Bucket{{"0.x", 1}, {"1.x", 3}, {"2.x", 2}}}, results["major"])
+	assert.Equal(t, &AggregationResult{Buckets: []Bucket{{"0.1.x", 1}, {"1.0.x", 1}, {"1.2.x", 2}, {"2.0.x", 2}}}, results["minor"])
+	assert.Equal(t, &AggregationResult{Buckets: []Bucket{{"0.1.0", 1}, {"1.0.0", 1}, {"1.2.0", 1}, {"1.2.3-beta", 1},
+		{"2.0.0", 1}, {"2.0.0-1.2.3", 1}}}, results["versions"])
+
+	// only the hits are aggregated
+	hits, err := indexer.Search(Query{licenseField: "mit"}, nil)
+	assert.Nil(t, err)
+	results, err = indexer.Aggregate(hits, aggs)
+	assert.Nil(t, err)
+	assert.Equal(t, &AggregationResult{Buckets: []Bucket{{"mit", 3}}}, results["licenses"])
+	assert.Equal(t, &AggregationResult{Buckets: []Bucket{{"0.x", 1}, {"1.x", 1}, {"2.x", 1}}}, results["major"])
+}
+
+func TestInMemoryIndexer_Rebuild(t *testing.T) {
+
+	indexer := newInMemoryIndexer(logrus.New())
+	analyzer := &Analyzer{defaultSearchFieldTokenizerMapping}
+	perWordTitles := map[SearchField]Tokenizer{}
+	for field, tokenizer := range defaultSearchFieldTokenizerMapping {
+		perWordTitles[field] = tokenizer
+	}
+	perWordTitles[titleField] = DefaultPerWordTokenizer
+	rebuilt := &Analyzer{perWordTitles}
+
+	kept := newTestMetadata("appmeta server", "Vijay Poliboyina")
+	keptID, err := indexer.Index(analyzer.AnalyzePayload(kept), kept)
+	assert.Nil(t, err)
+	deleted := newTestMetadata("appmeta client", "Vijay Poliboyina")
+	deletedID, err := indexer.Index(analyzer.AnalyzePayload(deleted), deleted)
+	assert.Nil(t, err)
+
+	commit, err := indexer.Rebuild(rebuilt.AnalyzePayload)
+	assert.Nil(t, err)
+	_, err = indexer.Rebuild(rebuilt.AnalyzePayload)
+	assert.Equal(t, errRebuildInProgress, err)
+
+	// the changes made during the rebuild are applied to the current index and tracked for the rebuilt one
+	added := newTestMetadata("appmeta agent", "Vijay Poliboyina")
+	addedID, err := indexer.Index(analyzer.AnalyzePayload(added), added)
+	assert.Nil(t, err)
+	assert.Nil(t, indexer.Delete(deletedID))
+	updated := newTestMetadata("appmeta proxy", "Vijay Poliboyina")
+	assert.Nil(t, indexer.Reindex(keptID, analyzer.AnalyzePayload(updated), updated))
+
+	hits, err := indexer.Search(Query{titleField: "appmeta"}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, hits, 0)
+
+	commit()
+
+	for title, expected := range map[string][]uuid.UUID{
+		"appmeta":        {keptID, addedID},
+		"proxy":          {keptID},
+		"agent":          {addedID},
+		"server":         nil,
+		"client":         nil,
+		"appmeta server": nil,
+	} {
+		hits, err = indexer.Search(Query{titleField: title}, nil)
+		assert.Nil(t, err)
+		ids := make([]uuid.UUID, 0, len(hits))
+		for _, hit := range hits {
+			ids = append(ids, hit.ID)
+		}
+		assert.ElementsMatch(t, expected, ids, title)
+	}
+	assert.Equal(t, uint64(2), indexer.Size())
+
+	// a new rebuild can start once committed
+	commit, err = indexer.Rebuild(analyzer.AnalyzePayload)
+	assert.Nil(t, err)
+	commit()
+	hits, err = indexer.Search(Query{titleField: "appmeta proxy"}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, hits, 1)
+}
@@ -43,6 +43,9 @@ type Metadata struct {
 	SourceURL   string       `json:"source" yaml:"source"`
 	License     string       `json:"license" yaml:"license"`
 	Description string       `json:"description" yaml:"description"`
+
+	// Fields are the values of the custom fields by the name, see SetCustomFields.
+	Fields map[string]interface{} `json:"fields,omitempty" yaml:"fields,omitempty"`
 }
 
 func (m Maintainer) Validate() error {
@@ -64,5 +67,6 @@ func (p Metadata) Validate() error {
 		validation.Field(&p.SourceURL, validation.Required, is.URL.Error(errMessageInvalidURLFormat)),
 		validation.Field(&p.Description, validation.Required, validation.Length(4, 1024).Error(errMessageInvalidLengthLong)),
 		validation.Field(&p.License, validation.Required, validation.Length(4, 64).Error(errMessageInvalidLength)),
+		validation.Field(&p.Fields, validation.By(validateCustomFields)),
 	)
 }
@@ -35,7 +35,7 @@ func TestMaintainer_Validate(t *testing.T) {
 	}
 }
 
-func Testmetadata_Validate(t *testing.T) {
+func TestMetadata_Validate(t *testing.T) {
 
 	testCases := map[string]struct {
 		metadata             Metadata
@@ -69,7 +69,7 @@ func Testmetadata_Validate(t *testing.T) {
 				License:     "Apache-2.0",
 				Description: "some markdown",
 			},
-			expectedErrorMessage: "Version:",
+			expectedErrorMessage: "version:",
 		},
 		"invalidEmail": {
 			metadata: Metadata{
@@ -85,7 +85,7 @@ func Testmetadata_Validate(t *testing.T) {
 				License:     "Apache-2.0",
 				Description: "some markdown",
 			},
-			expectedErrorMessage: "Email:",
+			expectedErrorMessage: "email:",
 		},
 		"invalidMaintainerCount": {
 			metadata: Metadata{
@@ -98,7 +98,7 @@ func Testmetadata_Validate(t *testing.T) {
 				License:     "Apache-2.0",
 				Description: "some markdown",
 			},
-			expectedErrorMessage: "Maintainers:",
+			expectedErrorMessage: "maintainers:",
 		},
 	}
 
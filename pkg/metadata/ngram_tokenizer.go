@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// TokenTypeGram is the type of the n-gram tokens
+	TokenTypeGram = "gram"
+)
+
+var (
+	// TokenCharClasses are the classes of the characters the n-gram tokenizers keep in the tokens by the name
+	TokenCharClasses = map[string]func(rune) bool{
+		"letter":      unicode.IsLetter,
+		"digit":       unicode.IsDigit,
+		"whitespace":  unicode.IsSpace,
+		"punctuation": unicode.IsPunct,
+		"symbol":      unicode.IsSymbol,
+	}
+)
+
+type NGramTokenizerOption func(t *ngramTokenizer) bool
+
+// ngramTokenizer breaks the normalized (NFKC) and lowercased input into the words of the token characters, all the
+// characters make up a single word when no classes are given, and emits the n-grams of minGram to maxGram characters of
+// each word, or only the prefixes of each word when edge is set e.g. appmeta becomes ap, app, pp, ppm, pm, pme ... for
+// the n-grams of 2 to 3 characters and ap, app for the edge n-grams.
+//
+// The search values are broken into the longest n-grams only i.e. the grams of maxGram characters, or the whole word
+// when shorter, so that all of them matching is a substring (or a prefix) match of the indexed value.
+type ngramTokenizer struct {
+	minGram    int
+	maxGram    int
+	edge       bool
+	tokenChars []func(rune) bool
+}
+
+// NewNGramTokenizer makes a tokenizer of the n-grams of minGram to maxGram characters.
+func NewNGramTokenizer(minGram, maxGram int, options ...NGramTokenizerOption) Tokenizer {
+	return newNGramTokenizer(&ngramTokenizer{minGram: minGram, maxGram: maxGram}, options)
+}
+
+// NewEdgeNGramTokenizer makes a tokenizer of the prefixes of minGram to maxGram characters, suitable for the search as
+// you type.
+func NewEdgeNGramTokenizer(minGram, maxGram int, options ...NGramTokenizerOption) Tokenizer {
+	return newNGramTokenizer(&ngramTokenizer{minGram: minGram, maxGram: maxGram, edge: true}, options)
+}
+
+func newNGramTokenizer(tokenizer *ngramTokenizer, options []NGramTokenizerOption) Tokenizer {
+	for _, option := range options {
+		option(tokenizer)
+	}
+	return tokenizer
+}
+
+// WithTokenChars keeps the characters of the classes in the tokens and splits the input on the rest, e.g.
+// TokenCharClasses["letter"].
+func WithTokenChars(classes ...func(rune) bool) NGramTokenizerOption {
+	return func(t *ngramTokenizer) bool {
+		t.tokenChars = append(t.tokenChars, classes...)
+		return true
+	}
+}
+
+func (t *ngramTokenizer) Tokenize(input string) []string {
+	return t.TokenStream(input).Terms()
+}
+
+func (t *ngramTokenizer) TokenStream(input string) TokenStream {
+	return t.tokenStream(input, t.minGram)
+}
+
+func (t *ngramTokenizer) QueryTokenStream(input string) TokenStream {
+	return t.tokenStream(input, t.maxGram)
+}
+
+// tokenStream emits the grams of minGram (or the whole word when shorter) to maxGram characters of each word, a word
+// shorter than the minGram has no grams.
+func (t *ngramTokenizer) tokenStream(input string, minGram int) TokenStream {
+	lower, toInput := normalizeWithOffsets(input)
+
+	var tokens TokenStream
+	for _, word := range t.words(lower) {
+		// the byte offsets of the runes of the word, along with the end of the word
+		var runes []int
+		for i := word.Start; i < word.End; {
+			runes = append(runes, i)
+			_, size := utf8.DecodeRuneInString(lower[i:])
+			i += size
+		}
+		runes = append(runes, word.End)
+
+		length := len(runes) - 1
+		if length < t.minGram {
+			continue
+		}
+		shortest := minGram
+		if shortest > length {
+			shortest = length
+		}
+
+		for start := 0; start < length; start++ {
+			if t.edge && start > 0 {
+				break
+			}
+			for n := shortest; n <= t.maxGram && start+n <= length; n++ {
+				startOffset, endOffset := toInput(runes[start], runes[start+n])
+				tokens = append(tokens, Token{
+					Term:        lower[runes[start]:runes[start+n]],
+					Position:    len(tokens),
+					StartOffset: startOffset,
+					EndOffset:   endOffset,
+					Type:        TokenTypeGram,
+				})
+			}
+		}
+	}
+	return tokens
+}
+
+// words returns the byte ranges of the runs of the token characters.
+func (t *ngramTokenizer) words(input string) []ByteSpan {
+	if len(t.tokenChars) == 0 {
+		if input == "" {
+			return nil
+		}
+		return []ByteSpan{{Start: 0, End: len(input)}}
+	}
+
+	var (
+		words []ByteSpan
+		start = -1
+	)
+	for i, r := range input {
+		switch {
+		case t.isTokenChar(r) && start < 0:
+			start = i
+		case !t.isTokenChar(r) && start >= 0:
+			words = append(words, ByteSpan{Start: start, End: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words = append(words, ByteSpan{Start: start, End: len(input)})
+	}
+	return words
+}
+
+func (t *ngramTokenizer) isTokenChar(r rune) bool {
+	for _, class := range t.tokenChars {
+		if class(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var (
+	errInvalidPatch = errors.New("patch does not match metadata schema")
+)
+
+// mergePatch applies the patch on top of the target as described by the JSON Merge Patch rfc7386. Objects are merged
+// recursively, null values remove the corresponding member from the target and any other value replaces the target.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for k, v := range patchObject {
+		if v == nil {
+			delete(targetObject, k)
+			continue
+		}
+		targetObject[k] = mergePatch(targetObject[k], v)
+	}
+	return targetObject
+}
+
+// applyPatch returns a new Metadata that is the result of merging the patch on top of the given metadata, the given
+// metadata is left untouched.
+func applyPatch(m *Metadata, patch map[string]interface{}) (*Metadata, error) {
+	var target interface{}
+
+	original, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(original, &target); err != nil {
+		return nil, err
+	}
+
+	patched, err := json.Marshal(mergePatch(target, patch))
+	if err != nil {
+		return nil, errInvalidPatch
+	}
+
+	result := &Metadata{}
+	if err = json.Unmarshal(patched, result); err != nil {
+		return nil, errInvalidPatch
+	}
+	return result, nil
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// PatternSplitGroup splits the input on the matches of the pattern instead of emitting a group of the matches
+	PatternSplitGroup = -1
+
+	// patternFlags are the flags of the Go regular expressions i.e. case insensitive, multi line, . matches \n and
+	// ungreedy
+	patternFlags = "imsU"
+)
+
+// patternTokenizer either splits the normalized (NFKC) input on the matches of the pattern or emits the group of each
+// match, the whole match for the group 0, and lowercases the terms. The empty terms are skipped.
+type patternTokenizer struct {
+	pattern *regexp.Regexp
+	group   int
+}
+
+// NewPatternTokenizer makes a tokenizer of the regular expression with the flags (any of i, m, s and U), the group is
+// PatternSplitGroup to split the input on the matches or the group of the matches to emit e.g. `[/|]+` with
+// PatternSplitGroup splits foo/bar|baz into foo, bar and baz.
+func NewPatternTokenizer(pattern, flags string, group int) (Tokenizer, error) {
+	for _, flag := range flags {
+		if !strings.ContainsRune(patternFlags, flag) {
+			return nil, fmt.Errorf("invalid flag %q, has to be one of %s", flag, strings.Join(strings.Split(patternFlags, ""), ", "))
+		}
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if group < PatternSplitGroup || group > re.NumSubexp() {
+		return nil, fmt.Errorf("invalid group %d, the pattern has %d groups", group, re.NumSubexp())
+	}
+	return &patternTokenizer{pattern: re, group: group}, nil
+}
+
+func (t *patternTokenizer) Tokenize(input string) []string {
+	return t.TokenStream(input).Terms()
+}
+
+func (t *patternTokenizer) TokenStream(input string) TokenStream {
+	normalized, spans := NFKCCharFilter.Filter(input)
+
+	var tokens TokenStream
+	add := func(start, end int) {
+		if start < 0 || start >= end {
+			return
+		}
+		startOffset, endOffset := mapSpan(spans, len(input), start, end)
+		tokens = append(tokens, Token{
+			Term:        strings.ToLower(normalized[start:end]),
+			Position:    len(tokens),
+			StartOffset: startOffset,
+			EndOffset:   endOffset,
+			Type:        TokenTypeWord,
+		})
+	}
+
+	matches := t.pattern.FindAllStringSubmatchIndex(normalized, -1)
+	if t.group != PatternSplitGroup {
+		for _, match := range matches {
+			add(match[2*t.group], match[2*t.group+1])
+		}
+		return tokens
+	}
+
+	cursor := 0
+	for _, match := range matches {
+		add(cursor, match[0])
+		cursor = match[1]
+	}
+	add(cursor, len(normalized))
+	return tokens
+}
@@ -0,0 +1,351 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"bufio"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	walFileName      = "wal.log"
+	snapshotFileName = "snapshot.dat"
+
+	defaultSnapshotInterval  = 5 * time.Minute
+	defaultSnapshotThreshold = 10000
+)
+
+type PersistentIndexerOption func(*persistentIndexer) bool
+
+// persistentIndexer makes the inMemoryIndexer durable by
+//	1. appending every Index/Reindex/Delete call to a checksummed write-ahead log before applying it in memory
+//	2. periodically writing a compacted snapshot of the whole index and truncating the write-ahead log
+// Only the metadata is persisted, on startup the metadata is restored from the snapshot followed by the replay of the
+// write-ahead log and analyzed with the current analyzer, so that the changes of the analyzer config between the
+// restarts are picked up. Searches are served straight from the embedded inMemoryIndexer.
+type persistentIndexer struct {
+	*inMemoryIndexer
+
+	// serializes the writes so that the log order is the same as the order in which the changes are applied
+	writeMutex *sync.Mutex
+	dataDir    string
+	wal        *os.File
+
+	// number of records appended to the log since the last snapshot
+	pendingRecords    int
+	snapshotInterval  time.Duration
+	snapshotThreshold int
+
+	// fsyncs the log on every write, otherwise a write is durable across a crash of the process but the writes since
+	// the last snapshot (or the graceful shutdown) can be lost on a crash of the OS or a power failure
+	syncWrites bool
+
+	// analyzes the restored metadata
+	analyzer *Analyzer
+
+	// last write error, reported through the Health API
+	lastErr error
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce *sync.Once
+	closeErr  error
+}
+
+// NewPersistentIndexer creates an Indexer that persists the metadata in the given data directory, any previously
+// persisted metadata is loaded before returning.
+func NewPersistentIndexer(dataDir string, logger *logrus.Logger, opts ...PersistentIndexerOption) (Indexer, error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, err
+	}
+
+	p := &persistentIndexer{
+		inMemoryIndexer:   newInMemoryIndexer(logger).(*inMemoryIndexer),
+		writeMutex:        &sync.Mutex{},
+		dataDir:           dataDir,
+		snapshotInterval:  defaultSnapshotInterval,
+		snapshotThreshold: defaultSnapshotThreshold,
+		analyzer:          &Analyzer{defaultSearchFieldTokenizerMapping},
+		stop:              make(chan struct{}),
+		done:              make(chan struct{}),
+		closeOnce:         &sync.Once{},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if err := p.restore(); err != nil {
+		return nil, err
+	}
+
+	wal, err := os.OpenFile(p.walPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	p.wal = wal
+
+	go p.snapshotLoop()
+	return p, nil
+}
+
+// WithSnapshotInterval sets how often the snapshot is taken if there are changes since the last snapshot.
+func WithSnapshotInterval(interval time.Duration) PersistentIndexerOption {
+	return func(p *persistentIndexer) bool {
+		p.snapshotInterval = interval
+		return true
+	}
+}
+
+// WithSnapshotThreshold sets the number of log records after which a snapshot is taken irrespective of the interval.
+func WithSnapshotThreshold(threshold int) PersistentIndexerOption {
+	return func(p *persistentIndexer) bool {
+		p.snapshotThreshold = threshold
+		return true
+	}
+}
+
+// WithSyncWrites fsyncs the write-ahead log on every write so that no acknowledged write is lost on a power failure, at
+// the cost of the write latency. Without it the log is fsynced on the snapshots and on Close.
+func WithSyncWrites(syncWrites bool) PersistentIndexerOption {
+	return func(p *persistentIndexer) bool {
+		p.syncWrites = syncWrites
+		return true
+	}
+}
+
+// WithAnalysisMappings analyzes the restored metadata with the tokenizers of the mapping, the same mapping that the
+// service analyzes the metadata with (WithMappings).
+func WithAnalysisMappings(tokenizerMapping map[SearchField]Tokenizer) PersistentIndexerOption {
+	return func(p *persistentIndexer) bool {
+		p.analyzer = &Analyzer{tokenizerMapping}
+		return true
+	}
+}
+
+func (p *persistentIndexer) walPath() string {
+	return filepath.Join(p.dataDir, walFileName)
+}
+
+func (p *persistentIndexer) snapshotPath() string {
+	return filepath.Join(p.dataDir, snapshotFileName)
+}
+
+// restore rebuilds the in memory index from the snapshot and the write-ahead log. The snapshot is written atomically
+// so any corruption in it is reported as an error, whereas a torn record at the tail of the log is expected after a
+// crash and the log is truncated to the last good record. The metadata is analyzed once all the records are replayed.
+func (p *persistentIndexer) restore() error {
+	restored := map[uuid.UUID]*Metadata{}
+
+	// the records are idempotent as the log can contain changes that are already part of the snapshot
+	apply := func(record *logRecord) {
+		switch record.Op {
+		case logOpPut:
+			restored[record.ID] = record.Metadata
+		case logOpDelete:
+			delete(restored, record.ID)
+		}
+	}
+
+	if _, err := replayLog(p.snapshotPath(), apply); err != nil {
+		return err
+	}
+
+	offset, err := replayLog(p.walPath(), apply)
+	if err == errCorruptRecord {
+		p.logger.Warn("Truncating the write-ahead log to the last good record at offset ", offset)
+		err = os.Truncate(p.walPath(), offset)
+	}
+	if err != nil {
+		return err
+	}
+
+	for id, m := range restored {
+		p.inMemoryIndexer.indexWithID(id, p.analyzer.AnalyzePayload(m), m)
+	}
+	p.logger.Info("Restored ", p.Size(), " metadata payloads from ", p.dataDir)
+	return nil
+}
+
+// append writes the record to the log, and fsyncs it with syncWrites, has to be called with the writeMutex held. A
+// successful write clears the error of a previous one.
+func (p *persistentIndexer) append(record *logRecord) error {
+	err := writeRecord(p.wal, record)
+	if err == nil && p.syncWrites {
+		err = p.wal.Sync()
+	}
+	p.lastErr = err
+	if err != nil {
+		return err
+	}
+	p.pendingRecords++
+	return nil
+}
+
+// maybeSnapshot takes a snapshot if the log has grown beyond the threshold, has to be called with the writeMutex held.
+func (p *persistentIndexer) maybeSnapshot() {
+	if p.pendingRecords < p.snapshotThreshold {
+		return
+	}
+	if err := p.snapshot(); err != nil {
+		p.logger.Error("Error taking snapshot: ", err)
+	}
+}
+
+func (p *persistentIndexer) Index(searchTerms map[SearchField]TokenStream, m *Metadata) (uuid.UUID, error) {
+	metadataID, err := uuid.NewUUID()
+	if err != nil {
+		return uuid.Nil, errUUIDGenError
+	}
+
+	p.writeMutex.Lock()
+	defer p.writeMutex.Unlock()
+
+	if err = p.append(&logRecord{logOpPut, metadataID, m}); err != nil {
+		return uuid.Nil, err
+	}
+	p.inMemoryIndexer.indexWithID(metadataID, searchTerms, m)
+	p.maybeSnapshot()
+	return metadataID, nil
+}
+
+func (p *persistentIndexer) Reindex(id uuid.UUID, searchTerms map[SearchField]TokenStream, m *Metadata) error {
+	p.writeMutex.Lock()
+	defer p.writeMutex.Unlock()
+
+	if _, ok := p.uuid2MetadataIndex.Load(id); !ok {
+		return errNotFound
+	}
+	if err := p.append(&logRecord{logOpPut, id, m}); err != nil {
+		return err
+	}
+	err := p.inMemoryIndexer.Reindex(id, searchTerms, m)
+	p.maybeSnapshot()
+	return err
+}
+
+func (p *persistentIndexer) Delete(id uuid.UUID) error {
+	p.writeMutex.Lock()
+	defer p.writeMutex.Unlock()
+
+	if _, ok := p.uuid2MetadataIndex.Load(id); !ok {
+		return errNotFound
+	}
+	if err := p.append(&logRecord{Op: logOpDelete, ID: id}); err != nil {
+		return err
+	}
+	err := p.inMemoryIndexer.Delete(id)
+	p.maybeSnapshot()
+	return err
+}
+
+// snapshot writes the whole index to a temporary file which is atomically renamed to the snapshot file once it is
+// synced to the disk, only then the write-ahead log is truncated. Has to be called with the writeMutex held.
+func (p *persistentIndexer) snapshot() error {
+	tmpPath := p.snapshotPath() + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+
+	p.uuid2MetadataIndex.Range(func(key, val interface{}) bool {
+		err = writeRecord(w, &logRecord{logOpPut, key.(uuid.UUID), val.(*Metadata)})
+		return err == nil
+	})
+
+	if err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpPath, p.snapshotPath()); err != nil {
+		return err
+	}
+	if err = syncDir(p.dataDir); err != nil {
+		return err
+	}
+
+	// All the records in the log are part of the snapshot now.
+	if err = p.wal.Truncate(0); err != nil {
+		p.lastErr = err
+		return err
+	}
+	if err = p.wal.Sync(); err != nil {
+		p.lastErr = err
+		return err
+	}
+	p.pendingRecords = 0
+	p.lastErr = nil
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func (p *persistentIndexer) snapshotLoop() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.snapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.writeMutex.Lock()
+			if p.pendingRecords > 0 {
+				if err := p.snapshot(); err != nil {
+					p.logger.Error("Error taking snapshot: ", err)
+				}
+			}
+			p.writeMutex.Unlock()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *persistentIndexer) Health() error {
+	p.writeMutex.Lock()
+	defer p.writeMutex.Unlock()
+	return p.lastErr
+}
+
+// Close stops the background snapshots, flushes and fsyncs the write-ahead log. The calls after the first one return
+// the result of the first one.
+func (p *persistentIndexer) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.stop)
+		<-p.done
+
+		p.writeMutex.Lock()
+		defer p.writeMutex.Unlock()
+
+		if err := p.wal.Sync(); err != nil {
+			p.wal.Close()
+			p.closeErr = err
+			return
+		}
+		p.closeErr = p.wal.Close()
+	})
+	return p.closeErr
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestMetadata(title, name string) *Metadata {
+	return &Metadata{
+		Title:   title,
+		Version: "0.1.0",
+		Maintainers: []Maintainer{
+			{name, "vijaykp@gmail.com"},
+		},
+		Company:     "feye Inc.",
+		Website:     "https://feye.io",
+		SourceURL:   "https://github.com/feye.io",
+		License:     "Apache-2.0",
+		Description: "App metadata service",
+	}
+}
+
+func TestPersistentIndexer_RestoreFromLogAndSnapshot(t *testing.T) {
+
+	dataDir, err := ioutil.TempDir("", "appmeta")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dataDir)
+
+	analyzer := &Analyzer{defaultSearchFieldTokenizerMapping}
+
+	indexer, err := NewPersistentIndexer(dataDir, logrus.New())
+	assert.Nil(t, err)
+
+	m1 := newTestMetadata("appmeta", "Vijay Poliboyina")
+	id1, err := indexer.Index(analyzer.AnalyzePayload(m1), m1)
+	assert.Nil(t, err)
+
+	m2 := newTestMetadata("appmeta2", "V Poliboyina")
+	id2, err := indexer.Index(analyzer.AnalyzePayload(m2), m2)
+	assert.Nil(t, err)
+
+	// snapshot the first two payloads and keep the rest of the changes only in the log
+	p := indexer.(*persistentIndexer)
+	p.writeMutex.Lock()
+	assert.Nil(t, p.snapshot())
+	p.writeMutex.Unlock()
+
+	m3 := newTestMetadata("appmeta3", "John Doe")
+	id3, err := indexer.Index(analyzer.AnalyzePayload(m3), m3)
+	assert.Nil(t, err)
+
+	updated := newTestMetadata("appmeta2", "Jane Doe")
+	assert.Nil(t, indexer.Reindex(id2, analyzer.AnalyzePayload(updated), updated))
+	assert.Nil(t, indexer.Delete(id1))
+	assert.Nil(t, indexer.Close())
+
+	indexer, err = NewPersistentIndexer(dataDir, logrus.New())
+	assert.Nil(t, err)
+	defer indexer.Close()
+
+	assert.Equal(t, uint64(2), indexer.Size())
+
+	_, err = indexer.Get(id1)
+	assert.True(t, IsNotFoundError(err))
+
+	hit, err := indexer.Get(id3)
+	assert.Nil(t, err)
+	assert.Equal(t, "appmeta3", hit.Title)
+
+	hits, err := indexer.Search(Query{nameField: "doe"}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, hits, 2)
+
+	hits, err = indexer.Search(Query{nameField: "poliboyina"}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, hits, 0)
+}
+
+func TestPersistentIndexer_TornLogRecord(t *testing.T) {
+
+	dataDir, err := ioutil.TempDir("", "appmeta")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dataDir)
+
+	analyzer := &Analyzer{defaultSearchFieldTokenizerMapping}
+
+	indexer, err := NewPersistentIndexer(dataDir, logrus.New())
+	assert.Nil(t, err)
+
+	m1 := newTestMetadata("appmeta", "Vijay Poliboyina")
+	_, err = indexer.Index(analyzer.AnalyzePayload(m1), m1)
+	assert.Nil(t, err)
+	assert.Nil(t, indexer.Close())
+
+	// simulate a crash in the middle of appending a record
+	walPath := filepath.Join(dataDir, walFileName)
+	info, err := os.Stat(walPath)
+	assert.Nil(t, err)
+	f, err := os.OpenFile(walPath, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	_, err = f.Write([]byte{0x10, 0x00, 0x00, 0x00, 0xde, 0xad})
+	assert.Nil(t, err)
+	f.Close()
+
+	indexer, err = NewPersistentIndexer(dataDir, logrus.New())
+	assert.Nil(t, err)
+	defer indexer.Close()
+
+	assert.Equal(t, uint64(1), indexer.Size())
+	truncated, err := os.Stat(walPath)
+	assert.Nil(t, err)
+	assert.Equal(t, info.Size(), truncated.Size())
+}
+
+func TestPersistentIndexer_RestoreWithCurrentAnalyzer(t *testing.T) {
+
+	dataDir, err := ioutil.TempDir("", "appmeta")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dataDir)
+
+	analyzer := &Analyzer{defaultSearchFieldTokenizerMapping}
+
+	indexer, err := NewPersistentIndexer(dataDir, logrus.New())
+	assert.Nil(t, err)
+	m := newTestMetadata("appmeta server", "Vijay Poliboyina")
+	id, err := indexer.Index(analyzer.AnalyzePayload(m), m)
+	assert.Nil(t, err)
+
+	hits, err := indexer.Search(Query{titleField: "server"}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, hits, 0)
+	assert.Nil(t, indexer.Close())
+
+	// the analyzer config changed between the restarts, the restored metadata is analyzed with the new one
+	indexer, err = NewPersistentIndexer(dataDir, logrus.New(),
+		WithAnalysisMappings(map[SearchField]Tokenizer{titleField: DefaultPerWordTokenizer}))
+	assert.Nil(t, err)
+	defer indexer.Close()
+	hits, err = indexer.Search(Query{titleField: "server"}, nil)
+	assert.Nil(t, err)
+	if assert.Len(t, hits, 1) {
+		assert.Equal(t, id, hits[0].ID)
+	}
+}
+
+func TestPersistentIndexer_HealthAndClose(t *testing.T) {
+
+	dataDir, err := ioutil.TempDir("", "appmeta")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dataDir)
+
+	analyzer := &Analyzer{defaultSearchFieldTokenizerMapping}
+
+	indexer, err := NewPersistentIndexer(dataDir, logrus.New(), WithSyncWrites(true))
+	assert.Nil(t, err)
+	p := indexer.(*persistentIndexer)
+
+	// a failed write turns the health red until the next successful one
+	m := newTestMetadata("appmeta", "Vijay Poliboyina")
+	p.writeMutex.Lock()
+	wal := p.wal
+	assert.Nil(t, wal.Close())
+	p.writeMutex.Unlock()
+	_, err = indexer.Index(analyzer.AnalyzePayload(m), m)
+	assert.NotNil(t, err)
+	assert.NotNil(t, indexer.Health())
+
+	p.writeMutex.Lock()
+	p.wal, err = os.OpenFile(p.walPath(), os.O_WRONLY|os.O_APPEND, 0644)
+	p.writeMutex.Unlock()
+	assert.Nil(t, err)
+	_, err = indexer.Index(analyzer.AnalyzePayload(m), m)
+	assert.Nil(t, err)
+	assert.Nil(t, indexer.Health())
+
+	assert.Nil(t, indexer.Close())
+	assert.Nil(t, indexer.Close())
+}
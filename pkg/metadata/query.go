@@ -7,6 +7,14 @@ package metadata
 import (
 	"fmt"
 	validation "github.com/go-ozzo/ozzo-validation"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	boostSeparator = "^"
 )
 
 // SearchField corresponds to the fields that are searchable in the index which are essentially all the fields
@@ -27,7 +35,9 @@ var (
 	// Special meta search field that is used to match against the values of all of the above= fields.
 	anyField = SearchField("any")
 
-	allowedSearchFields = map[SearchField]bool{
+	// builtinSearchFields are the fixed fields above, the custom fields are searchable along with them, see
+	// SetCustomFields
+	builtinSearchFields = map[SearchField]bool{
 		nameField:        true,
 		emailField:       true,
 		titleField:       true,
@@ -46,9 +56,232 @@ type Query map[SearchField]string
 
 func (q Query) Validate() error {
 	for k := range q {
-		if _, ok := allowedSearchFields[k]; !ok {
+		if _, ok := currentFields().searchFields[k]; !ok {
 			return validation.NewInternalError(fmt.Errorf(" %s is not a valid search field", k))
 		}
 	}
 	return nil
 }
+
+// IndexedFields returns the sorted fields of the metadata that are indexed, i.e. all the search fields but the any field.
+func IndexedFields() []SearchField {
+	searchFields := currentFields().searchFields
+	fields := make([]SearchField, 0, len(searchFields))
+	for field := range searchFields {
+		if field != anyField {
+			fields = append(fields, field)
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i] < fields[j] })
+	return fields
+}
+
+// parseBoostedField splits the search field of the form field^boost (e.g. title^3) into the field and the boost, the
+// boost defaults to 1 when not specified.
+func parseBoostedField(field SearchField) (SearchField, float64, error) {
+	i := strings.LastIndex(string(field), boostSeparator)
+	if i < 0 {
+		return field, defaultBoost, nil
+	}
+
+	boost, err := strconv.ParseFloat(string(field[i+1:]), 64)
+	if err != nil || !(boost > 0) || math.IsInf(boost, 0) {
+		return "", 0, validation.NewInternalError(fmt.Errorf(" %s is not a valid boost for the field %s", field[i+1:], field[:i]))
+	}
+	return field[:i], boost, nil
+}
+
+const (
+	// maxClauseDepth limits the nesting of the groups so that a single query can not exhaust the stack.
+	maxClauseDepth = 32
+
+	maxSlop = 64
+
+	// maxPhraseVariants limits the number of the phrases a phrase with the stacked terms (e.g. the synonyms) expands to.
+	maxPhraseVariants = 16
+
+	fuzzySeparator = "~"
+
+	// OperatorAnd and OperatorOr combine the terms the value of a leaf clause is analyzed into
+	OperatorAnd = "and"
+	OperatorOr  = "or"
+)
+
+// QueryClause is a node of the structured boolean query. A clause is either
+//    1. a leaf that matches the Value against the Field, any field can be used to match against all the fields. The
+//       Value is analyzed with the tokenizer of the Field and the resulting terms are combined with the Operator
+//       (and by default). A Phrase leaf requires the terms to be adjacent and in the same order, Slop relaxes it to
+//       the terms being within Slop moves of each other (proximity). A Wildcard leaf matches the terms against the
+//       Value with * (any characters) and ? (single character) e.g. vij*, a Fuzziness leaf matches the terms that are
+//       within the Fuzziness edits (Levenshtein distance, at most 2) of the Value terms.
+//    2. a group that combines the nested clauses: all of Must clauses have to match, at least MinimumShouldMatch of
+//       the Should clauses have to match and none of the MustNot clauses can match.
+// MinimumShouldMatch defaults to 1 when the group has no Must clauses and to 0 (Should clauses only contribute to the
+// score) otherwise. A group of only MustNot clauses matches all the metadata except the ones that match the clauses.
+// The Boost (defaults to 1) multiplies the score of the clause.
+type QueryClause struct {
+	Field    SearchField `json:"field,omitempty" yaml:"field,omitempty"`
+	Value    string      `json:"value,omitempty" yaml:"value,omitempty"`
+	Operator string      `json:"operator,omitempty" yaml:"operator,omitempty"`
+	Phrase   bool        `json:"phrase,omitempty" yaml:"phrase,omitempty"`
+	Slop     int         `json:"slop,omitempty" yaml:"slop,omitempty"`
+
+	Wildcard  bool `json:"wildcard,omitempty" yaml:"wildcard,omitempty"`
+	Fuzziness int  `json:"fuzziness,omitempty" yaml:"fuzziness,omitempty"`
+
+	Must               []*QueryClause `json:"must,omitempty" yaml:"must,omitempty"`
+	Should             []*QueryClause `json:"should,omitempty" yaml:"should,omitempty"`
+	MustNot            []*QueryClause `json:"must_not,omitempty" yaml:"must_not,omitempty"`
+	MinimumShouldMatch int            `json:"minimum_should_match,omitempty" yaml:"minimum_should_match,omitempty"`
+
+	Boost float64 `json:"boost,omitempty" yaml:"boost,omitempty"`
+
+	// analyzed terms of a phrase leaf along with their positions relative to the first term, e.g. a dropped stop word
+	// leaves a gap, set by the service before the clause is handed over to the indexer.
+	phraseTerms     []string
+	phrasePositions []int
+}
+
+// TermClause creates a leaf clause, the field can carry a boost e.g. title^3. A value with a ~ suffix is a fuzzy leaf
+// with the edit distance following the ~ (defaults to 2) e.g. upbnd~1, a value with * or ? is a wildcard leaf e.g.
+// vij*. A \*, \? or \~ is taken literally with the escape stripped e.g. https://upbound.io/path\?x=1, as is a \\,
+// any other \ is kept as is. An escaped * or ? in a wildcard leaf still matches as a wildcard.
+func TermClause(field SearchField, value string) *QueryClause {
+	clause := &QueryClause{Field: field}
+	var unescaped strings.Builder
+	fuzzy := -1
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == escape && i+1 < len(value) && strings.IndexByte(wildcardRunes+fuzzySeparator+string(escape), value[i+1]) >= 0 {
+			i++
+			unescaped.WriteByte(value[i])
+			continue
+		}
+		switch {
+		case strings.IndexByte(wildcardRunes, c) >= 0:
+			// a fuzzy wildcard is left to the validation
+			clause.Wildcard = true
+		case string(c) == fuzzySeparator:
+			fuzzy = unescaped.Len()
+		}
+		unescaped.WriteByte(c)
+	}
+	clause.Value = unescaped.String()
+	if fuzzy > 0 && isDigits(clause.Value[fuzzy+1:]) {
+		digits := clause.Value[fuzzy+1:]
+		clause.Value = clause.Value[:fuzzy]
+		clause.Fuzziness = maxFuzziness
+		if digits != "" {
+			// out of the range distances are left to the validation
+			if clause.Fuzziness, _ = strconv.Atoi(digits); clause.Fuzziness == 0 {
+				clause.Fuzziness = -1
+			}
+		}
+	}
+	return clause
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// AllOf creates a group clause where all the given clauses have to match.
+func AllOf(clauses ...*QueryClause) *QueryClause {
+	return &QueryClause{Must: clauses}
+}
+
+// Clause converts the Query to the equivalent clause, all the filters have to match.
+func (q Query) Clause(boosts Boosts) *QueryClause {
+	clause := &QueryClause{}
+	for field, value := range q {
+		clause.Must = append(clause.Must, &QueryClause{Field: field, Value: value, Boost: boosts.boost(field)})
+	}
+	return clause
+}
+
+func (c *QueryClause) isLeaf() bool {
+	return c.Field != ""
+}
+
+func (c *QueryClause) boost() float64 {
+	if c.Boost == 0 {
+		return defaultBoost
+	}
+	return c.Boost
+}
+
+// minimumShouldMatch returns the number of Should clauses that have to match considering the defaults.
+func (c *QueryClause) minimumShouldMatch() int {
+	if c.MinimumShouldMatch == 0 && len(c.Must) == 0 && len(c.Should) > 0 {
+		return 1
+	}
+	return c.MinimumShouldMatch
+}
+
+func (c *QueryClause) Validate() error {
+	return c.validate(0)
+}
+
+func (c *QueryClause) validate(depth int) error {
+	if depth > maxClauseDepth {
+		return validation.NewInternalError(fmt.Errorf(" query is nested deeper than %d levels", maxClauseDepth))
+	}
+	if c.Boost < 0 || math.IsNaN(c.Boost) || math.IsInf(c.Boost, 0) {
+		return validation.NewInternalError(fmt.Errorf(" %v is not a valid boost", c.Boost))
+	}
+
+	if c.isLeaf() {
+		if len(c.Must) > 0 || len(c.Should) > 0 || len(c.MustNot) > 0 {
+			return validation.NewInternalError(fmt.Errorf(" field %s can not have nested clauses", c.Field))
+		}
+		if _, ok := currentFields().searchFields[c.Field]; !ok {
+			return validation.NewInternalError(fmt.Errorf(" %s is not a valid search field", c.Field))
+		}
+		if err := c.validateModifiers(); err != nil {
+			return err
+		}
+		return validateOperator(c.Operator)
+	}
+
+	if c.MinimumShouldMatch < 0 || c.MinimumShouldMatch > len(c.Should) {
+		return validation.NewInternalError(fmt.Errorf(" minimum_should_match must be between 0 and %d", len(c.Should)))
+	}
+	for _, clauses := range [][]*QueryClause{c.Must, c.Should, c.MustNot} {
+		for _, clause := range clauses {
+			if clause == nil {
+				return validation.NewInternalError(fmt.Errorf(" query has an empty clause"))
+			}
+			if err := clause.validate(depth + 1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateModifiers checks the phrase, wildcard and fuzzy modifiers of a leaf, only one of them can be used at a time.
+func (c *QueryClause) validateModifiers() error {
+	if c.Slop < 0 || c.Slop > maxSlop {
+		return validation.NewInternalError(fmt.Errorf(" slop must be between 0 and %d", maxSlop))
+	}
+	if c.Fuzziness < 0 || c.Fuzziness > maxFuzziness {
+		return validation.NewInternalError(fmt.Errorf(" fuzziness must be between 1 and %d", maxFuzziness))
+	}
+	if (c.Phrase && (c.Wildcard || c.Fuzziness > 0)) || (c.Wildcard && c.Fuzziness > 0) {
+		return validation.NewInternalError(fmt.Errorf(" field %s can only be one of a phrase, wildcard or fuzzy", c.Field))
+	}
+	return nil
+}
+
+func validateOperator(operator string) error {
+	switch strings.ToLower(operator) {
+	case "", OperatorAnd, OperatorOr:
+		return nil
+	}
+	return validation.NewInternalError(fmt.Errorf(" %s is not a valid operator, must be one of %s or %s", operator, OperatorAnd, OperatorOr))
+}
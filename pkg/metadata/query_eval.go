@@ -0,0 +1,368 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"github.com/google/uuid"
+	"sort"
+)
+
+// scoredSet is the set of metadata UUIDs matched by a clause along with the score of each match.
+type scoredSet map[uuid.UUID]float64
+
+func (s scoredSet) uuids() uuidSet {
+	set := make(uuidSet, len(s))
+	for id := range s {
+		set[id] = true
+	}
+	return set
+}
+
+// evaluate compiles the clause to the set operations over the postings, has to be called with the searchMutex held.
+func (repo *inMemoryIndexer) evaluate(clause *QueryClause) scoredSet {
+	if clause.isLeaf() {
+		return repo.evaluateLeaf(clause)
+	}
+	return repo.evaluateGroup(clause)
+}
+
+// evaluateLeaf scores the postings of the term in the field, the any field is matched against all the fields.
+func (repo *inMemoryIndexer) evaluateLeaf(clause *QueryClause) scoredSet {
+	fields := []SearchField{clause.Field}
+	if clause.Field == anyField {
+		fields = fields[:0]
+		for fieldName := range repo.searchIndex {
+			fields = append(fields, fieldName)
+		}
+	}
+
+	matches := scoredSet{}
+	for _, fieldName := range fields {
+		if len(clause.phraseTerms) > 0 {
+			for id, score := range repo.evaluatePhrase(fieldName, clause.phraseTerms, clause.phrasePositions, clause.Slop) {
+				matches[id] += clause.boost() * score
+			}
+			continue
+		}
+		if !clause.Wildcard && clause.Fuzziness == 0 {
+			for id := range repo.searchIndex[fieldName][clause.Value] {
+				matches[id] += clause.boost() * repo.termScore(id, fieldName, clause.Value)
+			}
+			continue
+		}
+		for id, score := range repo.evaluateExpanded(fieldName, clause) {
+			matches[id] += clause.boost() * score
+		}
+	}
+	return matches
+}
+
+// evaluateExpanded expands the wildcard or the fuzzy term to the matching terms of the field and scores a match with
+// the best of its matched terms, so that a metadata matching many of the expanded terms does not outscore the exact
+// matches.
+func (repo *inMemoryIndexer) evaluateExpanded(fieldName SearchField, clause *QueryClause) scoredSet {
+	var expanded []expandedTerm
+	if clause.Wildcard {
+		expanded = repo.expandWildcard(fieldName, clause.Value)
+	} else {
+		expanded = repo.expandFuzzy(fieldName, clause.Value, clause.Fuzziness)
+	}
+
+	matches := scoredSet{}
+	for _, e := range expanded {
+		for id := range repo.searchIndex[fieldName][e.term] {
+			score := e.weight * repo.termScore(id, fieldName, e.term)
+			if best, ok := matches[id]; !ok || score > best {
+				matches[id] = score
+			}
+		}
+	}
+	return matches
+}
+
+// evaluatePhrase matches the metadata that contain all the terms in the field and then checks the positions of the
+// terms are within the slop of the phrase, 0 slop requires the terms to be at the same distances as in the phrase (the
+// offsets) and in the same order. The score of a match is the sum of the term scores.
+func (repo *inMemoryIndexer) evaluatePhrase(fieldName SearchField, terms []string, offsets []int, slop int) scoredSet {
+	termIndex := repo.searchIndex[fieldName]
+
+	// start with the rarest term to keep the candidates to a minimum
+	rarest := terms[0]
+	for _, term := range terms {
+		if len(termIndex[term]) < len(termIndex[rarest]) {
+			rarest = term
+		}
+	}
+
+	matches := scoredSet{}
+	positions := make([][]int, len(terms))
+	for id := range termIndex[rarest] {
+		for i, term := range terms {
+			positions[i] = termIndex[term][id]
+		}
+		if !withinSlop(positions, offsets, slop) {
+			continue
+		}
+		for _, term := range terms {
+			matches[id] += repo.termScore(id, fieldName, term)
+		}
+	}
+	return matches
+}
+
+// withinSlop checks if there is a position of each term such that the positions, offset by the position of the term in
+// the phrase, are at most slop apart. Offsetting makes an exact phrase a 0 distance match, so the slop is the number
+// of moves that are allowed to match the phrase. Finds the smallest range that covers a position from each of the
+// sorted lists by advancing the list with the minimum position.
+func withinSlop(positions [][]int, offsets []int, slop int) bool {
+	next := make([]int, len(positions))
+	for {
+		minTerm, minPosition, maxPosition := -1, 0, 0
+		for i, termPositions := range positions {
+			if next[i] >= len(termPositions) {
+				return false
+			}
+			position := termPositions[next[i]] - offsets[i]
+			if minTerm < 0 || position < minPosition {
+				minTerm, minPosition = i, position
+			}
+			if i == 0 || position > maxPosition {
+				maxPosition = position
+			}
+		}
+		if maxPosition-minPosition <= slop {
+			return true
+		}
+		next[minTerm]++
+	}
+}
+
+// evaluateGroup intersects the matches of the Must clauses, counts the matched Should clauses against the minimum
+// should match and subtracts the matches of the MustNot clauses. The score of a match is the sum of the scores of
+// the matched Must and Should clauses.
+func (repo *inMemoryIndexer) evaluateGroup(clause *QueryClause) scoredSet {
+	var matches scoredSet
+
+	for i, must := range clause.Must {
+		mustMatches := repo.evaluate(must)
+		if i == 0 {
+			matches = mustMatches
+		} else {
+			matches = intersectionOf(matches, mustMatches)
+		}
+		if len(matches) == 0 {
+			return matches
+		}
+	}
+
+	shouldMatches := make([]scoredSet, 0, len(clause.Should))
+	for _, should := range clause.Should {
+		shouldMatches = append(shouldMatches, repo.evaluate(should))
+	}
+
+	minimumShouldMatch := clause.minimumShouldMatch()
+	if matches == nil {
+		if minimumShouldMatch > 0 {
+			// candidates are the ones that match at least one of the should clauses
+			matches = scoredSet{}
+			for _, shouldMatch := range shouldMatches {
+				for id := range shouldMatch {
+					matches[id] = 0
+				}
+			}
+		} else {
+			matches = repo.matchAll()
+		}
+	}
+
+	for id := range matches {
+		matched := 0
+		for _, shouldMatch := range shouldMatches {
+			if score, ok := shouldMatch[id]; ok {
+				matched++
+				matches[id] += score
+			}
+		}
+		if matched < minimumShouldMatch {
+			delete(matches, id)
+		}
+	}
+
+	for _, mustNot := range clause.MustNot {
+		for id := range repo.evaluate(mustNot).uuids() {
+			delete(matches, id)
+		}
+	}
+
+	if clause.Boost != 0 {
+		for id := range matches {
+			matches[id] *= clause.boost()
+		}
+	}
+	return matches
+}
+
+// matchAll returns all the metadata with zero score.
+func (repo *inMemoryIndexer) matchAll() scoredSet {
+	matches := make(scoredSet, len(repo.uuid2Terms))
+	for id := range repo.uuid2Terms {
+		matches[id] = 0
+	}
+	return matches
+}
+
+// intersectionOf returns the matches that are in both the sets with the scores added up.
+func intersectionOf(first, second scoredSet) scoredSet {
+	if len(first) > len(second) {
+		return intersectionOf(second, first)
+	}
+
+	intersection := scoredSet{}
+	for id, score := range first {
+		if otherScore, ok := second[id]; ok {
+			intersection[id] = score + otherScore
+		}
+	}
+	return intersection
+}
+
+// Explain sets the terms of the postings of each hit that matched the leaves of the clause, sorted by the field. A leaf
+// reports its terms only when it matched the hit as part of a clause that matched the hit too e.g. a phrase when its
+// terms are within the slop, a should leaf when its group matched, and the must not leaves are never reported.
+func (repo *inMemoryIndexer) Explain(hits []*MetadataWithID, clause *QueryClause) error {
+	repo.searchMutex.RLock()
+	defer repo.searchMutex.RUnlock()
+
+	e := &explainer{repo: repo, expanded: map[*QueryClause]map[SearchField][]string{}}
+	for _, hit := range hits {
+		terms, ok := e.explain(clause, hit.ID)
+		if !ok || len(terms) == 0 {
+			continue
+		}
+		hit.Explanation = map[SearchField][]string{}
+		for field, fieldTerms := range terms {
+			for term := range fieldTerms {
+				hit.Explanation[field] = append(hit.Explanation[field], term)
+			}
+			sort.Strings(hit.Explanation[field])
+		}
+	}
+	return nil
+}
+
+// explainer matches the clauses against the postings of a single metadata the way evaluate does against all of them,
+// the expansions of the wildcard and the fuzzy leaves are cached across the hits.
+type explainer struct {
+	repo     *inMemoryIndexer
+	expanded map[*QueryClause]map[SearchField][]string
+}
+
+// explain returns the matched terms of the leaves by the field if the clause matched the metadata.
+func (e *explainer) explain(clause *QueryClause, id uuid.UUID) (map[SearchField]map[string]bool, bool) {
+	if clause.isLeaf() {
+		return e.explainLeaf(clause, id)
+	}
+
+	terms := map[SearchField]map[string]bool{}
+	merge := func(matched map[SearchField]map[string]bool) {
+		for field, fieldTerms := range matched {
+			if terms[field] == nil {
+				terms[field] = map[string]bool{}
+			}
+			for term := range fieldTerms {
+				terms[field][term] = true
+			}
+		}
+	}
+
+	for _, must := range clause.Must {
+		matched, ok := e.explain(must, id)
+		if !ok {
+			return nil, false
+		}
+		merge(matched)
+	}
+	matchedShould := 0
+	for _, should := range clause.Should {
+		if matched, ok := e.explain(should, id); ok {
+			matchedShould++
+			merge(matched)
+		}
+	}
+	if matchedShould < clause.minimumShouldMatch() {
+		return nil, false
+	}
+	for _, mustNot := range clause.MustNot {
+		if _, ok := e.explain(mustNot, id); ok {
+			return nil, false
+		}
+	}
+	return terms, true
+}
+
+// explainLeaf returns the terms of the leaf that are in the postings of the metadata, the terms of a phrase only when
+// their positions are within the slop.
+func (e *explainer) explainLeaf(clause *QueryClause, id uuid.UUID) (map[SearchField]map[string]bool, bool) {
+	fields := []SearchField{clause.Field}
+	if clause.Field == anyField {
+		fields = fields[:0]
+		for fieldName := range e.repo.searchIndex {
+			fields = append(fields, fieldName)
+		}
+	}
+
+	terms := map[SearchField]map[string]bool{}
+	for _, fieldName := range fields {
+		termIndex := e.repo.searchIndex[fieldName]
+		candidates := []string{clause.Value}
+		switch {
+		case len(clause.phraseTerms) > 0:
+			positions := make([][]int, len(clause.phraseTerms))
+			for i, term := range clause.phraseTerms {
+				positions[i] = termIndex[term][id]
+			}
+			if !withinSlop(positions, clause.phrasePositions, clause.Slop) {
+				continue
+			}
+			candidates = clause.phraseTerms
+		case clause.Wildcard || clause.Fuzziness > 0:
+			candidates = e.expand(fieldName, clause)
+		}
+
+		for _, term := range candidates {
+			if _, ok := termIndex[term][id]; ok {
+				if terms[fieldName] == nil {
+					terms[fieldName] = map[string]bool{}
+				}
+				terms[fieldName][term] = true
+			}
+		}
+	}
+	return terms, len(terms) > 0
+}
+
+// expand returns the terms of the field that the wildcard or the fuzzy leaf expands to.
+func (e *explainer) expand(fieldName SearchField, clause *QueryClause) []string {
+	if terms, ok := e.expanded[clause][fieldName]; ok {
+		return terms
+	}
+
+	var expanded []expandedTerm
+	if clause.Wildcard {
+		expanded = e.repo.expandWildcard(fieldName, clause.Value)
+	} else {
+		expanded = e.repo.expandFuzzy(fieldName, clause.Value, clause.Fuzziness)
+	}
+	terms := make([]string, 0, len(expanded))
+	for _, t := range expanded {
+		terms = append(terms, t.term)
+	}
+
+	if e.expanded[clause] == nil {
+		e.expanded[clause] = map[SearchField][]string{}
+	}
+	e.expanded[clause][fieldName] = terms
+	return terms
+}
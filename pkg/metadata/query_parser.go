@@ -0,0 +1,352 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type queryTokenType int
+
+const (
+	tokenEOF queryTokenType = iota
+	tokenTerm
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenRequired
+	tokenLeftParen
+	tokenRightParen
+)
+
+const (
+	fieldSeparator = ':'
+	quote          = '"'
+	escape         = '\\'
+	slopSeparator  = "~"
+)
+
+type queryToken struct {
+	tokenType queryTokenType
+
+	// only set on the term tokens
+	field  SearchField
+	value  string
+	quoted bool
+	boost  float64
+	slop   int
+}
+
+// queryLexer splits the query string into the tokens of the Lucene like syntax.
+type queryLexer struct {
+	input []rune
+	pos   int
+}
+
+func (l *queryLexer) errorf(format string, args ...interface{}) error {
+	return validation.NewInternalError(fmt.Errorf(" invalid query at position %d: "+format, append([]interface{}{l.pos}, args...)...))
+}
+
+func isTermRune(r rune) bool {
+	return !unicode.IsSpace(r) && r != '(' && r != ')' && r != quote
+}
+
+func (l *queryLexer) next() (queryToken, error) {
+	for l.pos < len(l.input) && unicode.IsSpace(l.input[l.pos]) {
+		l.pos++
+	}
+	if l.pos >= len(l.input) {
+		return queryToken{tokenType: tokenEOF}, nil
+	}
+
+	switch r := l.input[l.pos]; r {
+	case '(':
+		l.pos++
+		return queryToken{tokenType: tokenLeftParen}, nil
+	case ')':
+		l.pos++
+		return queryToken{tokenType: tokenRightParen}, nil
+	case '-', '!', '+':
+		// prefix operators apply only when directly followed by the clause
+		if l.pos+1 < len(l.input) && !unicode.IsSpace(l.input[l.pos+1]) {
+			l.pos++
+			if r == '+' {
+				return queryToken{tokenType: tokenRequired}, nil
+			}
+			return queryToken{tokenType: tokenNot}, nil
+		}
+	}
+	return l.term()
+}
+
+// term reads a [field:]value[^boost] token where value is either a quoted string or a run of non space characters.
+func (l *queryLexer) term() (queryToken, error) {
+	token := queryToken{tokenType: tokenTerm, field: anyField}
+
+	start := l.pos
+	hasField := false
+	for l.pos < len(l.input) && isTermRune(l.input[l.pos]) && l.input[l.pos] != fieldSeparator {
+		l.pos++
+	}
+	if l.pos < len(l.input) && l.input[l.pos] == fieldSeparator && l.pos > start {
+		token.field = SearchField(l.input[start:l.pos])
+		hasField = true
+		l.pos++
+	} else {
+		l.pos = start
+	}
+
+	if l.pos < len(l.input) && l.input[l.pos] == quote {
+		value, err := l.quoted()
+		if err != nil {
+			return token, err
+		}
+		token.value = value
+		token.quoted = true
+	} else {
+		valueStart := l.pos
+		for l.pos < len(l.input) && isTermRune(l.input[l.pos]) {
+			l.pos++
+		}
+		token.value = string(l.input[valueStart:l.pos])
+	}
+
+	// operators are recognized only when they are not part of a field:value term
+	if !hasField && !token.quoted {
+		switch token.value {
+		case "AND", "&&":
+			return queryToken{tokenType: tokenAnd}, nil
+		case "OR", "||":
+			return queryToken{tokenType: tokenOr}, nil
+		case "NOT":
+			return queryToken{tokenType: tokenNot}, nil
+		}
+	}
+
+	if err := l.modifiers(&token); err != nil {
+		return token, err
+	}
+	if token.value == "" {
+		return token, l.errorf("missing value for the field %s", token.field)
+	}
+	return token, nil
+}
+
+// quoted reads a quoted string, quotes can be escaped with a backslash.
+func (l *queryLexer) quoted() (string, error) {
+	var sb strings.Builder
+
+	l.pos++
+	for l.pos < len(l.input) {
+		r := l.input[l.pos]
+		l.pos++
+		switch {
+		case r == escape && l.pos < len(l.input):
+			sb.WriteRune(l.input[l.pos])
+			l.pos++
+		case r == quote:
+			return sb.String(), nil
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return "", l.errorf("unterminated quote")
+}
+
+// modifiers strips the ^boost suffix off the term and the ~slop[^boost] suffix off the quoted value.
+func (l *queryLexer) modifiers(token *queryToken) error {
+	if token.quoted {
+		// suffix follows the closing quote
+		start := l.pos
+		for l.pos < len(l.input) && isTermRune(l.input[l.pos]) {
+			l.pos++
+		}
+		return l.parseSuffix(token, string(l.input[start:l.pos]))
+	}
+
+	i := strings.LastIndex(token.value, boostSeparator)
+	if i <= 0 {
+		return nil
+	}
+	suffix := token.value[i:]
+	token.value = token.value[:i]
+	return l.parseSuffix(token, suffix)
+}
+
+func (l *queryLexer) parseSuffix(token *queryToken, suffix string) error {
+	if token.quoted && strings.HasPrefix(suffix, slopSeparator) {
+		slop := suffix[len(slopSeparator):]
+		if i := strings.Index(slop, boostSeparator); i >= 0 {
+			slop, suffix = slop[:i], slop[i:]
+		} else {
+			suffix = ""
+		}
+		n, err := strconv.Atoi(slop)
+		if err != nil || n < 0 || n > maxSlop {
+			return l.errorf("slop must be a number between 0 and %d, got %q", maxSlop, slop)
+		}
+		token.slop = n
+	}
+	if suffix == "" {
+		return nil
+	}
+	if !strings.HasPrefix(suffix, boostSeparator) {
+		return l.errorf("unexpected %s after the quoted value", suffix)
+	}
+	_, boost, err := parseBoostedField(SearchField("_" + suffix))
+	if err != nil {
+		return err
+	}
+	token.boost = boost
+	return nil
+}
+
+// queryParser is a recursive descent parser of the grammar
+//    query   := or
+//    or      := and ( OR and )*
+//    and     := unary ( [AND] unary )*
+//    unary   := ( NOT | - | ! | + ) unary | primary
+//    primary := '(' or ')' | [field:]value[~fuzziness][^boost] | [field:]"phrase"[~slop][^boost]
+// Adjacent clauses without an operator are combined with AND, quoted values are phrases and values with * or ? are
+// wildcards unless escaped, see TermClause.
+type queryParser struct {
+	lexer   *queryLexer
+	current queryToken
+}
+
+// ParseQueryString parses the Lucene like query string e.g.
+//    license:apache-2.0 AND (name:vijay OR company:upbound) -title:legacy
+// into the equivalent clause. Values without a field are matched against any field.
+func ParseQueryString(q string) (*QueryClause, error) {
+	p := &queryParser{lexer: &queryLexer{input: []rune(q)}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.current.tokenType == tokenEOF {
+		return nil, p.lexer.errorf("empty query")
+	}
+
+	clause, err := p.or(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.current.tokenType != tokenEOF {
+		return nil, p.lexer.errorf("unexpected token")
+	}
+	return clause, nil
+}
+
+func (p *queryParser) advance() error {
+	token, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.current = token
+	return nil
+}
+
+func (p *queryParser) or(depth int) (*QueryClause, error) {
+	first, err := p.and(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	clauses := []*QueryClause{first}
+	for p.current.tokenType == tokenOr {
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+		next, err := p.and(depth)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, next)
+	}
+	if len(clauses) == 1 {
+		return first, nil
+	}
+	return &QueryClause{Should: clauses}, nil
+}
+
+func (p *queryParser) and(depth int) (*QueryClause, error) {
+	group := &QueryClause{}
+	for {
+		if err := p.unary(depth, group); err != nil {
+			return nil, err
+		}
+
+		switch p.current.tokenType {
+		case tokenAnd:
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		case tokenTerm, tokenNot, tokenRequired, tokenLeftParen:
+			// implicit AND
+		default:
+			if len(group.Must) == 1 && len(group.MustNot) == 0 {
+				return group.Must[0], nil
+			}
+			return group, nil
+		}
+	}
+}
+
+// unary parses a clause and adds it to the group, either as a Must or as a MustNot clause.
+func (p *queryParser) unary(depth int, group *QueryClause) error {
+	negated := false
+	for p.current.tokenType == tokenNot || p.current.tokenType == tokenRequired {
+		if p.current.tokenType == tokenNot {
+			negated = !negated
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+	}
+
+	clause, err := p.primary(depth)
+	if err != nil {
+		return err
+	}
+	if negated {
+		group.MustNot = append(group.MustNot, clause)
+	} else {
+		group.Must = append(group.Must, clause)
+	}
+	return nil
+}
+
+func (p *queryParser) primary(depth int) (*QueryClause, error) {
+	switch p.current.tokenType {
+	case tokenLeftParen:
+		if depth >= maxClauseDepth {
+			return nil, p.lexer.errorf("query is nested deeper than %d levels", maxClauseDepth)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		clause, err := p.or(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if p.current.tokenType != tokenRightParen {
+			return nil, p.lexer.errorf("missing closing parenthesis")
+		}
+		return clause, p.advance()
+	case tokenTerm:
+		token := p.current
+		if token.quoted {
+			return &QueryClause{Field: token.field, Value: token.value, Phrase: true, Slop: token.slop, Boost: token.boost}, p.advance()
+		}
+		clause := TermClause(token.field, token.value)
+		clause.Boost = token.boost
+		return clause, p.advance()
+	default:
+		return nil, p.lexer.errorf("expecting a term or a group")
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseQueryString(t *testing.T) {
+
+	clause, err := ParseQueryString(`license:apache-2.0 AND (name:vijay OR company:upbound) -title:legacy`)
+	assert.Nil(t, err)
+	assert.Equal(t, &QueryClause{
+		Must: []*QueryClause{
+			{Field: licenseField, Value: "apache-2.0"},
+			{Should: []*QueryClause{
+				{Field: nameField, Value: "vijay"},
+				{Field: companyField, Value: "upbound"},
+			}},
+		},
+		MustNot: []*QueryClause{
+			{Field: titleField, Value: "legacy"},
+		},
+	}, clause)
+
+	clause, err = ParseQueryString(`name:"vijay poliboyina"^2 OR source:https://github.com/upbound`)
+	assert.Nil(t, err)
+	assert.Equal(t, &QueryClause{
+		Should: []*QueryClause{
+			{Field: nameField, Value: "vijay poliboyina", Phrase: true, Boost: 2},
+			{Field: sourceField, Value: "https://github.com/upbound"},
+		},
+	}, clause)
+
+	clause, err = ParseQueryString(`description:"cloud database"~3^2`)
+	assert.Nil(t, err)
+	assert.Equal(t, &QueryClause{Field: descriptionField, Value: "cloud database", Phrase: true, Slop: 3, Boost: 2}, clause)
+
+	clause, err = ParseQueryString(`name:vij* company:upbnd~1^2 *sql*`)
+	assert.Nil(t, err)
+	assert.Equal(t, &QueryClause{
+		Must: []*QueryClause{
+			{Field: nameField, Value: "vij*", Wildcard: true},
+			{Field: companyField, Value: "upbnd", Fuzziness: 1, Boost: 2},
+			{Field: anyField, Value: "*sql*", Wildcard: true},
+		},
+	}, clause)
+
+	// the escaped wildcard and fuzzy runes are literal
+	clause, err = ParseQueryString(`website:https://upbound.io/path\?x=1 title:a\*b~1 version:1.0\~2 name:c\\d\e`)
+	assert.Nil(t, err)
+	assert.Equal(t, &QueryClause{
+		Must: []*QueryClause{
+			{Field: websiteField, Value: "https://upbound.io/path?x=1"},
+			{Field: titleField, Value: "a*b", Fuzziness: 1},
+			{Field: versionField, Value: "1.0~2"},
+			{Field: nameField, Value: `c\d\e`},
+		},
+	}, clause)
+
+	clause, err = ParseQueryString(`because NOT company:feye`)
+	assert.Nil(t, err)
+	assert.Equal(t, &QueryClause{
+		Must:    []*QueryClause{{Field: anyField, Value: "because"}},
+		MustNot: []*QueryClause{{Field: companyField, Value: "feye"}},
+	}, clause)
+
+	for _, invalid := range []string{"", "(name:vijay", "name:vijay)", `title:"valid`, "name:", "AND", "title:a^x", `title:"a"b`, `title:"a b"~`, `title:"a b"~-1`, `title:"a b"~x^2`} {
+		_, err = ParseQueryString(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
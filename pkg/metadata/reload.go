@@ -0,0 +1,40 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"time"
+)
+
+const (
+	// ReloadStateIdle is the state of a service that was never reloaded
+	ReloadStateIdle = "idle"
+
+	// ReloadStateReloading is the state while the metadata is reindexed with the reloaded tokenizers
+	ReloadStateReloading = "reloading"
+
+	// ReloadStateReloaded is the state once the reloaded tokenizers and the reindexed metadata are in use
+	ReloadStateReloaded = "reloaded"
+
+	// ReloadStateFailed is the state when the last reload failed, the previous tokenizers are still in use
+	ReloadStateFailed = "failed"
+)
+
+// TokenizerLoader loads the tokenizers of the search fields along with the named tokenizers e.g. from the analyzer
+// config, see Service.Reload.
+type TokenizerLoader func() (map[SearchField]Tokenizer, map[string]Tokenizer, error)
+
+// ReloadStatus is the status of the last reload, reported through the health endpoint.
+type ReloadStatus struct {
+	State      string     `json:"state" yaml:"state"`
+	StartedAt  *time.Time `json:"started_at,omitempty" yaml:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" yaml:"finished_at,omitempty"`
+
+	// Number of the metadata payloads reindexed by the reload
+	Reindexed uint64 `json:"reindexed,omitempty" yaml:"reindexed,omitempty"`
+
+	// Reason the last reload failed
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
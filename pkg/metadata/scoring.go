@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"github.com/google/uuid"
+	"math"
+	"sort"
+)
+
+const (
+	// bm25K1 controls the term frequency saturation, higher the value slower the saturation.
+	bm25K1 = 1.2
+
+	// bm25B controls how much the field length normalizes the score, 0 disables the normalization.
+	bm25B = 0.75
+
+	defaultBoost = 1.0
+)
+
+// Boosts is an alias of searchfield->boost map, matches in the fields with higher boost contribute more to the score.
+type Boosts map[SearchField]float64
+
+func (b Boosts) boost(field SearchField) float64 {
+	if v, ok := b[field]; ok {
+		return v
+	}
+	return defaultBoost
+}
+
+// bm25 computes the Okapi BM25 relevance of a term in a field given
+//    1. frequency: number of occurrences of the term in the field of the metadata
+//    2. fieldLength and avgFieldLength: number of terms in the field of the metadata and the average across all metadata
+//    3. docCount and docFrequency: number of metadata in the index and the number of them that contain the term
+func bm25(frequency, fieldLength int, avgFieldLength float64, docCount, docFrequency int) float64 {
+	if frequency == 0 || docFrequency == 0 {
+		return 0
+	}
+
+	idf := math.Log(1 + (float64(docCount-docFrequency)+0.5)/(float64(docFrequency)+0.5))
+
+	norm := 1.0
+	if avgFieldLength > 0 {
+		norm = 1 - bm25B + bm25B*float64(fieldLength)/avgFieldLength
+	}
+	tf := float64(frequency)
+	return idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+}
+
+// termScore scores a single field->term match of the metadata, has to be called with the searchMutex held.
+func (repo *inMemoryIndexer) termScore(id uuid.UUID, fieldName SearchField, term string) float64 {
+	postings := repo.searchIndex[fieldName][term]
+	positions, ok := postings[id]
+	if !ok {
+		return 0
+	}
+
+	docCount := int(repo.Size())
+	avgFieldLength := 0.0
+	if docCount > 0 {
+		avgFieldLength = float64(repo.fieldLengths[fieldName]) / float64(docCount)
+	}
+	return bm25(len(positions), len(repo.uuid2Terms[id][fieldName]), avgFieldLength, docCount, len(postings))
+}
+
+// sortByScore sorts the hits by descending score, ties are broken by the ID for a stable order across calls.
+func sortByScore(hits []*MetadataWithID) {
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID.String() < hits[j].ID.String()
+	})
+}
@@ -0,0 +1,265 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultPageSize = 10
+	MaxPageSize     = 1000
+
+	scoreSortField = "_score"
+	idSortField    = "_id"
+
+	descendingPrefix = "-"
+	sortSeparator    = ","
+)
+
+var (
+	errInvalidCursor        = errors.New("invalid search_after cursor")
+	errCursorWithFrom       = errors.New("from can not be used along with search_after")
+	errMessageInvalidSize   = fmt.Sprintf("must be between 0 and %d", MaxPageSize)
+	errMessageNegativeValue = "must not be negative"
+
+	// sortableFields maps the fields the hits can be sorted on to the stored value of the field.
+	sortableFields = map[string]func(*MetadataWithID) string{
+		"title":   func(m *MetadataWithID) string { return m.Title },
+		"version": func(m *MetadataWithID) string { return m.Version },
+		"company": func(m *MetadataWithID) string { return m.Company },
+		"website": func(m *MetadataWithID) string { return m.Website },
+		"source":  func(m *MetadataWithID) string { return m.SourceURL },
+		"license": func(m *MetadataWithID) string { return m.License },
+		scoreSortField: func(m *MetadataWithID) string {
+			return strconv.FormatFloat(m.Score, 'g', -1, 64)
+		},
+		idSortField: func(m *MetadataWithID) string { return m.ID.String() },
+	}
+)
+
+// SortField is one of the comma separated sort criteria of the form [-]field, - denotes a descending sort.
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+// ParseSort parses the sort specification e.g. title,-version
+func ParseSort(spec string) ([]SortField, error) {
+	var sortFields []SortField
+	for _, v := range strings.Split(spec, sortSeparator) {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		field := SortField{Field: strings.TrimPrefix(v, descendingPrefix), Descending: strings.HasPrefix(v, descendingPrefix)}
+		if _, ok := sortableFields[field.Field]; !ok {
+			return nil, validation.NewInternalError(fmt.Errorf(" %s is not a valid sort field", field.Field))
+		}
+		sortFields = append(sortFields, field)
+	}
+	return sortFields, nil
+}
+
+// compare compares the sort values of the field, versions are compared by their semver precedence and the text
+// fields case insensitively.
+func (s SortField) compare(a, b string) int {
+	var c int
+	switch s.Field {
+	case "version":
+		c = compareSemver(a, b)
+	case scoreSortField:
+		fa, _ := strconv.ParseFloat(a, 64)
+		fb, _ := strconv.ParseFloat(b, 64)
+		switch {
+		case fa < fb:
+			c = -1
+		case fa > fb:
+			c = 1
+		}
+	default:
+		if c = strings.Compare(strings.ToLower(a), strings.ToLower(b)); c == 0 {
+			c = strings.Compare(a, b)
+		}
+	}
+	if s.Descending {
+		return -c
+	}
+	return c
+}
+
+// SearchRequest carries the query along with the pagination and the sort criteria. The query is either a structured
+// Clause, a Lucene like QueryString or both in which case both have to match. Pagination is either offset based
+// (From, Size) or cursor based (SearchAfter, Size) where the cursor is the Next value of the previous response.
+type SearchRequest struct {
+	Clause      *QueryClause
+	QueryString string
+
+	// Operator that combines the analyzed terms of the leaf clauses that do not specify one, and by default.
+	Operator string
+
+	From        int
+	Size        int
+	Sort        []SortField
+	SearchAfter string
+
+	// Aggregations by name, computed over all the hits and not just the requested page.
+	Aggs map[string]*Aggregation
+
+	// Highlight the matched terms in the fields of the hits of the page, opt-in.
+	Highlight *HighlightRequest
+
+	// Explain reports the terms of each hit of the page that matched the query by the field, opt-in.
+	Explain bool
+}
+
+func (r *SearchRequest) Validate() error {
+	err := validation.ValidateStruct(r,
+		validation.Field(&r.From, validation.Min(0).Error(errMessageNegativeValue)),
+		validation.Field(&r.Size, validation.Min(0).Error(errMessageInvalidSize), validation.Max(MaxPageSize).Error(errMessageInvalidSize)),
+	)
+	if err != nil {
+		return err
+	}
+	if r.From > 0 && r.SearchAfter != "" {
+		return validation.NewInternalError(errCursorWithFrom)
+	}
+	for _, agg := range r.Aggs {
+		if err = agg.Validate(); err != nil {
+			return err
+		}
+	}
+	if r.Highlight != nil {
+		if err = r.Highlight.Validate(); err != nil {
+			return err
+		}
+	}
+	return validateOperator(r.Operator)
+}
+
+// clause combines the structured clause and the query string of the request, nil is returned for an empty query.
+func (r *SearchRequest) clause() (*QueryClause, error) {
+	var clauses []*QueryClause
+	if r.Clause != nil {
+		clauses = append(clauses, r.Clause)
+	}
+	if r.QueryString != "" {
+		clause, err := ParseQueryString(r.QueryString)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+
+	switch len(clauses) {
+	case 0:
+		return nil, nil
+	case 1:
+		return clauses[0], nil
+	}
+	return AllOf(clauses...), nil
+}
+
+// SearchResponse is the envelope of a page of hits.
+type SearchResponse struct {
+	// Total number of hits that matched the query across all the pages
+	Total int `json:"total" yaml:"total"`
+
+	// Time taken to serve the request in milliseconds
+	TookMs int64 `json:"took_ms" yaml:"took_ms"`
+
+	Hits []*MetadataWithID `json:"hits" yaml:"hits"`
+
+	// Cursor to pass as search_after to get the next page, empty on the last page.
+	Next string `json:"next,omitempty" yaml:"next,omitempty"`
+
+	// Results of the requested aggregations by name
+	Aggs map[string]*AggregationResult `json:"aggs,omitempty" yaml:"aggs,omitempty"`
+}
+
+// sortCriteria returns the sort fields of the request followed by the _id tie breaker, when no sort is requested the
+// hits of a query are sorted by the relevance.
+func (r *SearchRequest) sortCriteria() []SortField {
+	criteria := make([]SortField, 0, len(r.Sort)+2)
+	criteria = append(criteria, r.Sort...)
+	if len(criteria) == 0 && (r.Clause != nil || r.QueryString != "") {
+		criteria = append(criteria, SortField{Field: scoreSortField, Descending: true})
+	}
+	return append(criteria, SortField{Field: idSortField})
+}
+
+type sortKey []string
+
+func compareSortKeys(criteria []SortField, a, b sortKey) int {
+	for i, field := range criteria {
+		if c := field.compare(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func encodeCursor(key sortKey) string {
+	b, _ := json.Marshal(key)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(cursor string, criteria []SortField) (sortKey, error) {
+	var key sortKey
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || json.Unmarshal(b, &key) != nil || len(key) != len(criteria) {
+		return nil, validation.NewInternalError(errInvalidCursor)
+	}
+	return key, nil
+}
+
+// paginate sorts the hits as per the request and returns the requested page along with the cursor for the next page.
+func paginate(hits []*MetadataWithID, r *SearchRequest) ([]*MetadataWithID, string, error) {
+	criteria := r.sortCriteria()
+
+	keys := make(map[*MetadataWithID]sortKey, len(hits))
+	for _, hit := range hits {
+		key := make(sortKey, len(criteria))
+		for i, field := range criteria {
+			key[i] = sortableFields[field.Field](hit)
+		}
+		keys[hit] = key
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		return compareSortKeys(criteria, keys[hits[i]], keys[hits[j]]) < 0
+	})
+
+	start := r.From
+	if r.SearchAfter != "" {
+		after, err := decodeCursor(r.SearchAfter, criteria)
+		if err != nil {
+			return nil, "", err
+		}
+		start = sort.Search(len(hits), func(i int) bool {
+			return compareSortKeys(criteria, keys[hits[i]], after) > 0
+		})
+	}
+	if start > len(hits) {
+		start = len(hits)
+	}
+
+	end := start + r.Size
+	if end > len(hits) {
+		end = len(hits)
+	}
+
+	next := ""
+	if end > start && end < len(hits) {
+		next = encodeCursor(keys[hits[end-1]])
+	}
+	return hits[start:end], next, nil
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"strconv"
+	"strings"
+)
+
+// semver is the parsed form of a semantic version string (https://semver.org), build metadata is dropped as it does
+// not take part in the precedence.
+type semver struct {
+	major, minor, patch uint64
+	prerelease          []string
+}
+
+// parseSemver parses versions of the form [v]major.minor.patch[-prerelease][+build]
+func parseSemver(version string) (semver, bool) {
+	var (
+		v   semver
+		err error
+	)
+
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.Index(version, "+"); i >= 0 {
+		version = version[:i]
+	}
+	if i := strings.Index(version, "-"); i >= 0 {
+		v.prerelease = strings.Split(version[i+1:], ".")
+		version = version[:i]
+	}
+
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return v, false
+	}
+	if v.major, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		return v, false
+	}
+	if v.minor, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+		return v, false
+	}
+	if v.patch, err = strconv.ParseUint(parts[2], 10, 64); err != nil {
+		return v, false
+	}
+	return v, true
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparePrerelease compares the prerelease identifiers as per the semver precedence rules, a version without the
+// prerelease has a higher precedence than the one with.
+func comparePrerelease(a, b []string) int {
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return 0
+	case len(a) == 0:
+		return 1
+	case len(b) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(a) && i < len(b); i++ {
+		na, errA := strconv.ParseUint(a[i], 10, 64)
+		nb, errB := strconv.ParseUint(b[i], 10, 64)
+		switch {
+		case errA == nil && errB == nil:
+			if c := compareUint(na, nb); c != 0 {
+				return c
+			}
+		case errA == nil:
+			// numeric identifiers have lower precedence than alphanumeric ones
+			return -1
+		case errB == nil:
+			return 1
+		default:
+			if c := strings.Compare(a[i], b[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareUint(uint64(len(a)), uint64(len(b)))
+}
+
+func (v semver) compare(other semver) int {
+	if c := compareUint(v.major, other.major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.minor, other.minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.patch, other.patch); c != 0 {
+		return c
+	}
+	return comparePrerelease(v.prerelease, other.prerelease)
+}
+
+// compareSemver compares two version strings by their semver precedence. Versions that are not valid semver sort
+// before the valid ones and are compared lexically among themselves.
+func compareSemver(a, b string) int {
+	va, okA := parseSemver(a)
+	vb, okB := parseSemver(b)
+	switch {
+	case okA && okB:
+		return va.compare(vb)
+	case okA:
+		return 1
+	case okB:
+		return -1
+	}
+	return strings.Compare(a, b)
+}
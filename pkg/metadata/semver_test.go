@@ -0,0 +1,33 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCompareSemver(t *testing.T) {
+
+	testCases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.2.0", "1.10.0", -1},
+		{"v2.0.0", "1.99.99", 1},
+		{"1.0.0-alpha", "1.0.0", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-rc.2", "1.0.0-rc.10", -1},
+		{"1.0.0-beta", "1.0.0-alpha.1", 1},
+		{"1.0.0+build.1", "1.0.0", 0},
+		{"latest", "0.0.1", -1},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, compareSemver(tc.a, tc.b), "%s <=> %s", tc.a, tc.b)
+		assert.Equal(t, -tc.expected, compareSemver(tc.b, tc.a), "%s <=> %s", tc.b, tc.a)
+	}
+}
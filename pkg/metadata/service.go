@@ -11,14 +11,22 @@ import (
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Service interface {
-	Search(context.Context, Query) ([]*MetadataWithID, error)
+	Search(context.Context, *SearchRequest) (*SearchResponse, error)
+	Suggest(context.Context, *SuggestRequest) (*SuggestResponse, error)
+	Analyze(context.Context, *AnalyzeRequest) (*AnalyzeResponse, error)
 	GetAll(context.Context) ([]*MetadataWithID, error)
-	Delete(context.Context, uuid.UUID) bool
+	Delete(context.Context, uuid.UUID) error
 	Get(context.Context, uuid.UUID) (*MetadataWithID, error)
 	Insert(*Metadata) (uuid.UUID, error)
+	Update(context.Context, uuid.UUID, *Metadata) error
+	Patch(context.Context, uuid.UUID, map[string]interface{}) error
+	Reload(context.Context, TokenizerLoader) error
+	ReloadStatus() ReloadStatus
 	Version() string
 	Health() error
 	Shutdown(context.Context) error
@@ -28,6 +36,20 @@ type metadataSearchService struct {
 	indexer  Indexer
 	analyzer *Analyzer
 	logger   *logrus.Logger
+
+	// named tokenizers of the analyzer config that can be analyzed with
+	tokenizers map[string]Tokenizer
+
+	// held for reading while the analyzer is used along with the index, the reload swaps both of them at once
+	analysisMutex *sync.RWMutex
+
+	// serializes the reloads, statusMutex guards the reloadStatus
+	reloadMutex  *sync.Mutex
+	statusMutex  *sync.Mutex
+	reloadStatus ReloadStatus
+
+	// serializes the updates, so that an update can not land between the read and the write of a patch and be lost
+	updateMutex *sync.Mutex
 }
 
 type ServiceOption func(*metadataSearchService) bool
@@ -37,6 +59,13 @@ func NewService(logger *logrus.Logger, opts ...ServiceOption) Service {
 		indexer:  newInMemoryIndexer(logger),
 		analyzer: &Analyzer{defaultSearchFieldTokenizerMapping},
 		logger:   logger,
+
+		analysisMutex: &sync.RWMutex{},
+		reloadMutex:   &sync.Mutex{},
+		statusMutex:   &sync.Mutex{},
+		reloadStatus:  ReloadStatus{State: ReloadStateIdle},
+
+		updateMutex: &sync.Mutex{},
 	}
 	for _, opt := range opts {
 		opt(s)
@@ -51,23 +80,364 @@ func WithMappings(tokenizerMapping map[SearchField]Tokenizer) ServiceOption {
 	})
 }
 
-func (svc *metadataSearchService) processQuery(_ context.Context, query Query) (Query, error) {
-	processedQuery := Query{}
-	for k, v := range query {
-		if _, ok := allowedSearchFields[k]; !ok {
-			return nil, validation.NewInternalError(fmt.Errorf(" %s is not a valid search field", k))
+// WithTokenizers makes the named tokenizers available to the Analyze calls along with the built-in ones.
+func WithTokenizers(tokenizers map[string]Tokenizer) ServiceOption {
+	return ServiceOption(func(s *metadataSearchService) bool {
+		s.tokenizers = tokenizers
+		return true
+	})
+}
+
+// WithIndexer replaces the default in-memory indexer, e.g. with the one returned by NewPersistentIndexer
+func WithIndexer(indexer Indexer) ServiceOption {
+	return ServiceOption(func(s *metadataSearchService) bool {
+		s.indexer = indexer
+		return true
+	})
+}
+
+// processClause strips the boosts (e.g. title^3) off the search fields of the leaf clauses and analyzes their values
+// the same way the field is analyzed at the index time. The boost of the field is multiplied into the boost of the
+// clause and the operator defaults to the given operator.
+func (svc *metadataSearchService) processClause(clause *QueryClause, operator string, depth int) (*QueryClause, error) {
+	if clause == nil {
+		return nil, validation.NewInternalError(fmt.Errorf(" query has an empty clause"))
+	}
+	if depth > maxClauseDepth {
+		return nil, validation.NewInternalError(fmt.Errorf(" query is nested deeper than %d levels", maxClauseDepth))
+	}
+
+	if clause.isLeaf() {
+		field, boost, err := parseBoostedField(clause.Field)
+		if err != nil {
+			return nil, err
 		}
-		processedQuery[k] = strings.ToLower(v)
+		if _, ok := currentFields().searchFields[field]; !ok {
+			return nil, validation.NewInternalError(fmt.Errorf(" %s is not a valid search field", field))
+		}
+		if err = validateOperator(clause.Operator); err != nil {
+			return nil, err
+		}
+		if err = clause.validateModifiers(); err != nil {
+			return nil, err
+		}
+		if len(clause.Must) > 0 || len(clause.Should) > 0 || len(clause.MustNot) > 0 {
+			return nil, validation.NewInternalError(fmt.Errorf(" field %s can not have nested clauses", field))
+		}
+		if clause.Operator != "" {
+			operator = clause.Operator
+		}
+		if boost != defaultBoost {
+			boost = clause.boost() * boost
+		} else {
+			boost = clause.Boost
+		}
+		return svc.analyzeLeaf(field, clause, strings.ToLower(operator), boost), nil
 	}
-	return processedQuery, processedQuery.Validate()
-}
 
-func (svc *metadataSearchService) Search(ctx context.Context, query Query) ([]*MetadataWithID, error) {
 	var err error
-	if query, err = svc.processQuery(ctx, query); err != nil {
+	processed := &QueryClause{Boost: clause.Boost, MinimumShouldMatch: clause.MinimumShouldMatch}
+	if processed.Must, err = svc.processClauses(clause.Must, operator, depth); err != nil {
 		return nil, err
 	}
-	return svc.indexer.Search(query)
+	if processed.Should, err = svc.processClauses(clause.Should, operator, depth); err != nil {
+		return nil, err
+	}
+	if processed.MustNot, err = svc.processClauses(clause.MustNot, operator, depth); err != nil {
+		return nil, err
+	}
+	return processed, nil
+}
+
+func (svc *metadataSearchService) processClauses(clauses []*QueryClause, operator string, depth int) ([]*QueryClause, error) {
+	var processed []*QueryClause
+	for _, clause := range clauses {
+		p, err := svc.processClause(clause, operator, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		processed = append(processed, p)
+	}
+	return processed, nil
+}
+
+// analyzeLeaf rewrites the leaf into the clauses over the analyzed terms
+//    1. a wildcard leaf over the pattern whose literal segments are normalized like the field, see analyzeWildcard
+//    2. a single term leaf if the value is analyzed into a single term
+//    3. a phrase leaf over all the terms if a phrase is requested
+//    4. otherwise a group of single term leaves that are combined with the operator
+// The terms stacked on the same position (e.g. the synonyms) are alternatives, they are matched with a should group
+// and a phrase is rewritten to a should group of the phrases over each combination of the alternatives. The fuzziness
+// of the leaf is carried over to the term leaves. The any field is rewritten to a group that matches the value against
+// each of the fields analyzed with the tokenizer of that field.
+func (svc *metadataSearchService) analyzeLeaf(field SearchField, clause *QueryClause, operator string, boost float64) *QueryClause {
+	if field == anyField {
+		group := &QueryClause{Boost: boost}
+		for searchField := range currentFields().searchFields {
+			if searchField != anyField {
+				group.Should = append(group.Should, svc.analyzeLeaf(searchField, clause, operator, 0))
+			}
+		}
+		return group
+	}
+
+	if clause.Wildcard {
+		return &QueryClause{Field: field, Value: svc.analyzeWildcard(field, clause.Value), Wildcard: true, Boost: boost}
+	}
+
+	positions, offsets := termsByPosition(svc.analyzer.AnalyzeQueryTokens(field, clause.Value))
+	if !clause.Phrase {
+		positions = uniquePositions(positions)
+	}
+
+	switch {
+	case len(positions) == 0:
+		// nothing left after the analysis e.g. only stop words, fallback to the exact value
+		return &QueryClause{Field: field, Value: strings.ToLower(clause.Value), Fuzziness: clause.Fuzziness, Boost: boost}
+	case len(positions) == 1 && len(positions[0]) == 1:
+		return &QueryClause{Field: field, Value: positions[0][0], Fuzziness: clause.Fuzziness, Boost: boost}
+	case clause.Phrase && len(positions) > 1:
+		variants := phraseVariants(positions)
+		if len(variants) == 1 {
+			return &QueryClause{Field: field, Value: clause.Value, Phrase: true, Slop: clause.Slop, Boost: boost,
+				phraseTerms: variants[0], phrasePositions: offsets}
+		}
+		group := &QueryClause{Boost: boost}
+		for _, terms := range variants {
+			group.Should = append(group.Should, &QueryClause{Field: field, Value: clause.Value, Phrase: true, Slop: clause.Slop,
+				phraseTerms: terms, phrasePositions: offsets})
+		}
+		return group
+	}
+
+	group := &QueryClause{Boost: boost}
+	for _, alternatives := range positions {
+		leaf := &QueryClause{Field: field, Value: alternatives[0], Fuzziness: clause.Fuzziness}
+		if len(alternatives) > 1 {
+			leaf = &QueryClause{}
+			for _, term := range alternatives {
+				leaf.Should = append(leaf.Should, &QueryClause{Field: field, Value: term, Fuzziness: clause.Fuzziness})
+			}
+		}
+		if operator == OperatorOr || len(positions) == 1 {
+			group.Should = append(group.Should, leaf)
+		} else {
+			group.Must = append(group.Must, leaf)
+		}
+	}
+	return group
+}
+
+// analyzeWildcard runs the literal segments between the * and the ? of the pattern through the analysis of the field,
+// so that they are normalized, folded and stemmed the same way as the indexed terms e.g. josé* matches jose when the
+// field folds. The pattern as a whole is not analyzed as the tokenizers would split it at the wildcards. A segment
+// that is not analyzed into a single term (e.g. a stop word or a segment that is split or expanded into the n-grams or
+// the synonyms) is only lowercased.
+func (svc *metadataSearchService) analyzeWildcard(field SearchField, pattern string) string {
+	var sb strings.Builder
+	for {
+		i := strings.IndexAny(pattern, wildcardRunes)
+		if i < 0 {
+			sb.WriteString(svc.analyzeSegment(field, pattern))
+			return sb.String()
+		}
+		sb.WriteString(svc.analyzeSegment(field, pattern[:i]))
+		sb.WriteByte(pattern[i])
+		pattern = pattern[i+1:]
+	}
+}
+
+func (svc *metadataSearchService) analyzeSegment(field SearchField, segment string) string {
+	if segment == "" {
+		return ""
+	}
+	// the fields that chain the tokenizers (e.g. the name) analyze a single word into the same term more than once
+	tokens := svc.analyzer.AnalyzeQueryTokens(field, segment)
+	for _, token := range tokens {
+		if token.Term != tokens[0].Term {
+			return strings.ToLower(segment)
+		}
+	}
+	if len(tokens) == 0 {
+		return strings.ToLower(segment)
+	}
+	return tokens[0].Term
+}
+
+// termsByPosition groups the terms of the tokens by the position, the first term of each position is the one that was
+// not stacked. The offsets are the positions relative to the first one, i.e. the gaps of the dropped tokens are kept.
+func termsByPosition(tokens TokenStream) ([][]string, []int) {
+	var (
+		positions [][]string
+		offsets   []int
+	)
+	for i, token := range tokens {
+		if i > 0 && token.Position == tokens[i-1].Position {
+			positions[len(positions)-1] = append(positions[len(positions)-1], token.Term)
+			continue
+		}
+		positions = append(positions, []string{token.Term})
+		offsets = append(offsets, token.Position-tokens[0].Position)
+	}
+	return positions, offsets
+}
+
+// uniquePositions drops the terms that were already seen at the previous positions and the positions left empty.
+func uniquePositions(positions [][]string) [][]string {
+	seen := map[string]bool{}
+	unique := positions[:0:0]
+	for _, alternatives := range positions {
+		var terms []string
+		for _, term := range alternatives {
+			if !seen[term] {
+				seen[term] = true
+				terms = append(terms, term)
+			}
+		}
+		if len(terms) > 0 {
+			unique = append(unique, terms)
+		}
+	}
+	return unique
+}
+
+// phraseVariants returns the phrases over the combinations of the alternative terms of each position, up to
+// maxPhraseVariants. The alternatives beyond the limit are dropped from the later positions first.
+func phraseVariants(positions [][]string) [][]string {
+	variants := [][]string{nil}
+	for _, alternatives := range positions {
+		if len(variants)*len(alternatives) > maxPhraseVariants {
+			alternatives = alternatives[:1]
+		}
+		next := make([][]string, 0, len(variants)*len(alternatives))
+		for _, variant := range variants {
+			for _, term := range alternatives {
+				next = append(next, append(variant[:len(variant):len(variant)], term))
+			}
+		}
+		variants = next
+	}
+	return variants
+}
+
+// Search returns the requested page of the hits that match the query, all the metadata is considered a hit when the
+// query is empty.
+func (svc *metadataSearchService) Search(_ context.Context, request *SearchRequest) (*SearchResponse, error) {
+	var (
+		begin = time.Now()
+		hits  []*MetadataWithID
+	)
+
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+
+	svc.analysisMutex.RLock()
+	defer svc.analysisMutex.RUnlock()
+
+	clause, err := request.clause()
+	if err != nil {
+		return nil, err
+	}
+
+	if clause == nil {
+		if hits, err = svc.indexer.GetAll(); err != nil {
+			return nil, err
+		}
+	} else {
+		if clause, err = svc.processClause(clause, request.Operator, 0); err != nil {
+			return nil, err
+		}
+		if err = clause.Validate(); err != nil {
+			return nil, err
+		}
+		if hits, err = svc.indexer.Execute(clause); err != nil {
+			return nil, err
+		}
+	}
+
+	var aggs map[string]*AggregationResult
+	if len(request.Aggs) > 0 {
+		// the whole catalog is aggregated without the hits for an empty query
+		aggHits := hits
+		if clause == nil {
+			aggHits = nil
+		}
+		if aggs, err = svc.indexer.Aggregate(aggHits, request.Aggs); err != nil {
+			return nil, err
+		}
+	}
+
+	page, next, err := paginate(hits, request)
+	if err != nil {
+		return nil, err
+	}
+	if request.Highlight != nil && clause != nil {
+		svc.highlight(page, clause, request.Highlight)
+	}
+	if request.Explain && clause != nil {
+		if err = svc.indexer.Explain(page, clause); err != nil {
+			return nil, err
+		}
+	}
+	return &SearchResponse{
+		Total:  len(hits),
+		TookMs: int64(time.Since(begin) / time.Millisecond),
+		Hits:   page,
+		Next:   next,
+		Aggs:   aggs,
+	}, nil
+}
+
+// Suggest returns the completions of the prefix for the typeahead of the titles, companies and maintainer names.
+func (svc *metadataSearchService) Suggest(_ context.Context, request *SuggestRequest) (*SuggestResponse, error) {
+	begin := time.Now()
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+
+	suggestions, err := svc.indexer.Suggest(request.Field, request.Prefix, request.Size)
+	if err != nil {
+		return nil, err
+	}
+	return &SuggestResponse{
+		Suggestions: suggestions,
+		TookMs:      int64(time.Since(begin) / time.Millisecond),
+	}, nil
+}
+
+// Analyze returns the token stream of the text as analyzed by the tokenizer of the field or the named tokenizer, so that
+// the terms a value is indexed (or searched) with can be inspected.
+func (svc *metadataSearchService) Analyze(_ context.Context, request *AnalyzeRequest) (*AnalyzeResponse, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+
+	svc.analysisMutex.RLock()
+	defer svc.analysisMutex.RUnlock()
+
+	var tokens TokenStream
+	if request.Field != "" {
+		if request.Phase == AnalysisPhaseQuery {
+			tokens = svc.analyzer.AnalyzeQueryTokens(request.Field, request.Text)
+		} else {
+			tokens = svc.analyzer.AnalyzeFieldTokens(request.Field, request.Text)
+		}
+	} else {
+		tokenizer, err := svc.tokenizer(request.Tokenizer)
+		if err != nil {
+			return nil, err
+		}
+		if request.Phase == AnalysisPhaseQuery {
+			tokens = QueryTokens(tokenizer, request.Text)
+		} else {
+			tokens = Tokens(tokenizer, request.Text)
+		}
+	}
+	if tokens == nil {
+		tokens = TokenStream{}
+	}
+	return &AnalyzeResponse{Tokens: tokens}, nil
 }
 
 func (svc *metadataSearchService) GetAll(_ context.Context) ([]*MetadataWithID, error) {
@@ -80,22 +450,118 @@ func (svc *metadataSearchService) Insert(payload *Metadata) (uuid.UUID, error) {
 		return uuid.Nil, err
 	}
 
+	svc.analysisMutex.RLock()
+	defer svc.analysisMutex.RUnlock()
+
 	// breakdown the Metadata into fields to tokens maps
 	searchTerms := svc.analyzer.AnalyzePayload(payload)
 	svc.logger.Debug("Metadata Tokens: ", searchTerms)
 	return svc.indexer.Index(searchTerms, payload)
 }
 
-func (svc *metadataSearchService) Delete(_ context.Context, id uuid.UUID) bool {
-	return svc.indexer.Delete(id) == nil
+// Update replaces the metadata stored under the given ID with the supplied metadata.
+func (svc *metadataSearchService) Update(_ context.Context, id uuid.UUID, payload *Metadata) error {
+	svc.updateMutex.Lock()
+	defer svc.updateMutex.Unlock()
+
+	return svc.update(id, payload)
+}
+
+// update reindexes the metadata under the given ID, the updateMutex has to be held.
+func (svc *metadataSearchService) update(id uuid.UUID, payload *Metadata) error {
+	if err := payload.Validate(); err != nil {
+		return err
+	}
+
+	svc.analysisMutex.RLock()
+	defer svc.analysisMutex.RUnlock()
+
+	searchTerms := svc.analyzer.AnalyzePayload(payload)
+	svc.logger.Debug("Metadata Tokens: ", searchTerms)
+	return svc.indexer.Reindex(id, searchTerms, payload)
+}
+
+// Patch merges the given patch (JSON Merge Patch semantics) on top of the metadata stored under the given ID. The
+// resulting metadata goes through the same validation as the newly inserted metadata.
+func (svc *metadataSearchService) Patch(_ context.Context, id uuid.UUID, patch map[string]interface{}) error {
+	svc.updateMutex.Lock()
+	defer svc.updateMutex.Unlock()
+
+	current, err := svc.indexer.Get(id)
+	if err != nil {
+		return err
+	}
+
+	payload, err := applyPatch(current.Metadata, patch)
+	if err != nil {
+		return validation.NewInternalError(err)
+	}
+	return svc.update(id, payload)
+}
+
+// Reload loads the tokenizers and reindexes all the metadata with them in the background, the searches are served with
+// the current tokenizers and index meanwhile. The new tokenizers and index are swapped in at once when the reindexing is
+// complete, a reload that fails leaves the current ones in use. The reloads are serialized.
+func (svc *metadataSearchService) Reload(_ context.Context, load TokenizerLoader) error {
+	svc.reloadMutex.Lock()
+	defer svc.reloadMutex.Unlock()
+
+	started := time.Now()
+	svc.setReloadStatus(ReloadStatus{State: ReloadStateReloading, StartedAt: &started})
+
+	fieldTokenizers, tokenizers, err := load()
+	if err != nil {
+		return svc.reloadFailed(started, err)
+	}
+	analyzer := &Analyzer{fieldTokenizers}
+
+	commit, err := svc.indexer.Rebuild(analyzer.AnalyzePayload)
+	if err != nil {
+		return svc.reloadFailed(started, err)
+	}
+
+	svc.analysisMutex.Lock()
+	commit()
+	svc.analyzer, svc.tokenizers = analyzer, tokenizers
+	svc.analysisMutex.Unlock()
+
+	finished := time.Now()
+	reindexed := svc.indexer.Size()
+	svc.setReloadStatus(ReloadStatus{State: ReloadStateReloaded, StartedAt: &started, FinishedAt: &finished, Reindexed: reindexed})
+	svc.logger.Info("Reloaded the analysis and reindexed ", reindexed, " metadata payloads in ", finished.Sub(started))
+	return nil
+}
+
+func (svc *metadataSearchService) reloadFailed(started time.Time, err error) error {
+	finished := time.Now()
+	svc.setReloadStatus(ReloadStatus{State: ReloadStateFailed, StartedAt: &started, FinishedAt: &finished, Error: err.Error()})
+	return err
+}
+
+func (svc *metadataSearchService) setReloadStatus(status ReloadStatus) {
+	svc.statusMutex.Lock()
+	defer svc.statusMutex.Unlock()
+	svc.reloadStatus = status
+}
+
+// ReloadStatus returns the status of the last reload.
+func (svc *metadataSearchService) ReloadStatus() ReloadStatus {
+	svc.statusMutex.Lock()
+	defer svc.statusMutex.Unlock()
+	return svc.reloadStatus
+}
+
+func (svc *metadataSearchService) Delete(_ context.Context, id uuid.UUID) error {
+	return svc.indexer.Delete(id)
 }
 
 func (svc *metadataSearchService) Get(_ context.Context, id uuid.UUID) (*MetadataWithID, error) {
 	return svc.indexer.Get(id)
 }
 
+// Shutdown flushes and releases the resources held by the indexer.
 func (svc *metadataSearchService) Shutdown(_ context.Context) error {
-	return nil
+	return svc.indexer.Close()
 }
 
 func (svc *metadataSearchService) Version() string {
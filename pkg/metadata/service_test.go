@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// pausingIndexer pauses the first Get after pause is armed until it is resumed, i.e. a patch between its read and its
+// write.
+type pausingIndexer struct {
+	Indexer
+	paused, resume chan struct{}
+}
+
+func (p *pausingIndexer) Get(id uuid.UUID) (*MetadataWithID, error) {
+	m, err := p.Indexer.Get(id)
+	if p.paused != nil {
+		paused := p.paused
+		p.paused = nil
+		close(paused)
+		<-p.resume
+	}
+	return m, err
+}
+
+func TestService_ConcurrentUpdateAndPatch(t *testing.T) {
+
+	indexer := &pausingIndexer{Indexer: newInMemoryIndexer(logrus.New())}
+	service := NewService(logrus.New(), WithIndexer(indexer))
+
+	id, err := service.Insert(newTestMetadata("appmeta", "Vijay Poliboyina"))
+	assert.Nil(t, err)
+
+	indexer.paused, indexer.resume = make(chan struct{}), make(chan struct{})
+	paused := indexer.paused
+	patched := make(chan error)
+	go func() {
+		patched <- service.Patch(context.Background(), id, map[string]interface{}{"license": "MIT-0"})
+	}()
+	<-paused
+
+	// the update waits for the patch, it would otherwise land between the read and the write of the patch and be lost
+	updated := make(chan error)
+	go func() {
+		m := newTestMetadata("appmeta", "Vijay Poliboyina")
+		m.Company = "Feye Inc."
+		updated <- service.Update(context.Background(), id, m)
+	}()
+	select {
+	case err = <-updated:
+		t.Fatal("the update did not wait for the patch: ", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(indexer.resume)
+	assert.Nil(t, <-patched)
+	assert.Nil(t, <-updated)
+
+	hit, err := service.Get(context.Background(), id)
+	assert.Nil(t, err)
+	assert.Equal(t, "Feye Inc.", hit.Company)
+}
@@ -4,7 +4,16 @@
 
 package metadata
 
-import "strings"
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// WordBoundarySeparator splits the input on the Unicode word boundaries (UAX #29) instead of a separator
+	WordBoundarySeparator = "words"
+)
 
 var (
 	defaultStopWords = []string{
@@ -56,6 +65,9 @@ type StandardTokenizer struct {
 	stopWords    map[string]bool
 	splitterFunc SplitterFunc
 	trimmerFunc  TrimmerFunc
+	stemmer      Stemmer
+	synonyms     TokenFilter
+	asciiFolding bool
 }
 
 func toSet(list []string) map[string]bool {
@@ -69,7 +81,7 @@ func toSet(list []string) map[string]bool {
 
 func NewStandardTokenizer(options ...StandardTokenizerOption) Tokenizer {
 
-	stdTokenizer := &StandardTokenizer{toSet(defaultStopWords), defaultSplitter, defaultTrimmer}
+	stdTokenizer := &StandardTokenizer{stopWords: toSet(defaultStopWords), splitterFunc: defaultSplitter, trimmerFunc: defaultTrimmer}
 
 	for _, option := range options {
 		option(stdTokenizer)
@@ -85,11 +97,41 @@ func WithStopWords(stopWords []string) StandardTokenizerOption {
 	}
 }
 
+// WithStemmer stems the terms that are left after the stop words are filtered, e.g. Stemmers[EnglishStemmer].
+func WithStemmer(stemmer Stemmer) StandardTokenizerOption {
+	return func(st *StandardTokenizer) bool {
+		st.stemmer = stemmer
+		return true
+	}
+}
+
+// WithSynonyms replaces the terms with their synonyms in the given phase, before the terms are stemmed.
+func WithSynonyms(synonyms Synonyms, phase AnalysisPhase) StandardTokenizerOption {
+	return func(st *StandardTokenizer) bool {
+		st.synonyms = InPhase(NewSynonymTokenFilter(synonyms), phase)
+		return true
+	}
+}
+
+// WithASCIIFolding folds the latin letters with diacritics of the terms to ASCII e.g. josé to jose.
+func WithASCIIFolding() StandardTokenizerOption {
+	return func(st *StandardTokenizer) bool {
+		st.asciiFolding = true
+		return true
+	}
+}
+
+// WithSplitter splits the input on the separator, on the whitespace when empty or on the Unicode word boundaries when
+// WordBoundarySeparator.
 func WithSplitter(separator string) StandardTokenizerOption {
 
 	fn := defaultSplitter
 
-	if separator != "" {
+	switch separator {
+	case "":
+	case WordBoundarySeparator:
+		fn = SegmentWords
+	default:
 		fn = SplitterFunc(func(input string) []string {
 			return strings.Split(input, separator)
 		})
@@ -114,21 +156,84 @@ func WithTrimmer(cutset string) StandardTokenizerOption {
 }
 
 func (st *StandardTokenizer) Tokenize(input string) []string {
-	input = strings.ToLower(input)
+	return st.TokenStream(input).Terms()
+}
+
+// TokenStream normalizes (NFKC), lowercases, splits, trims, filters and optionally folds, replaces the synonyms and
+// stems the input into the word tokens and maps each term back to the input text. The split tokens are located in the
+// lowercased input in order, the trimmed term within its split token.
+func (st *StandardTokenizer) TokenStream(input string) TokenStream {
+	return st.tokenStream(input, AnalysisPhaseIndex)
+}
+
+func (st *StandardTokenizer) QueryTokenStream(input string) TokenStream {
+	return st.tokenStream(input, AnalysisPhaseQuery)
+}
+
+func (st *StandardTokenizer) tokenStream(input string, phase AnalysisPhase) TokenStream {
+	lower, toInput := normalizeWithOffsets(input)
 
 	var (
-		tokens []string
-		terms  []string
+		tokens   TokenStream
+		cursor   int
+		position = -1
 	)
+	for _, v := range st.splitterFunc(lower) {
+		start := cursor
+		if i := strings.Index(lower[cursor:], v); i >= 0 {
+			start += i
+			cursor = start + len(v)
+		}
 
-	tokens = st.splitterFunc(input)
-	for _, v := range tokens {
-		v = st.trimmerFunc(v)
-
-		if len(v) == 0 || len(v) == 1 || st.stopWords[v] {
+		// the dropped single letters and stop words leave a gap in the positions, the empty terms do not
+		term := st.trimmerFunc(v)
+		if term != "" {
+			position++
+		}
+		if isSingleLetter(term) || st.stopWords[term] {
 			continue
 		}
-		terms = append(terms, v)
+		begin := start
+		if i := strings.Index(v, term); i >= 0 {
+			begin += i
+		}
+		end := begin + len(term)
+		if end > len(lower) {
+			// custom splitters are not guaranteed to return the substrings of the input
+			end = len(lower)
+			if begin > end {
+				begin = end
+			}
+		}
+		startOffset, endOffset := toInput(begin, end)
+		tokens = append(tokens, Token{
+			Term:        term,
+			Position:    position,
+			StartOffset: startOffset,
+			EndOffset:   endOffset,
+			Type:        TokenTypeWord,
+		})
+	}
+
+	if st.asciiFolding {
+		tokens = mapTerms(tokens, foldASCII)
+	}
+	if st.synonyms != nil && appliesIn(st.synonyms, phase) {
+		tokens = st.synonyms.Filter(tokens)
+	}
+	if st.stemmer != nil {
+		// the offsets still span the whole words
+		tokens = mapTerms(tokens, st.stemmer)
+	}
+	return tokens
+}
+
+// isSingleLetter checks if the term is empty or a single rune other than an ideograph, the ideographs are words on
+// their own.
+func isSingleLetter(term string) bool {
+	r, size := utf8.DecodeRuneInString(term)
+	if size < len(term) {
+		return false
 	}
-	return terms
+	return size == 0 || !unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
 }
@@ -0,0 +1,308 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"golang.org/x/text/unicode/norm"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultSuggestSize = 5
+	MaxSuggestSize     = 20
+)
+
+var (
+	// suggestFields are the fixed fields that can be completed, the custom string and list fields can be completed as
+	// well.
+	suggestFields = map[SearchField]bool{
+		titleField:   true,
+		companyField: true,
+		nameField:    true,
+	}
+)
+
+// suggestValuesOf returns the function that extracts the values of the field that can be completed from the metadata,
+// the field is either one of the suggestFields or a custom string or list field.
+func suggestValuesOf(field SearchField) (func(*Metadata) []string, bool) {
+	if !suggestFields[field] {
+		custom, ok := currentFields().customFields[field]
+		if !ok || (custom.Type != FieldTypeString && custom.Type != FieldTypeList) {
+			return nil, false
+		}
+	}
+	return fieldValuesOf(field)
+}
+
+// suggestableFields returns the fields that can be completed, the suggestFields along with the custom string and list
+// fields.
+func suggestableFields() []SearchField {
+	fields := make([]SearchField, 0, len(suggestFields))
+	for field := range suggestFields {
+		fields = append(fields, field)
+	}
+	for field, custom := range currentFields().customFields {
+		if custom.Type == FieldTypeString || custom.Type == FieldTypeList {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// Suggestion is a completion of the prefix along with the number of the metadata that have the completed value.
+type Suggestion struct {
+	Text  string `json:"text" yaml:"text"`
+	Count int    `json:"count" yaml:"count"`
+}
+
+// SuggestRequest asks for the top Size completions of the Prefix in the Field, Field is one of title, company, name
+// (maintainers) or a custom string or list field.
+type SuggestRequest struct {
+	Field  SearchField
+	Prefix string
+	Size   int
+}
+
+func (r *SuggestRequest) Validate() error {
+	if _, ok := suggestValuesOf(r.Field); !ok {
+		return validation.NewInternalError(fmt.Errorf(" %s is not a valid suggest field, has to be one of %s, %s, %s or "+
+			"a custom string or list field", r.Field, companyField, nameField, titleField))
+	}
+	if r.Size < 1 || r.Size > MaxSuggestSize {
+		return validation.NewInternalError(fmt.Errorf(" size must be between 1 and %d", MaxSuggestSize))
+	}
+	return nil
+}
+
+// SuggestResponse is the envelope of the completions, the completions are sorted by the count.
+type SuggestResponse struct {
+	Suggestions []Suggestion `json:"suggestions" yaml:"suggestions"`
+	TookMs      int64        `json:"took_ms" yaml:"took_ms"`
+}
+
+// completion is a value of the field that is stored at the end of its key in the trie.
+type completion struct {
+	text  string
+	count int
+}
+
+// trieNode is a node of the trie keyed by the runes of the normalized values. Each node caches the top completions of
+// its subtree so that a lookup only walks the prefix. An added value is offered to the caches of the nodes on its
+// path, a removed value can let a completion outside of the cache in, so the caches on its path are marked stale and
+// are recomputed from the caches of the children on the next lookup.
+type trieNode struct {
+	children   map[rune]*trieNode
+	completion *completion
+
+	top   []*completion
+	stale bool
+}
+
+func newTrieNode() *trieNode {
+	return &trieNode{children: map[rune]*trieNode{}}
+}
+
+// rankedBefore orders the completions by the count and then by the text.
+func rankedBefore(a, b *completion) bool {
+	if a.count != b.count {
+		return a.count > b.count
+	}
+	return a.text < b.text
+}
+
+// offer updates the cached top completions with the completion whose count went up.
+func (n *trieNode) offer(c *completion) {
+	if n.stale {
+		return
+	}
+	i := 0
+	for i < len(n.top) && n.top[i] != c {
+		i++
+	}
+	switch {
+	case i < len(n.top):
+		// already cached, its count went up
+	case len(n.top) < MaxSuggestSize:
+		n.top = append(n.top, c)
+	case rankedBefore(c, n.top[i-1]):
+		i--
+		n.top[i] = c
+	default:
+		return
+	}
+	// move the completion up to its rank
+	for ; i > 0 && rankedBefore(n.top[i], n.top[i-1]); i-- {
+		n.top[i], n.top[i-1] = n.top[i-1], n.top[i]
+	}
+}
+
+// topCompletions returns the MaxSuggestSize completions of the subtree with the highest counts, ties are broken by
+// the text.
+func (n *trieNode) topCompletions() []*completion {
+	if !n.stale {
+		return n.top
+	}
+
+	var candidates []*completion
+	if n.completion != nil {
+		candidates = append(candidates, n.completion)
+	}
+	for _, child := range n.children {
+		candidates = append(candidates, child.topCompletions()...)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return rankedBefore(candidates[i], candidates[j])
+	})
+	if len(candidates) > MaxSuggestSize {
+		candidates = candidates[:MaxSuggestSize]
+	}
+
+	n.top, n.stale = candidates, false
+	return n.top
+}
+
+// suggester maintains a trie per suggest field over the values of the indexed metadata, the tries are updated as the
+// metadata is indexed and deleted so that the completions never scan the metadata. The tries of the custom fields are
+// added as their values are first indexed.
+type suggester struct {
+	mutex *sync.Mutex
+	tries map[SearchField]*trieNode
+}
+
+func newSuggester() *suggester {
+	return &suggester{
+		mutex: &sync.Mutex{},
+		tries: map[SearchField]*trieNode{},
+	}
+}
+
+// normalizeSuggestKey normalizes (NFKC), lowercases and folds (e.g. josé to jose) the value and collapses the
+// whitespace so that the completions are width, case, diacritic and space insensitive.
+func normalizeSuggestKey(value string) string {
+	return strings.Join(strings.Fields(foldASCII(strings.ToLower(norm.NFKC.String(value)))), " ")
+}
+
+// suggestKeys returns the distinct keys of the field in the metadata along with the value of each key, no keys for a
+// field that can not be completed e.g. a custom field that is no longer declared.
+func suggestKeys(field SearchField, m *Metadata) map[string]string {
+	keys := map[string]string{}
+	values, ok := suggestValuesOf(field)
+	if !ok {
+		return keys
+	}
+	for _, value := range values(m) {
+		if key := normalizeSuggestKey(value); key != "" {
+			if _, ok := keys[key]; !ok {
+				keys[key] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return keys
+}
+
+// add counts the values of the metadata, the text of a completion is the value it was first added with.
+func (s *suggester) add(m *Metadata) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, field := range suggestableFields() {
+		root, ok := s.tries[field]
+		if !ok {
+			root = newTrieNode()
+			s.tries[field] = root
+		}
+		for key, text := range suggestKeys(field, m) {
+			path := []*trieNode{root}
+			for _, r := range key {
+				node := path[len(path)-1]
+				child, ok := node.children[r]
+				if !ok {
+					child = newTrieNode()
+					node.children[r] = child
+				}
+				path = append(path, child)
+			}
+
+			node := path[len(path)-1]
+			if node.completion == nil {
+				node.completion = &completion{text: text}
+			}
+			node.completion.count++
+			for _, n := range path {
+				n.offer(node.completion)
+			}
+		}
+	}
+}
+
+// remove discounts the values of the metadata, the nodes that are left without a completion or children are pruned.
+func (s *suggester) remove(m *Metadata) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for field, root := range s.tries {
+		for key := range suggestKeys(field, m) {
+			runes := []rune(key)
+			path := []*trieNode{root}
+			for _, r := range runes {
+				child, ok := path[len(path)-1].children[r]
+				if !ok {
+					break
+				}
+				path = append(path, child)
+			}
+			node := path[len(path)-1]
+			if len(path) != len(runes)+1 || node.completion == nil {
+				continue
+			}
+
+			if node.completion.count--; node.completion.count == 0 {
+				node.completion = nil
+			}
+			for i := len(path) - 1; i >= 0; i-- {
+				path[i].stale = true
+				if i > 0 && path[i].completion == nil && len(path[i].children) == 0 {
+					delete(path[i-1].children, runes[i-1])
+				}
+			}
+		}
+	}
+}
+
+// suggest returns the top completions of the prefix in the field.
+func (s *suggester) suggest(field SearchField, prefix string, size int) []Suggestion {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	node, ok := s.tries[field]
+	if !ok {
+		return []Suggestion{}
+	}
+
+	// keep a trailing space so that "valid " completes "valid app" but not "validator"
+	key := normalizeSuggestKey(prefix)
+	if key != "" && strings.TrimRight(prefix, " \t") != prefix {
+		key += " "
+	}
+	for _, r := range key {
+		if node, ok = node.children[r]; !ok {
+			return []Suggestion{}
+		}
+	}
+
+	top := node.topCompletions()
+	if len(top) > size {
+		top = top[:size]
+	}
+	suggestions := make([]Suggestion, 0, len(top))
+	for _, c := range top {
+		suggestions = append(suggestions, Suggestion{Text: c.text, Count: c.count})
+	}
+	return suggestions
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// TokenTypeSynonym is the type of the tokens added by the synonym token filter
+	TokenTypeSynonym = "synonym"
+
+	synonymSeparator = ","
+	synonymMapping   = "=>"
+	synonymComment   = "#"
+)
+
+// Synonyms maps a term to the terms it is replaced with, a term that is kept along with its synonyms maps to itself
+// as well.
+type Synonyms map[string][]string
+
+func (s Synonyms) add(term string, synonyms ...string) {
+	for _, synonym := range synonyms {
+		found := false
+		for _, existing := range s[term] {
+			if existing == synonym {
+				found = true
+				break
+			}
+		}
+		if !found {
+			s[term] = append(s[term], synonym)
+		}
+	}
+}
+
+// Merge adds the synonyms of the other terms, the rules of a term add up.
+func (s Synonyms) Merge(other Synonyms) {
+	for term, synonyms := range other {
+		s.add(term, synonyms...)
+	}
+}
+
+// ParseSynonyms parses the synonym rules in the Solr format, one rule per line:
+//    1. k8s, kubernetes are equivalent terms, each of the terms is expanded to all of them. The terms are replaced with
+//       the first one (kubernetes => k8s) instead when expand is false.
+//    2. pg, postgresql => postgres is a one way mapping, pg and postgresql are replaced with postgres only.
+// The terms are lowercased, the blank lines and the lines starting with # are skipped and the rules of a term add up.
+// A term has to be a single word.
+func ParseSynonyms(r io.Reader, expand bool) (Synonyms, error) {
+	synonyms := Synonyms{}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		rule := strings.TrimSpace(scanner.Text())
+		if rule == "" || strings.HasPrefix(rule, synonymComment) {
+			continue
+		}
+
+		sides := strings.Split(rule, synonymMapping)
+		if len(sides) > 2 {
+			return nil, fmt.Errorf("line %d: more than one %s in %q", line, synonymMapping, rule)
+		}
+
+		var lists [][]string
+		for _, side := range sides {
+			terms, err := parseSynonymTerms(side)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s in %q", line, err, rule)
+			}
+			lists = append(lists, terms)
+		}
+
+		switch {
+		case len(lists) == 2:
+			for _, term := range lists[0] {
+				synonyms.add(term, lists[1]...)
+			}
+		case expand:
+			for _, term := range lists[0] {
+				synonyms.add(term, lists[0]...)
+			}
+		default:
+			for _, term := range lists[0] {
+				synonyms.add(term, lists[0][0])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return synonyms, nil
+}
+
+func parseSynonymTerms(list string) ([]string, error) {
+	var terms []string
+	for _, term := range strings.Split(list, synonymSeparator) {
+		term = strings.ToLower(strings.TrimSpace(term))
+		switch {
+		case term == "":
+			return nil, fmt.Errorf("empty term")
+		case len(strings.Fields(term)) > 1:
+			return nil, fmt.Errorf("%q is not a single word", term)
+		}
+		terms = append(terms, term)
+	}
+	return terms, nil
+}
+
+// NewSynonymTokenFilter replaces the tokens whose term has synonyms with the tokens of the synonyms. The first token of
+// the replacement takes the place of the token, the rest are stacked on the same position with the synonym type i.e.
+// they are alternatives of the first one. The original token is kept first when it is one of its own synonyms. All the
+// replacement tokens map to the offsets of the original token.
+func NewSynonymTokenFilter(synonyms Synonyms) TokenFilter {
+	return TokenFilterFunc(func(tokens TokenStream) TokenStream {
+		result := make(TokenStream, 0, len(tokens))
+		for _, token := range tokens {
+			replacements, ok := synonyms[token.Term]
+			if !ok {
+				result = append(result, token)
+				continue
+			}
+
+			original := token
+			for _, replacement := range replacements {
+				if replacement == original.Term {
+					result = append(result, original)
+					break
+				}
+			}
+			for _, replacement := range replacements {
+				if replacement == original.Term {
+					continue
+				}
+				synonym := original
+				synonym.Term = replacement
+				synonym.Type = TokenTypeSynonym
+				result = append(result, synonym)
+			}
+		}
+		return result
+	})
+}
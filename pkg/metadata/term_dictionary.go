@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// maxTermExpansions caps the number of the terms a wildcard expands to, so that a single query (e.g. *) can not
+	// blow up the memory. The first terms in the sorted order are kept.
+	maxTermExpansions = 1024
+
+	// maxFuzzyExpansions caps the number of the terms a fuzzy term expands to, the closest terms are kept.
+	maxFuzzyExpansions = 64
+
+	// maxFuzziness is the maximum edit distance of a fuzzy term, also the default of a fuzzy term without a distance.
+	maxFuzziness = 2
+
+	wildcardAny   = '*'
+	wildcardOne   = '?'
+	wildcardRunes = "*?"
+)
+
+// expandedTerm is a term of the dictionary that matched a wildcard or a fuzzy term, weight scales the score of the
+// term e.g. a fuzzy match with more edits scores lower.
+type expandedTerm struct {
+	term   string
+	weight float64
+}
+
+// termDictionary keeps the terms of each field sorted for the prefix, wildcard and fuzzy expansions. The sorted
+// terms of a field are dropped when the terms of the field change and are rebuilt lazily on the next expansion, so
+// that the indexing does not pay for keeping the terms sorted.
+type termDictionary struct {
+	mutex  *sync.Mutex
+	sorted map[SearchField][]string
+}
+
+func newTermDictionary() *termDictionary {
+	return &termDictionary{
+		mutex:  &sync.Mutex{},
+		sorted: map[SearchField][]string{},
+	}
+}
+
+// invalidate drops the sorted terms of the field, has to be called whenever a term is added to or removed from the
+// field.
+func (d *termDictionary) invalidate(fieldName SearchField) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.sorted, fieldName)
+}
+
+// terms returns the sorted terms of the field, the returned slice is never modified. Has to be called with the
+// searchMutex held so that the term index does not change while the terms are collected.
+func (d *termDictionary) terms(fieldName SearchField, termIndex TermIndex) []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if terms, ok := d.sorted[fieldName]; ok {
+		return terms
+	}
+	terms := make([]string, 0, len(termIndex))
+	for term := range termIndex {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	d.sorted[fieldName] = terms
+	return terms
+}
+
+// expandWildcard returns the terms of the field that match the pattern, * matches any number of characters and ?
+// matches a single character. Only the terms that start with the literal prefix of the pattern are scanned, so a
+// prefix query (e.g. vij*) is a range scan of the sorted terms.
+func (repo *inMemoryIndexer) expandWildcard(fieldName SearchField, pattern string) []expandedTerm {
+	terms := repo.termDictionary.terms(fieldName, repo.searchIndex[fieldName])
+
+	prefix := pattern
+	if i := strings.IndexAny(pattern, wildcardRunes); i >= 0 {
+		prefix = pattern[:i]
+	}
+
+	var expanded []expandedTerm
+	for i := sort.SearchStrings(terms, prefix); i < len(terms) && strings.HasPrefix(terms[i], prefix); i++ {
+		if !wildcardMatch([]rune(pattern), []rune(terms[i])) {
+			continue
+		}
+		if len(expanded) == maxTermExpansions {
+			break
+		}
+		expanded = append(expanded, expandedTerm{term: terms[i], weight: 1})
+	}
+	return expanded
+}
+
+// expandFuzzy returns the terms of the field that are within the given Levenshtein distance of the term. The weight
+// of an expanded term is 1/(1+distance) so that the exact matches score the highest.
+func (repo *inMemoryIndexer) expandFuzzy(fieldName SearchField, term string, fuzziness int) []expandedTerm {
+	terms := repo.termDictionary.terms(fieldName, repo.searchIndex[fieldName])
+
+	type candidate struct {
+		term     string
+		distance int
+	}
+
+	var (
+		source     = []rune(term)
+		candidates []candidate
+	)
+	for _, t := range terms {
+		length := utf8.RuneCountInString(t)
+		if length < len(source)-fuzziness || length > len(source)+fuzziness {
+			continue
+		}
+		if distance, ok := levenshtein(source, []rune(t), fuzziness); ok {
+			candidates = append(candidates, candidate{term: t, distance: distance})
+		}
+	}
+
+	if len(candidates) > maxFuzzyExpansions {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].distance < candidates[j].distance
+		})
+		candidates = candidates[:maxFuzzyExpansions]
+	}
+
+	expanded := make([]expandedTerm, 0, len(candidates))
+	for _, c := range candidates {
+		expanded = append(expanded, expandedTerm{term: c.term, weight: 1 / float64(1+c.distance)})
+	}
+	return expanded
+}
+
+// wildcardMatch matches the text against the pattern, on a mismatch it backtracks to the last * and lets it consume
+// one more character.
+func wildcardMatch(pattern, text []rune) bool {
+	p, t := 0, 0
+	star, starText := -1, 0
+	for t < len(text) {
+		switch {
+		case p < len(pattern) && (pattern[p] == wildcardOne || pattern[p] == text[t]):
+			p++
+			t++
+		case p < len(pattern) && pattern[p] == wildcardAny:
+			star, starText = p, t
+			p++
+		case star >= 0:
+			starText++
+			p, t = star+1, starText
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == wildcardAny {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// levenshtein computes the edit distance between the two strings, returns false as soon as the distance is known to
+// be more than the max distance.
+func levenshtein(source, target []rune, maxDistance int) (int, bool) {
+	previous := make([]int, len(target)+1)
+	current := make([]int, len(target)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(source); i++ {
+		current[0] = i
+		rowMin := current[0]
+		for j := 1; j <= len(target); j++ {
+			cost := 1
+			if source[i-1] == target[j-1] {
+				cost = 0
+			}
+			current[j] = minOf(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if current[j] < rowMin {
+				rowMin = current[j]
+			}
+		}
+		if rowMin > maxDistance {
+			return 0, false
+		}
+		previous, current = current, previous
+	}
+
+	distance := previous[len(target)]
+	return distance, distance <= maxDistance
+}
+
+func minOf(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
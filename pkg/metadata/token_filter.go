@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MinimalEnglishStemmer only reduces the plurals to the singular e.g. libraries to library and apps to app
+	MinimalEnglishStemmer = "minimal_english"
+)
+
+var (
+	// LowercaseTokenFilter lowercases the terms
+	LowercaseTokenFilter TokenFilter = TokenFilterFunc(func(tokens TokenStream) TokenStream {
+		return mapTerms(tokens, strings.ToLower)
+	})
+
+	// UniqueTokenFilter drops the tokens whose term was already seen in the stream, the first token of a term is kept
+	UniqueTokenFilter TokenFilter = TokenFilterFunc(func(tokens TokenStream) TokenStream {
+		seen := map[string]bool{}
+		return filterTokens(tokens, func(token Token) bool {
+			if seen[token.Term] {
+				return false
+			}
+			seen[token.Term] = true
+			return true
+		})
+	})
+
+	// ASCIIFoldingTokenFilter replaces the latin letters with the diacritics with their ASCII equivalents e.g. josé to
+	// jose, the other runes are kept as is.
+	ASCIIFoldingTokenFilter TokenFilter = TokenFilterFunc(func(tokens TokenStream) TokenStream {
+		return mapTerms(tokens, foldASCII)
+	})
+
+	// Stemmers are the stemmers of the stemmer token filter by the language
+	Stemmers = map[string]Stemmer{
+		MinimalEnglishStemmer: minimalEnglishStem,
+		EnglishStemmer:        englishStem,
+	}
+
+	asciiFolding = map[rune]string{
+		'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Ä': "A", 'Å': "A", 'Ā': "A", 'Ă': "A", 'Ą': "A",
+		'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+		'Æ': "AE", 'æ': "ae",
+		'Ç': "C", 'Ć': "C", 'Ĉ': "C", 'Ċ': "C", 'Č': "C",
+		'ç': "c", 'ć': "c", 'ĉ': "c", 'ċ': "c", 'č': "c",
+		'Ð': "D", 'Ď': "D", 'Đ': "D", 'ð': "d", 'ď': "d", 'đ': "d",
+		'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E", 'Ē': "E", 'Ĕ': "E", 'Ė': "E", 'Ę': "E", 'Ě': "E",
+		'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ĕ': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+		'Ĝ': "G", 'Ğ': "G", 'Ġ': "G", 'Ģ': "G", 'ĝ': "g", 'ğ': "g", 'ġ': "g", 'ģ': "g",
+		'Ĥ': "H", 'Ħ': "H", 'ĥ': "h", 'ħ': "h",
+		'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I", 'Ĩ': "I", 'Ī': "I", 'Ĭ': "I", 'Į': "I", 'İ': "I",
+		'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ĩ': "i", 'ī': "i", 'ĭ': "i", 'į': "i", 'ı': "i",
+		'Ĵ': "J", 'ĵ': "j", 'Ķ': "K", 'ķ': "k",
+		'Ĺ': "L", 'Ļ': "L", 'Ľ': "L", 'Ŀ': "L", 'Ł': "L", 'ĺ': "l", 'ļ': "l", 'ľ': "l", 'ŀ': "l", 'ł': "l",
+		'Ñ': "N", 'Ń': "N", 'Ņ': "N", 'Ň': "N", 'ñ': "n", 'ń': "n", 'ņ': "n", 'ň': "n",
+		'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ö': "O", 'Ø': "O", 'Ō': "O", 'Ŏ': "O", 'Ő': "O",
+		'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ŏ': "o", 'ő': "o",
+		'Œ': "OE", 'œ': "oe",
+		'Ŕ': "R", 'Ŗ': "R", 'Ř': "R", 'ŕ': "r", 'ŗ': "r", 'ř': "r",
+		'Ś': "S", 'Ŝ': "S", 'Ş': "S", 'Š': "S", 'ś': "s", 'ŝ': "s", 'ş': "s", 'š': "s", 'ß': "ss",
+		'Ţ': "T", 'Ť': "T", 'Ŧ': "T", 'ţ': "t", 'ť': "t", 'ŧ': "t", 'Þ': "TH", 'þ': "th",
+		'Ù': "U", 'Ú': "U", 'Û': "U", 'Ü': "U", 'Ũ': "U", 'Ū': "U", 'Ŭ': "U", 'Ů': "U", 'Ű': "U", 'Ų': "U",
+		'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ũ': "u", 'ū': "u", 'ŭ': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+		'Ŵ': "W", 'ŵ': "w",
+		'Ý': "Y", 'Ÿ': "Y", 'Ŷ': "Y", 'ý': "y", 'ÿ': "y", 'ŷ': "y",
+		'Ź': "Z", 'Ż': "Z", 'Ž': "Z", 'ź': "z", 'ż': "z", 'ž': "z",
+	}
+)
+
+// TokenFilter transforms the token stream of a tokenizer e.g. lowercases the terms or drops the stop words. The
+// filters return a new stream and never modify the given one, the dropped tokens leave a gap in the positions.
+type TokenFilter interface {
+	Filter(tokens TokenStream) TokenStream
+}
+
+// AnalysisPhase restricts a token filter to the analysis of either the indexed values or the search values.
+type AnalysisPhase string
+
+const (
+	AnalysisPhaseAll   AnalysisPhase = ""
+	AnalysisPhaseIndex AnalysisPhase = "index"
+	AnalysisPhaseQuery AnalysisPhase = "query"
+)
+
+type phasedTokenFilter struct {
+	TokenFilter
+	phase AnalysisPhase
+}
+
+// InPhase applies the token filter only in the phase e.g. the synonyms are often expanded only at the query time so that
+// the synonyms can be changed without reindexing.
+func InPhase(filter TokenFilter, phase AnalysisPhase) TokenFilter {
+	if phase == AnalysisPhaseAll {
+		return filter
+	}
+	return &phasedTokenFilter{TokenFilter: filter, phase: phase}
+}
+
+// appliesIn checks if the token filter applies in the phase.
+func appliesIn(filter TokenFilter, phase AnalysisPhase) bool {
+	phased, ok := filter.(*phasedTokenFilter)
+	return !ok || phased.phase == phase
+}
+
+// TokenFilterFunc adapts a function to a TokenFilter.
+type TokenFilterFunc func(TokenStream) TokenStream
+
+func (f TokenFilterFunc) Filter(tokens TokenStream) TokenStream {
+	return f(tokens)
+}
+
+// Stemmer reduces a lowercased word to its root.
+type Stemmer func(string) string
+
+func mapTerms(tokens TokenStream, fn func(string) string) TokenStream {
+	result := make(TokenStream, 0, len(tokens))
+	for _, token := range tokens {
+		token.Term = fn(token.Term)
+		result = append(result, token)
+	}
+	return result
+}
+
+func filterTokens(tokens TokenStream, keep func(Token) bool) TokenStream {
+	result := make(TokenStream, 0, len(tokens))
+	for _, token := range tokens {
+		if keep(token) {
+			result = append(result, token)
+		}
+	}
+	return result
+}
+
+// NewStopTokenFilter drops the tokens whose term is one of the stop words.
+func NewStopTokenFilter(stopWords []string) TokenFilter {
+	set := toSet(stopWords)
+	return TokenFilterFunc(func(tokens TokenStream) TokenStream {
+		return filterTokens(tokens, func(token Token) bool { return !set[token.Term] })
+	})
+}
+
+// NewLengthTokenFilter keeps the tokens whose term has at least min and at most max runes, a max of 0 does not limit the
+// length.
+func NewLengthTokenFilter(min, max int) TokenFilter {
+	return TokenFilterFunc(func(tokens TokenStream) TokenStream {
+		return filterTokens(tokens, func(token Token) bool {
+			length := utf8.RuneCountInString(token.Term)
+			return length >= min && (max == 0 || length <= max)
+		})
+	})
+}
+
+// NewTrimTokenFilter trims the characters of the cutset off the terms and drops the tokens that are left empty. The
+// offsets of a token are narrowed to the trimmed term when the term still spans its offsets byte for byte.
+func NewTrimTokenFilter(cutset string) TokenFilter {
+	return TokenFilterFunc(func(tokens TokenStream) TokenStream {
+		result := make(TokenStream, 0, len(tokens))
+		for _, token := range tokens {
+			left := strings.TrimLeft(token.Term, cutset)
+			term := strings.TrimRight(left, cutset)
+			if term == "" {
+				continue
+			}
+			if token.hasOffsets() && token.EndOffset-token.StartOffset == len(token.Term) {
+				token.StartOffset += len(token.Term) - len(left)
+				token.EndOffset -= len(left) - len(term)
+			}
+			token.Term = term
+			result = append(result, token)
+		}
+		return result
+	})
+}
+
+// NewStemmerTokenFilter replaces the terms with their stems.
+func NewStemmerTokenFilter(stemmer Stemmer) TokenFilter {
+	return TokenFilterFunc(func(tokens TokenStream) TokenStream {
+		return mapTerms(tokens, stemmer)
+	})
+}
+
+// foldASCII folds the runes of the table and the ones that decompose into an ASCII letter and the combining marks
+// e.g. ệ, the combining marks of the decomposed letters are dropped.
+func foldASCII(term string) string {
+	var (
+		sb      strings.Builder
+		folding bool
+	)
+	for i, r := range term {
+		folded, ok := foldRune(r)
+		switch {
+		case ok && !folding:
+			// the first rune that folds, the runes before it are kept as is
+			sb.WriteString(term[:i])
+			sb.WriteString(folded)
+			folding = true
+		case ok:
+			sb.WriteString(folded)
+		case folding:
+			sb.WriteRune(r)
+		}
+	}
+	if !folding {
+		return term
+	}
+	return sb.String()
+}
+
+func foldRune(r rune) (string, bool) {
+	if folded, ok := asciiFolding[r]; ok {
+		return folded, true
+	}
+	if r < utf8.RuneSelf {
+		return "", false
+	}
+	if unicode.Is(unicode.Mn, r) {
+		return "", true
+	}
+	decomposed := norm.NFD.String(string(r))
+	if base, size := utf8.DecodeRuneInString(decomposed); size < len(decomposed) && base < utf8.RuneSelf {
+		return string(base), true
+	}
+	return "", false
+}
+
+// minimalEnglishStem is the S-stemmer (Harman 1991) i.e. it only removes the plural endings:
+//    1. ies becomes y unless preceded by an e or an a (e.g. libraries to library)
+//    2. es becomes e unless preceded by an a, an e or an o (e.g. caches to cache)
+//    3. s is removed unless preceded by a u or an s (e.g. apps to app, but not status or class)
+func minimalEnglishStem(term string) string {
+	n := len(term)
+	if n < 3 || term[n-1] != 's' {
+		return term
+	}
+	switch {
+	case strings.HasSuffix(term, "ies") && n > 4 && term[n-4] != 'e' && term[n-4] != 'a':
+		return term[:n-3] + "y"
+	case strings.HasSuffix(term, "es") && term[n-3] != 'a' && term[n-3] != 'e' && term[n-3] != 'o':
+		return term[:n-1]
+	case term[n-2] != 'u' && term[n-2] != 's':
+		return term[:n-1]
+	}
+	return term
+}
@@ -4,29 +4,153 @@
 
 package metadata
 
-import "strings"
+import (
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 var (
-	// DefaultPerWordTokenizer splits the input on whitespace and filters out any 0 or 1 length words along with the common words.
+	// DefaultPerWordTokenizer splits the input on whitespace and filters out any 0 or 1 letter words along with the common words.
 	DefaultPerWordTokenizer = NewStandardTokenizer()
 
-	// DefaultExactMatchTokenizer converts the given input to lowercase but does not do any breaks.
+	// DefaultExactMatchTokenizer normalizes (NFKC) and converts the given input to lowercase but does not do any breaks.
 	DefaultExactMatchTokenizer = &exactMatchTokenizer{}
 
 	// DefaultNopTokenizer does not tokenize making the field unsearchable, useful when not indexing for the field is required
 	DefaultNopTokenizer = &nopTokenizer{}
+
+	// DefaultWhitespaceTokenizer splits the input on whitespace as is, meant to be the tokenizer of an analysis pipeline
+	// whose token filters do the rest.
+	DefaultWhitespaceTokenizer = &whitespaceTokenizer{}
 )
 
-// Tokenizer converts the given input into searchable tokens
+// Tokenizer converts the given input into searchable tokens. This is the plain string API, tokenizers that also
+// implement TokenStreamer produce the rich tokens and the rest are adapted by Tokens.
 type Tokenizer interface {
 	Tokenize(input string) []string
 }
 
+const (
+	// TokenTypeWord is the type of the tokens produced by splitting a text into words
+	TokenTypeWord = "word"
+
+	// TokenTypeKeyword is the type of the tokens that hold the whole input e.g. the exact match tokens
+	TokenTypeKeyword = "keyword"
+)
+
+// Token is a term along with its Position in the token stream, the byte offsets [StartOffset, EndOffset) of the input
+// text it was produced from and its Type. The offsets are -1 when the tokenizer can not map the term back to the input.
+type Token struct {
+	Term        string `json:"term" yaml:"term"`
+	Position    int    `json:"position" yaml:"position"`
+	StartOffset int    `json:"start_offset" yaml:"start_offset"`
+	EndOffset   int    `json:"end_offset" yaml:"end_offset"`
+	Type        string `json:"type" yaml:"type"`
+}
+
+// hasOffsets checks if the token can be mapped back to the input text
+func (t Token) hasOffsets() bool {
+	return t.StartOffset >= 0 && t.EndOffset >= t.StartOffset
+}
+
+// TokenStream is the sequence of the tokens produced from an input, ordered by the position.
+type TokenStream []Token
+
+// Terms returns the terms of the tokens in the order of the stream, the string API equivalent of the stream. The
+// positions are not part of the terms, the index is built from the token stream.
+func (ts TokenStream) Terms() []string {
+	var terms []string
+	for _, token := range ts {
+		terms = append(terms, token.Term)
+	}
+	return terms
+}
+
+// nextPosition returns the position that follows the positions of the stream.
+func (ts TokenStream) nextPosition() int {
+	if len(ts) == 0 {
+		return 0
+	}
+	return ts[len(ts)-1].Position + 1
+}
+
+// TokenStreamer is the rich tokenizer API, implemented by all the tokenizers of this package.
+type TokenStreamer interface {
+	Tokenizer
+	TokenStream(input string) TokenStream
+}
+
+// QueryTokenStreamer is implemented by the tokenizers that analyze the search values differently than the indexed
+// values, e.g. with the token filters that only apply at the query time.
+type QueryTokenStreamer interface {
+	QueryTokenStream(input string) TokenStream
+}
+
+// Tokens returns the token stream of the input, the tokenizers that only implement the string API are adapted by
+// numbering their terms without the offsets.
+func Tokens(tokenizer Tokenizer, input string) TokenStream {
+	if streamer, ok := tokenizer.(TokenStreamer); ok {
+		return streamer.TokenStream(input)
+	}
+	return termStream(tokenizer.Tokenize(input))
+}
+
+// QueryTokens returns the token stream of a search value, the same as Tokens for the tokenizers that do not analyze the
+// search values differently.
+func QueryTokens(tokenizer Tokenizer, input string) TokenStream {
+	if streamer, ok := tokenizer.(QueryTokenStreamer); ok {
+		return streamer.QueryTokenStream(input)
+	}
+	return Tokens(tokenizer, input)
+}
+
+func termStream(terms []string) TokenStream {
+	var stream TokenStream
+	for i, term := range terms {
+		stream = append(stream, Token{Term: term, Position: i, StartOffset: -1, EndOffset: -1, Type: TokenTypeWord})
+	}
+	return stream
+}
+
+// normalizeWithOffsets normalizes (NFKC) and lowercases the input, toInput maps the [start, end) bytes of the result
+// back to the bytes of the input.
+func normalizeWithOffsets(input string) (result string, toInput func(start, end int) (int, int)) {
+	normalized, spans := NFKCCharFilter.Filter(input)
+	lower, offsets := lowerWithOffsets(normalized)
+	return lower, func(start, end int) (int, int) {
+		return mapSpan(spans, len(input), offsets[start], offsets[end])
+	}
+}
+
+// lowerWithOffsets lowercases the input and maps each byte offset of the lowercased text (and its length) to the byte
+// offset of the input, lowercasing can change the encoded length of a rune.
+func lowerWithOffsets(input string) (string, []int) {
+	var (
+		sb      strings.Builder
+		offsets = make([]int, 0, len(input)+1)
+	)
+	for i, r := range input {
+		lower := unicode.ToLower(r)
+		sb.WriteRune(lower)
+		for n := utf8.RuneLen(lower); n > 0; n-- {
+			offsets = append(offsets, i)
+		}
+	}
+	return sb.String(), append(offsets, len(input))
+}
+
 type exactMatchTokenizer struct {
 }
 
 func (e exactMatchTokenizer) Tokenize(input string) []string {
-	return []string{strings.ToLower(input)}
+	return e.TokenStream(input).Terms()
+}
+
+func (e exactMatchTokenizer) TokenStream(input string) TokenStream {
+	term := strings.ToLower(norm.NFKC.String(input))
+	return TokenStream{{Term: term, Position: 0, StartOffset: 0, EndOffset: len(input), Type: TokenTypeKeyword}}
 }
 
 type nopTokenizer struct {
@@ -36,19 +160,91 @@ func (nopTokenizer) Tokenize(input string) []string {
 	return nil
 }
 
+func (nopTokenizer) TokenStream(input string) TokenStream {
+	return nil
+}
+
+type whitespaceTokenizer struct {
+}
+
+func (w whitespaceTokenizer) Tokenize(input string) []string {
+	return w.TokenStream(input).Terms()
+}
+
+func (whitespaceTokenizer) TokenStream(input string) TokenStream {
+	var (
+		tokens TokenStream
+		start  = -1
+	)
+	emit := func(end int) {
+		if start >= 0 {
+			tokens = append(tokens, Token{Term: input[start:end], Position: len(tokens), StartOffset: start, EndOffset: end, Type: TokenTypeWord})
+			start = -1
+		}
+	}
+	for i, r := range input {
+		switch {
+		case unicode.IsSpace(r):
+			emit(i)
+		case start < 0:
+			start = i
+		}
+	}
+	emit(len(input))
+	return tokens
+}
+
+// TokenizerFunc adapts a function of the string API to a TokenStreamer, the terms are returned without the offsets.
 type TokenizerFunc func(string) []string
 
 func (f TokenizerFunc) Tokenize(input string) []string {
 	return f(input)
 }
 
+func (f TokenizerFunc) TokenStream(input string) TokenStream {
+	return termStream(f(input))
+}
+
+// TokenStreamFunc adapts a function of the rich API to a TokenStreamer.
+type TokenStreamFunc func(string) TokenStream
+
+func (f TokenStreamFunc) Tokenize(input string) []string {
+	return f(input).Terms()
+}
+
+func (f TokenStreamFunc) TokenStream(input string) TokenStream {
+	return f(input)
+}
+
+type tokenizerChain []Tokenizer
+
 // TokenizerChain stitches together multitple tokenizers together.
 func TokenizerChain(tokenizers ...Tokenizer) Tokenizer {
-	return TokenizerFunc(func(input string) []string {
-		var result []string
-		for _, tokenizer := range tokenizers {
-			result = append(result, tokenizer.Tokenize(input)...)
+	return tokenizerChain(tokenizers)
+}
+
+func (c tokenizerChain) Tokenize(input string) []string {
+	return c.TokenStream(input).Terms()
+}
+
+// TokenStream concatenates the token streams of the chained tokenizers, the positions of each stream follow the
+// positions of the previous one.
+func (c tokenizerChain) TokenStream(input string) TokenStream {
+	return c.concat(input, Tokens)
+}
+
+func (c tokenizerChain) QueryTokenStream(input string) TokenStream {
+	return c.concat(input, QueryTokens)
+}
+
+func (c tokenizerChain) concat(input string, tokens func(Tokenizer, string) TokenStream) TokenStream {
+	var result TokenStream
+	for _, tokenizer := range c {
+		base := result.nextPosition()
+		for _, token := range tokens(tokenizer, input) {
+			token.Position += base
+			result = append(result, token)
 		}
-		return result
-	})
+	}
+	return result
 }
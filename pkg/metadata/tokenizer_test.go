@@ -46,3 +46,184 @@ func TestStandardTokenizer_TokenizeMultiline(t *testing.T) {
 	assert.NotContains(t, terms, "and", "not expecting and in term list")
 	assert.Contains(t, terms, "multiline", "expecting multiline in term list")
 }
+
+func TestStandardTokenizer_TokenStream(t *testing.T) {
+	description := "Some (İstanbul) content, and   DESCRIPTION"
+
+	tokens := Tokens(DefaultPerWordTokenizer, description)
+
+	assert.Equal(t, DefaultPerWordTokenizer.Tokenize(description), []string{"some", "istanbul", "content", "description"})
+	if assert.Len(t, tokens, 4) {
+		for _, token := range tokens {
+			assert.Equal(t, token.Term, strings.ToLower(description[token.StartOffset:token.EndOffset]))
+		}
+		assert.Equal(t, "İstanbul", description[tokens[1].StartOffset:tokens[1].EndOffset])
+		assert.Equal(t, "DESCRIPTION", description[tokens[3].StartOffset:tokens[3].EndOffset])
+	}
+}
+
+func TestTokens(t *testing.T) {
+	name := "Vijay Poliboyina"
+
+	// chained streams keep numbering the positions
+	tokens := Tokens(TokenizerChain(DefaultPerWordTokenizer, DefaultExactMatchTokenizer), name)
+	assert.Equal(t, TokenStream{
+		{Term: "vijay", Position: 0, StartOffset: 0, EndOffset: 5, Type: TokenTypeWord},
+		{Term: "poliboyina", Position: 1, StartOffset: 6, EndOffset: 16, Type: TokenTypeWord},
+		{Term: "vijay poliboyina", Position: 2, StartOffset: 0, EndOffset: 16, Type: TokenTypeKeyword},
+	}, tokens)
+
+	// tokenizers of the string API are adapted without the offsets
+	type stringTokenizer struct{ Tokenizer }
+	tokens = Tokens(stringTokenizer{TokenizerFunc(strings.Fields)}, name)
+	assert.Equal(t, TokenStream{
+		{Term: "Vijay", Position: 0, StartOffset: -1, EndOffset: -1, Type: TokenTypeWord},
+		{Term: "Poliboyina", Position: 1, StartOffset: -1, EndOffset: -1, Type: TokenTypeWord},
+	}, tokens)
+	assert.Equal(t, []string{"Vijay", "Poliboyina"}, tokens.Terms())
+
+	// and the rich tokenizers keep working with the string API
+	upper := TokenStreamFunc(func(input string) TokenStream {
+		return TokenStream{{Term: strings.ToUpper(input), StartOffset: 0, EndOffset: len(input), Type: TokenTypeKeyword}}
+	})
+	assert.Equal(t, []string{"VIJAY POLIBOYINA"}, TokenizerChain(upper, DefaultNopTokenizer).Tokenize(name))
+}
+
+func TestStandardTokenizer_WithStemmer(t *testing.T) {
+	tokenizer := NewStandardTokenizer(WithStemmer(Stemmers[EnglishStemmer]))
+
+	input := "Caching proxy, cached Libraries"
+	tokens := Tokens(tokenizer, input)
+	assert.Equal(t, []string{"cach", "proxi", "cach", "librari"}, tokens.Terms())
+
+	// the offsets span the whole words that were stemmed
+	assert.Equal(t, "Caching", input[tokens[0].StartOffset:tokens[0].EndOffset])
+	assert.Equal(t, "Libraries", input[tokens[3].StartOffset:tokens[3].EndOffset])
+
+	// cache, cached and caching all match
+	assert.Equal(t, tokenizer.Tokenize("cache"), tokenizer.Tokenize("caching"))
+}
+
+func TestStandardTokenizer_Normalization(t *testing.T) {
+	// the composed and the decomposed é, the ligature and the full width letters normalize the same
+	input := "José Jose\u0301 ﬁle ＡＰＰ é x 日本"
+	tokens := Tokens(DefaultPerWordTokenizer, input)
+	assert.Equal(t, []string{"josé", "josé", "file", "app", "日本"}, tokens.Terms())
+
+	// the offsets point into the input before the normalization
+	expected := []string{"José", "Jose\u0301", "ﬁle", "ＡＰＰ", "日本"}
+	for i, token := range tokens {
+		assert.Equal(t, expected[i], input[token.StartOffset:token.EndOffset])
+	}
+
+	folding := NewStandardTokenizer(WithASCIIFolding())
+	assert.Equal(t, []string{"jose", "muller", "nguyen", "tieng"}, folding.Tokenize("José Müller, Nguyễn Tiếng"))
+
+	assert.Equal(t, []string{"app"}, DefaultExactMatchTokenizer.Tokenize("ＡＰＰ"))
+}
+
+func TestSegmentWords(t *testing.T) {
+	testCases := map[string][]string{
+		"Hello, world!":                  {"Hello", "world"},
+		"can't stop 3.14 e.g. U.S.A.":    {"can't", "stop", "3.14", "e.g", "U.S.A"},
+		"foo_bar k8s 1,000,000 v1.2.3":   {"foo_bar", "k8s", "1,000,000", "v1.2.3"},
+		"José's café\r\nnaïve":           {"José's", "café", "naïve"},
+		"日本語のカタカナ":                       {"日", "本", "語", "の", "カタカナ"},
+		"  ... --- ":                     nil,
+		"":                               nil,
+		"appmeta-server/api:v1 (α-beta)": {"appmeta", "server", "api:v1", "α", "beta"},
+		"José tab\tseparated x":         {"José", "tab", "separated", "x"},
+	}
+	for input, expected := range testCases {
+		assert.Equal(t, expected, SegmentWords(input), input)
+	}
+
+	tokenizer := NewStandardTokenizer(WithSplitter(WordBoundarySeparator))
+	input := "Kubernetes-operator (for) Postgres, v1.2.3"
+	tokens := Tokens(tokenizer, input)
+	assert.Equal(t, []string{"kubernetes", "operator", "postgres", "v1.2.3"}, tokens.Terms())
+	assert.Equal(t, "Postgres", input[tokens[2].StartOffset:tokens[2].EndOffset])
+}
+
+func TestNGramTokenizer(t *testing.T) {
+	tokenizer := NewNGramTokenizer(2, 3)
+	assert.Equal(t, []string{"ap", "app", "pp", "pp-", "p-", "p-s", "-s", "-se", "se", "ser", "er"}, tokenizer.Tokenize("App-Ser"))
+
+	letters := NewNGramTokenizer(2, 3, WithTokenChars(TokenCharClasses["letter"], TokenCharClasses["digit"]))
+	input := "Ünï-K8s a"
+	tokens := Tokens(letters, input)
+	assert.Equal(t, []string{"ün", "ünï", "nï", "k8", "k8s", "8s"}, tokens.Terms())
+	assert.Equal(t, "Ünï", input[tokens[1].StartOffset:tokens[1].EndOffset])
+	assert.Equal(t, "K8s", input[tokens[4].StartOffset:tokens[4].EndOffset])
+
+	// the search values are broken into the longest grams only
+	assert.Equal(t, []string{"ser", "erv", "rve", "ver", "k8"}, QueryTokens(letters, "Server k8 x").Terms())
+
+	edge := NewEdgeNGramTokenizer(1, 4, WithTokenChars(TokenCharClasses["letter"]))
+	assert.Equal(t, []string{"a", "ap", "app", "appm", "s", "se", "ser", "serv"}, edge.Tokenize("appmeta-server"))
+	assert.Equal(t, []string{"appm", "se"}, QueryTokens(edge, "APPMETA se").Terms())
+}
+
+func TestIdentifierTokenizers(t *testing.T) {
+	testCases := []struct {
+		name      string
+		tokenizer Tokenizer
+		input     string
+		expected  []string
+	}{
+		{"url", DefaultURLTokenizer, "https://GitHub.com/upbound/repo/", []string{"https://github.com/upbound/repo", "https", "github.com",
+			"github", "com", "github.com/upbound", "upbound", "github.com/upbound/repo", "repo"}},
+		{"urlWithoutScheme", DefaultURLTokenizer, "github.com/upbound", []string{"github.com/upbound", "github.com", "github", "com", "upbound"}},
+		{"urlParts", DefaultURLTokenizer, "http://ops@localhost:8080/api?v=1#top", []string{"http://ops@localhost:8080/api?v=1#top", "http",
+			"localhost", "localhost:8080/api", "api"}},
+		{"email", DefaultEmailTokenizer, " Vijay@Hotmail.com ", []string{"vijay@hotmail.com", "vijay", "hotmail.com", "hotmail", "com"}},
+		{"emailDomain", DefaultEmailTokenizer, "hotmail.com", []string{"hotmail.com", "hotmail", "com"}},
+		{"emailLocalPart", DefaultEmailTokenizer, "vijay@", []string{"vijay@", "vijay"}},
+		{"semver", DefaultSemverTokenizer, "v1.0.1-rc.1+build.5", []string{"1", "1.0", "1.0.1-rc.1", "rc.1"}},
+		{"semverMinor", DefaultSemverTokenizer, "1.0", []string{"1", "1.0"}},
+		{"notSemver", DefaultSemverTokenizer, "Latest", []string{"latest"}},
+		{"tooManyParts", DefaultSemverTokenizer, "1.2.3.4", []string{"1.2.3.4"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			tokens := Tokens(testCase.tokenizer, testCase.input)
+			assert.Equal(t, testCase.expected, tokens.Terms())
+			for i, token := range tokens {
+				assert.Equal(t, i, token.Position)
+				assert.Equal(t, token.Term, strings.ToLower(testCase.input[token.StartOffset:token.EndOffset]))
+			}
+		})
+	}
+}
+
+func TestPatternTokenizer(t *testing.T) {
+	split, err := NewPatternTokenizer(`[/|\s]+`, "", PatternSplitGroup)
+	assert.Nil(t, err)
+	input := "Foo/BAR|baz  ｑｕｘ/"
+	tokens := Tokens(split, input)
+	assert.Equal(t, []string{"foo", "bar", "baz", "qux"}, tokens.Terms())
+	assert.Equal(t, "BAR", input[tokens[1].StartOffset:tokens[1].EndOffset])
+	assert.Equal(t, "ｑｕｘ", input[tokens[3].StartOffset:tokens[3].EndOffset])
+
+	capture, err := NewPatternTokenizer(`key=(\w+)`, "i", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"one", "two"}, capture.Tokenize("key=One, KEY=two, key="))
+
+	whole, err := NewPatternTokenizer(`\d+`, "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"8", "80"}, whole.Tokenize("k8s:80"))
+
+	for _, invalid := range []struct {
+		pattern, flags string
+		group          int
+	}{
+		{`(unclosed`, "", PatternSplitGroup},
+		{`\w+`, "x", PatternSplitGroup},
+		{`(\w+)`, "", 2},
+		{`\w+`, "", -2},
+	} {
+		_, err := NewPatternTokenizer(invalid.pattern, invalid.flags, invalid.group)
+		assert.NotNil(t, err, invalid.pattern)
+	}
+}
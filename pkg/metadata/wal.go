@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+const (
+	// Each record is framed as | payload length (uint32) | crc32c of the payload (uint32) | json payload |
+	recordHeaderSize = 8
+
+	// Guards against allocating huge buffers when the length in the header itself is garbage.
+	maxRecordSize = 64 << 20
+)
+
+type logOp string
+
+var (
+	// logOpPut stores the payload under the ID replacing any existing payload with the same ID
+	logOpPut = logOp("put")
+
+	// logOpDelete removes the payload stored under the ID
+	logOpDelete = logOp("delete")
+)
+
+var (
+	errCorruptRecord = errors.New("corrupt log record")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// logRecord is the unit of change that is appended to the write-ahead log and the snapshots. Only the metadata is
+// stored, the analyzed terms depend on the analyzer config and are recomputed on the replay.
+type logRecord struct {
+	Op       logOp     `json:"op"`
+	ID       uuid.UUID `json:"id"`
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+// writeRecord frames and writes the record to the given writer.
+func writeRecord(w io.Writer, record *logRecord) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	copy(buf[recordHeaderSize:], payload)
+
+	_, err = w.Write(buf)
+	return err
+}
+
+// readRecord reads the next record from the reader and returns the record along with the number of bytes consumed.
+// io.EOF is returned when there are no more records and errCorruptRecord when a torn or a corrupted record is found.
+func readRecord(r io.Reader) (*logRecord, int64, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, errCorruptRecord
+	}
+
+	size := binary.LittleEndian.Uint32(header[0:4])
+	checksum := binary.LittleEndian.Uint32(header[4:8])
+	if size > maxRecordSize {
+		return nil, 0, errCorruptRecord
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, errCorruptRecord
+	}
+	if crc32.Checksum(payload, crcTable) != checksum {
+		return nil, 0, errCorruptRecord
+	}
+
+	record := &logRecord{}
+	if err := json.Unmarshal(payload, record); err != nil {
+		return nil, 0, errCorruptRecord
+	}
+	return record, int64(recordHeaderSize) + int64(size), nil
+}
+
+// replayLog reads all the records from the file at the given path and hands them over to the apply func in order.
+// The returned offset is the end of the last good record, errCorruptRecord is returned along with the offset if the
+// file has a torn or corrupted record. A missing file is treated as an empty log.
+func replayLog(path string, apply func(*logRecord)) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+
+	var (
+		offset int64
+		reader = bufio.NewReader(f)
+	)
+	for {
+		record, n, err := readRecord(reader)
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+		apply(record)
+		offset += n
+	}
+}
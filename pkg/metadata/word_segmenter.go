@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package metadata
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// wordBreak is the Word_Break property of a rune (https://unicode.org/reports/tr29/#Word_Boundaries)
+type wordBreak int
+
+const (
+	wbOther wordBreak = iota
+	wbCR
+	wbLF
+	wbNewline
+	wbExtend
+	wbZWJ
+	wbRegionalIndicator
+	wbFormat
+	wbKatakana
+	wbHebrewLetter
+	wbALetter
+	wbSingleQuote
+	wbDoubleQuote
+	wbMidNumLet
+	wbMidLetter
+	wbMidNum
+	wbNumeric
+	wbExtendNumLet
+	wbWSegSpace
+)
+
+var (
+	wbMidLetters = map[rune]bool{
+		':': true, '\u00B7': true, '\u0387': true, '\u055F': true, '\u05F4': true, '\u2027': true, '\uFE13': true,
+		'\uFE55': true, '\uFF1A': true,
+	}
+
+	wbMidNums = map[rune]bool{
+		',': true, ';': true, '\u037E': true, '\u0589': true, '\u060C': true, '\u060D': true, '\u066C': true,
+		'\u07F8': true, '\u2044': true, '\uFE10': true, '\uFE14': true, '\uFE50': true, '\uFE54': true, '\uFF0C': true,
+		'\uFF1B': true,
+	}
+
+	wbMidNumLets = map[rune]bool{
+		'.': true, '\u2018': true, '\u2019': true, '\u2024': true, '\uFE52': true, '\uFF07': true, '\uFF0E': true,
+	}
+
+	wbKatakanaExtras = map[rune]bool{
+		'\u3031': true, '\u3032': true, '\u3033': true, '\u3034': true, '\u3035': true, '\u309B': true, '\u309C': true,
+		'\u30A0': true, '\u30FC': true, '\uFF70': true,
+	}
+)
+
+// wordBreakOf approximates the Word_Break property of the rune with the Unicode categories and scripts of the
+// standard library. The ideographs and the hiragana are not letters in the word break sense, each of them is a word.
+func wordBreakOf(r rune) wordBreak {
+	switch {
+	case r == '\r':
+		return wbCR
+	case r == '\n':
+		return wbLF
+	case r == '\v' || r == '\f' || r == '\u0085' || r == '\u2028' || r == '\u2029':
+		return wbNewline
+	case r == '\u200D':
+		return wbZWJ
+	case r == '\u200C' || unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) || (r >= 0x1F3FB && r <= 0x1F3FF):
+		return wbExtend
+	case r >= 0x1F1E6 && r <= 0x1F1FF:
+		return wbRegionalIndicator
+	case r == '\u200B':
+		return wbOther
+	case unicode.Is(unicode.Cf, r):
+		return wbFormat
+	case r == '\'':
+		return wbSingleQuote
+	case r == '"':
+		return wbDoubleQuote
+	case wbMidNumLets[r]:
+		return wbMidNumLet
+	case wbMidLetters[r]:
+		return wbMidLetter
+	case wbMidNums[r]:
+		return wbMidNum
+	case unicode.Is(unicode.Nd, r):
+		return wbNumeric
+	case unicode.Is(unicode.Pc, r):
+		return wbExtendNumLet
+	case unicode.Is(unicode.Zs, r) && r != '\u00A0' && r != '\u2007' && r != '\u202F':
+		return wbWSegSpace
+	case unicode.Is(unicode.Katakana, r) || wbKatakanaExtras[r]:
+		return wbKatakana
+	case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r):
+		return wbOther
+	case unicode.Is(unicode.Hebrew, r) && unicode.IsLetter(r):
+		return wbHebrewLetter
+	case unicode.IsLetter(r) || unicode.Is(unicode.Nl, r):
+		return wbALetter
+	}
+	return wbOther
+}
+
+func (wb wordBreak) isAHLetter() bool {
+	return wb == wbALetter || wb == wbHebrewLetter
+}
+
+func (wb wordBreak) isMidLetterQ() bool {
+	return wb == wbMidLetter || wb == wbMidNumLet || wb == wbSingleQuote
+}
+
+func (wb wordBreak) isMidNumQ() bool {
+	return wb == wbMidNum || wb == wbMidNumLet || wb == wbSingleQuote
+}
+
+func (wb wordBreak) isNewline() bool {
+	return wb == wbCR || wb == wbLF || wb == wbNewline
+}
+
+// wordUnit is a rune along with the Extend, Format and ZWJ runes that follow it, the rules ignore those (WB4).
+type wordUnit struct {
+	wb       wordBreak
+	start    int
+	end      int
+	base     rune
+	last     rune
+	isLetter bool
+}
+
+func wordUnits(input string) []wordUnit {
+	var units []wordUnit
+	for i, r := range input {
+		wb := wordBreakOf(r)
+		n := len(units)
+		if n > 0 && (wb == wbExtend || wb == wbFormat || wb == wbZWJ) && !units[n-1].wb.isNewline() {
+			units[n-1].end = i + utf8.RuneLen(r)
+			units[n-1].last = r
+			continue
+		}
+		units = append(units, wordUnit{
+			wb:       wb,
+			start:    i,
+			end:      i + utf8.RuneLen(r),
+			base:     r,
+			last:     r,
+			isLetter: unicode.IsLetter(r) || unicode.IsNumber(r),
+		})
+	}
+	return units
+}
+
+// isWordBoundary applies the word boundary rules to the boundary before units[i].
+func isWordBoundary(units []wordUnit, i int) bool {
+	before, after := units[i-1].wb, units[i].wb
+	prev, next := wbOther, wbOther
+	if i > 1 {
+		prev = units[i-2].wb
+	}
+	if i+1 < len(units) {
+		next = units[i+1].wb
+	}
+
+	switch {
+	case before == wbCR && after == wbLF: // WB3
+		return false
+	case before.isNewline() || after.isNewline(): // WB3a, WB3b
+		return true
+	case units[i-1].last == '\u200D' && unicode.Is(unicode.So, units[i].base): // WB3c
+		return false
+	case before == wbWSegSpace && after == wbWSegSpace: // WB3d
+		return false
+	case before.isAHLetter() && after.isAHLetter(): // WB5
+		return false
+	case before.isAHLetter() && after.isMidLetterQ() && next.isAHLetter(): // WB6
+		return false
+	case prev.isAHLetter() && before.isMidLetterQ() && after.isAHLetter(): // WB7
+		return false
+	case before == wbHebrewLetter && after == wbSingleQuote: // WB7a
+		return false
+	case before == wbHebrewLetter && after == wbDoubleQuote && next == wbHebrewLetter: // WB7b
+		return false
+	case prev == wbHebrewLetter && before == wbDoubleQuote && after == wbHebrewLetter: // WB7c
+		return false
+	case before == wbNumeric && after == wbNumeric: // WB8
+		return false
+	case before.isAHLetter() && after == wbNumeric: // WB9
+		return false
+	case before == wbNumeric && after.isAHLetter(): // WB10
+		return false
+	case prev == wbNumeric && before.isMidNumQ() && after == wbNumeric: // WB11
+		return false
+	case before == wbNumeric && after.isMidNumQ() && next == wbNumeric: // WB12
+		return false
+	case before == wbKatakana && after == wbKatakana: // WB13
+		return false
+	case (before.isAHLetter() || before == wbNumeric || before == wbKatakana || before == wbExtendNumLet) &&
+		after == wbExtendNumLet: // WB13a
+		return false
+	case before == wbExtendNumLet && (after.isAHLetter() || after == wbNumeric || after == wbKatakana): // WB13b
+		return false
+	case before == wbRegionalIndicator && after == wbRegionalIndicator: // WB15, WB16
+		count := 0
+		for j := i - 1; j >= 0 && units[j].wb == wbRegionalIndicator; j-- {
+			count++
+		}
+		return count%2 == 0
+	}
+	return true // WB999
+}
+
+// SegmentWords splits the input into the words on the Unicode word boundaries (UAX #29) e.g. "can't stop 3.14
+// e.g." is split into can't, stop, 3.14 and e.g while the punctuation and the spaces in between are dropped. Each
+// ideograph is a word of its own.
+func SegmentWords(input string) []string {
+	units := wordUnits(input)
+
+	var (
+		words  []string
+		start  int
+		isWord bool
+	)
+	for i, unit := range units {
+		if i > 0 && isWordBoundary(units, i) {
+			if isWord {
+				words = append(words, input[units[start].start:units[i-1].end])
+			}
+			start, isWord = i, false
+		}
+		isWord = isWord || unit.isLetter
+	}
+	if isWord {
+		words = append(words, input[units[start].start:units[len(units)-1].end])
+	}
+	return words
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package middleware
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strings"
+)
+
+const (
+	bearerPrefix = "Bearer "
+)
+
+// BearerTokenMiddleware rejects the requests without one of the tokens in the Authorization header with a 401, the
+// requests to the open paths e.g. the health endpoint are let through.
+func BearerTokenMiddleware(tokens []string, openPaths ...string) mux.MiddlewareFunc {
+	open := map[string]bool{}
+	for _, path := range openPaths {
+		open[path] = true
+	}
+
+	return mux.MiddlewareFunc(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if open[req.URL.Path] || validToken(req.Header.Get("Authorization"), tokens) {
+				next.ServeHTTP(w, req)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="appmeta"`)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(struct {
+				Message string `json:"message"`
+			}{"missing or invalid bearer token"})
+		})
+	})
+}
+
+// validToken compares the bearer token with all the tokens in constant time.
+func validToken(header string, tokens []string) bool {
+	if !strings.HasPrefix(header, bearerPrefix) {
+		return false
+	}
+	token := []byte(strings.TrimSpace(header[len(bearerPrefix):]))
+
+	valid := false
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare(token, []byte(t)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
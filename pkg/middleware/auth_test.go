@@ -0,0 +1,50 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package middleware
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBearerTokenMiddleware(t *testing.T) {
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+	handler := BearerTokenMiddleware([]string{"one", "two"}, "/api/v1/metadata/_health")(ok)
+
+	testCases := map[string]struct {
+		path          string
+		authorization string
+		expected      int
+	}{
+		"validToken":        {path: "/api/v1/metadata", authorization: "Bearer two", expected: http.StatusOK},
+		"paddedToken":       {path: "/api/v1/metadata", authorization: "Bearer  one ", expected: http.StatusOK},
+		"missingToken":      {path: "/api/v1/metadata", expected: http.StatusUnauthorized},
+		"invalidToken":      {path: "/api/v1/metadata", authorization: "Bearer three", expected: http.StatusUnauthorized},
+		"notBearer":         {path: "/api/v1/metadata", authorization: "Basic b25lOg==", expected: http.StatusUnauthorized},
+		"prefixToken":       {path: "/api/v1/metadata", authorization: "Bearer on", expected: http.StatusUnauthorized},
+		"openHealth":        {path: "/api/v1/metadata/_health", expected: http.StatusOK},
+		"openPathOnlyExact": {path: "/api/v1/metadata/_health/more", expected: http.StatusUnauthorized},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(tt *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, v.path, nil)
+			if v.authorization != "" {
+				req.Header.Set("Authorization", v.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(tt, v.expected, w.Code)
+			if v.expected == http.StatusUnauthorized {
+				assert.Equal(tt, `Bearer realm="appmeta"`, w.Header().Get("WWW-Authenticate"))
+				assert.JSONEq(tt, `{"message": "missing or invalid bearer token"}`, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+)
+
+const (
+	// errBodyTooLarge is the message of the error http.MaxBytesReader fails with past the limit
+	errBodyTooLarge = "http: request body too large"
+)
+
+// MaxBodyBytesMiddleware rejects the request bodies larger than maxBytes with a 413. A body with a larger
+// Content-Length is rejected before it is read, otherwise the reading of the body fails once it passes maxBytes and
+// the client error the handler responds with is replaced with the 413.
+func MaxBodyBytesMiddleware(maxBytes int64) mux.MiddlewareFunc {
+	return mux.MiddlewareFunc(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.ContentLength > maxBytes {
+				writeTooLarge(w, maxBytes)
+				return
+			}
+			if req.Body == nil {
+				next.ServeHTTP(w, req)
+				return
+			}
+			body := &limitedBody{ReadCloser: http.MaxBytesReader(w, req.Body, maxBytes)}
+			req.Body = body
+			next.ServeHTTP(&limitedBodyWriter{delegate: w, body: body, maxBytes: maxBytes}, req)
+		})
+	})
+}
+
+// limitedBody remembers whether the reading of the body failed on the limit of http.MaxBytesReader.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err.Error() == errBodyTooLarge {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// limitedBodyWriter replaces the client error the handler responds with to a body that exceeded the limit with a 413,
+// the response of the handler is discarded.
+type limitedBodyWriter struct {
+	delegate http.ResponseWriter
+	body     *limitedBody
+	maxBytes int64
+	rejected bool
+}
+
+func (l *limitedBodyWriter) Header() http.Header {
+	return l.delegate.Header()
+}
+
+func (l *limitedBodyWriter) Write(b []byte) (int, error) {
+	if l.rejected {
+		return len(b), nil
+	}
+	return l.delegate.Write(b)
+}
+
+func (l *limitedBodyWriter) WriteHeader(statusCode int) {
+	if l.body.exceeded && statusCode >= 400 && statusCode < 500 {
+		l.rejected = true
+		writeTooLarge(l.delegate, l.maxBytes)
+		return
+	}
+	l.delegate.WriteHeader(statusCode)
+}
+
+func writeTooLarge(w http.ResponseWriter, maxBytes int64) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Connection", "close")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	json.NewEncoder(w).Encode(struct {
+		Message string `json:"message"`
+	}{fmt.Sprintf("request body is larger than %d bytes", maxBytes)})
+}
+
+// MaxInFlightMiddleware rejects the requests beyond the max number of the requests being served at once with a 503.
+func MaxInFlightMiddleware(max int) mux.MiddlewareFunc {
+	inFlight := make(chan struct{}, max)
+
+	return mux.MiddlewareFunc(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			select {
+			case inFlight <- struct{}{}:
+				defer func() { <-inFlight }()
+				next.ServeHTTP(w, req)
+			default:
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				json.NewEncoder(w).Encode(struct {
+					Message string `json:"message"`
+				}{"too many requests in flight"})
+			}
+		})
+	})
+}
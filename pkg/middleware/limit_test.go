@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) Vijay Poliboyina 2019.
+ */
+
+package middleware
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxBodyBytesMiddleware(t *testing.T) {
+
+	// the handler responds with a client error when it fails to read the body, like the decoders of the transport
+	echo := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid body"))
+			return
+		}
+		w.Write(body)
+	})
+	handler := MaxBodyBytesMiddleware(8)(echo)
+
+	testCases := map[string]struct {
+		body          string
+		contentLength int64
+		expected      int
+	}{
+		"withinLimit":      {body: "12345678", contentLength: 8, expected: http.StatusOK},
+		"tooLarge":         {body: "123456789", contentLength: 9, expected: http.StatusRequestEntityTooLarge},
+		"tooLargeChunked":  {body: "123456789", contentLength: -1, expected: http.StatusRequestEntityTooLarge},
+		"withinLimitChunk": {body: "1234", contentLength: -1, expected: http.StatusOK},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(tt *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/metadata", strings.NewReader(v.body))
+			req.ContentLength = v.contentLength
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(tt, v.expected, w.Code)
+			if v.expected == http.StatusOK {
+				assert.Equal(tt, v.body, w.Body.String())
+			} else {
+				assert.JSONEq(tt, `{"message": "request body is larger than 8 bytes"}`, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMaxInFlightMiddleware(t *testing.T) {
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	blocking := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		entered <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := MaxInFlightMiddleware(1)(blocking)
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/api/v1/metadata", nil))
+		close(done)
+	}()
+	<-entered
+
+	// the second request is rejected while the first one is in flight
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/metadata", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"message": "too many requests in flight"}`, w.Body.String())
+
+	close(release)
+	<-done
+	assert.Equal(t, http.StatusOK, first.Code)
+
+	// the slot is released once the request is served
+	go func() { <-entered }()
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/metadata", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}